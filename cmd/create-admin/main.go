@@ -5,6 +5,7 @@ import (
 	"log"
 	"mitsuki-jpy-quiz/config"
 	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/migrations"
 	"mitsuki-jpy-quiz/internal/models"
 	"mitsuki-jpy-quiz/pkg/utils"
 )
@@ -16,12 +17,12 @@ func main() {
 	cfg := config.Load()
 
 	// Connect to database
-	if err := database.Connect(cfg.DatabaseURL); err != nil {
+	if err := database.Connect(cfg.DatabaseDriver, cfg.DatabaseURL); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
 	// Run migrations
-	if err := database.Migrate(); err != nil {
+	if _, err := migrations.Up(database.DB); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
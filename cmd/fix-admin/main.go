@@ -6,6 +6,7 @@ import (
 	"mitsuki-jpy-quiz/config"
 	"mitsuki-jpy-quiz/internal/database"
 	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/twofactor"
 	"mitsuki-jpy-quiz/pkg/utils"
 )
 
@@ -16,7 +17,7 @@ func main() {
 	cfg := config.Load()
 
 	// Connect to database
-	if err := database.Connect(cfg.DatabaseURL); err != nil {
+	if err := database.Connect(cfg.DatabaseDriver, cfg.DatabaseURL); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
@@ -64,6 +65,14 @@ func main() {
 		admin.Password = hashedPassword
 		fmt.Println("→ Resetting password to: admin123")
 
+		// A lost authenticator app is a common reason to run this
+		if admin.TwoFactorEnabled() || admin.TOTPSecret != "" {
+			if err := twofactor.Disable(database.DB, &admin); err != nil {
+				log.Fatal("Failed to turn off two-factor authentication:", err)
+			}
+			fmt.Println("→ Turning off two-factor authentication")
+		}
+
 		// Save changes
 		if err := database.DB.Save(&admin).Error; err != nil {
 			log.Fatal("Failed to update admin:", err)
@@ -77,4 +86,5 @@ func main() {
 	fmt.Println("Password: admin123")
 	fmt.Println("Phone: 0000000000")
 	fmt.Println("\n⚠️  Please change the password after first login!")
+	fmt.Println("⚠️  Set up two-factor authentication again in the dashboard, or at sign-in if REQUIRE_STAFF_2FA is on.")
 }
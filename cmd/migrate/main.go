@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"mitsuki-jpy-quiz/config"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/migrations"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const migrationsDir = "internal/migrations"
+
+const usage = `Usage: go run ./cmd/migrate <command>
+
+Commands:
+  up             Apply all pending migrations
+  down [steps]   Roll back the last applied migration(s) (default 1)
+  status         List migrations and whether they are applied
+  create <name>  Write a new numbered migration file to ` + migrationsDir
+
+const template = `package migrations
+
+import "gorm.io/gorm"
+
+func init() {
+	register(Migration{
+		Version: %d,
+		Name:    %q,
+		Up: func(tx *gorm.DB) error {
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	})
+}
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	command := os.Args[1]
+
+	// create only writes a file, so it does not need a database
+	if command == "create" {
+		if len(os.Args) < 3 {
+			log.Fatal("create needs a migration name, e.g. `create add_course_code`")
+		}
+		create(os.Args[2])
+		return
+	}
+
+	cfg := config.Load()
+	if err := database.Connect(cfg.DatabaseDriver, cfg.DatabaseURL); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	switch command {
+	case "up":
+		ran, err := migrations.Up(database.DB)
+		for _, m := range ran {
+			fmt.Printf("Applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("Database is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			n, err := strconv.Atoi(os.Args[2])
+			if err != nil || n < 1 {
+				log.Fatalf("Invalid step count %q", os.Args[2])
+			}
+			steps = n
+		}
+
+		ran, err := migrations.Down(database.DB, steps)
+		for _, m := range ran {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal("Rollback failed: ", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("No applied migrations to roll back")
+		}
+
+	case "status":
+		statuses, err := migrations.StatusOf(database.DB)
+		if err != nil {
+			log.Fatal("Failed to read migration status: ", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// create writes an empty migration numbered after the latest registered one
+func create(name string) {
+	name = strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		log.Fatal("Migration name must contain letters or digits")
+	}
+
+	version := migrations.Latest() + 1
+	path := filepath.Join(migrationsDir, fmt.Sprintf("%04d_%s.go", version, name))
+
+	if _, err := os.Stat(path); err == nil {
+		log.Fatalf("%s already exists", path)
+	}
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(template, version, name)), 0644); err != nil {
+		log.Fatal("Failed to write migration: ", err)
+	}
+
+	fmt.Printf("Created %s\n", path)
+}
@@ -3,9 +3,15 @@ package main
 import (
 	"log"
 	"mitsuki-jpy-quiz/config"
+	"mitsuki-jpy-quiz/internal/attempts"
 	"mitsuki-jpy-quiz/internal/database"
 	"mitsuki-jpy-quiz/internal/handlers"
 	"mitsuki-jpy-quiz/internal/middleware"
+	"mitsuki-jpy-quiz/internal/migrations"
+	"mitsuki-jpy-quiz/internal/otp"
+	"mitsuki-jpy-quiz/internal/throttle"
+	"mitsuki-jpy-quiz/internal/trash"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,18 +21,49 @@ func main() {
 	cfg := config.Load()
 
 	// Connect to database
-	if err := database.Connect(cfg.DatabaseURL); err != nil {
+	if err := database.Connect(cfg.DatabaseDriver, cfg.DatabaseURL); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// Run migrations
-	if err := database.Migrate(); err != nil {
-		log.Fatal("Failed to migrate database:", err)
+	// Refuse to start on an outdated schema
+	if err := migrations.CheckCurrent(database.DB); err != nil {
+		log.Fatal("Database not migrated: ", err)
 	}
 
+	// Close attempts that ran past their deadline
+	attempts.StartSweeper(
+		time.Duration(cfg.AttemptSweepMinutes)*time.Minute,
+		time.Duration(cfg.ExamGraceSeconds)*time.Second,
+	)
+
+	// Purge what has been in the trash past the retention period
+	trash.StartPurger(
+		time.Duration(cfg.TrashPurgeHours)*time.Hour,
+		time.Duration(cfg.TrashRetentionDays)*24*time.Hour,
+	)
+
+	// Passcode senders for quiz verification
+	otpSenders, err := otp.NewSenders(cfg)
+	if err != nil {
+		log.Fatal("Invalid OTP configuration: ", err)
+	}
+
+	// Failure counters for brute-force protection
+	loginStore, err := throttle.NewStore(cfg)
+	if err != nil {
+		log.Fatal("Invalid login limit configuration: ", err)
+	}
+	limiter := throttle.NewLimiter(loginStore)
+
 	// Initialize Gin router
 	router := gin.Default()
 
+	// Only believe X-Forwarded-For from our own reverse proxy, so clients
+	// cannot pick the IP address their failures are counted against
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+
 	// Load HTML templates
 	router.LoadHTMLGlob("web/templates/**/*.html")
 
@@ -35,13 +72,19 @@ func main() {
 	router.Static("/uploads", "./web/uploads")
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(cfg)
+	authHandler := handlers.NewAuthHandler(cfg, otpSenders, limiter)
 	courseHandler := handlers.NewCourseHandler()
 	quizPackageHandler := handlers.NewQuizPackageHandler()
 	questionHandler := handlers.NewQuestionHandler()
-	studentHandler := handlers.NewStudentHandler()
+	questionPoolHandler := handlers.NewQuestionPoolHandler()
+	gradingHandler := handlers.NewGradingHandler()
+	studentHandler := handlers.NewStudentHandler(cfg)
 	webHandler := handlers.NewWebHandler()
 	imageHandler := handlers.NewImageHandler()
+	staffHandler := handlers.NewStaffHandler(cfg, limiter)
+	auditHandler := handlers.NewAuditHandler()
+	trashHandler := handlers.NewTrashHandler(cfg)
+	lockoutHandler := handlers.NewLockoutHandler(limiter)
 
 	// Web routes (HTML pages)
 	router.GET("/admin/login", webHandler.AdminLoginPage)
@@ -63,8 +106,13 @@ func main() {
 	public := router.Group("/api")
 	{
 		public.POST("/auth/admin/login", authHandler.AdminLogin)
+		public.POST("/auth/admin/2fa", authHandler.VerifyTwoFactorLogin)
+		public.POST("/auth/admin/2fa/setup", authHandler.SetupTwoFactorLogin)
+		public.POST("/auth/admin/2fa/enable", authHandler.EnableTwoFactorLogin)
 		public.POST("/auth/student/login", authHandler.StudentLogin)
 		public.POST("/auth/student/register", authHandler.StudentRegister)
+		public.POST("/auth/refresh", authHandler.RefreshSession)
+		public.POST("/auth/logout", authHandler.Logout)
 
 		// Public course registration
 		public.POST("/register/course/:courseId", authHandler.RegisterForCourse)
@@ -80,28 +128,69 @@ func main() {
 		public.POST("/quiz/submit", studentHandler.SubmitPublicQuiz)
 		public.GET("/quiz/check-device", studentHandler.CheckDeviceEligibility)
 		public.GET("/quiz/check-phone", authHandler.CheckPhoneNumberForQuiz)
+		public.POST("/quiz/otp/request", authHandler.RequestQuizOTP)
+		public.POST("/quiz/otp/verify", authHandler.VerifyQuizOTP)
+		public.POST("/student/quiz/draw", studentHandler.DrawRegisteredStudentQuiz)
+		public.POST("/student/quiz/save-answer", studentHandler.SaveRegisteredStudentAnswer)
 		public.POST("/student/quiz/submit-registered", studentHandler.SubmitRegisteredStudentQuiz)
 	}
 
-	// Admin routes (requires auth + admin role)
+	// Admin routes (requires auth + a staff role; handlers check each course).
+	// Every write is recorded in the audit log.
 	admin := router.Group("/api/admin")
-	admin.Use(middleware.AuthMiddleware(cfg), middleware.AdminOnly())
+	admin.Use(middleware.AuthMiddleware(cfg), middleware.StaffOnly(), middleware.Audit())
 	{
+		admin.GET("/me", staffHandler.Me)
+		admin.POST("/me/2fa/setup", staffHandler.SetupTwoFactor)
+		admin.POST("/me/2fa/enable", staffHandler.EnableTwoFactor)
+		admin.POST("/me/2fa/disable", staffHandler.DisableTwoFactor)
+		admin.POST("/me/2fa/recovery-codes", staffHandler.RegenerateRecoveryCodes)
+
 		// Course management
+		admin.GET("/courses", courseHandler.GetCoursesAdmin)
+		admin.GET("/courses/:id", courseHandler.GetCourseAdmin)
 		admin.POST("/courses", courseHandler.CreateCourse)
 		admin.PUT("/courses/:id", courseHandler.UpdateCourse)
 		admin.DELETE("/courses/:id", courseHandler.DeleteCourse)
 		admin.GET("/courses/:id/stats", courseHandler.GetCourseStats)
+		admin.POST("/courses/:id/clone", courseHandler.CloneCourse)
+
+		// Course staff
+		admin.GET("/courses/:id/members", staffHandler.ListCourseMembers)
+		admin.POST("/courses/:id/members", staffHandler.AddCourseMember)
+		admin.PUT("/courses/:id/members/:userId", staffHandler.UpdateCourseMember)
+		admin.DELETE("/courses/:id/members/:userId", staffHandler.RemoveCourseMember)
 
 		// Quiz package management
 		admin.POST("/quiz-packages", quizPackageHandler.CreateQuizPackage)
 		admin.PUT("/quiz-packages/:id", quizPackageHandler.UpdateQuizPackage)
 		admin.DELETE("/quiz-packages/:id", quizPackageHandler.DeleteQuizPackage)
-		admin.GET("/quiz-packages/:id", quizPackageHandler.GetQuizPackage)
-		admin.GET("/quiz-packages/:id/stats", quizPackageHandler.GetQuizPackageStats) // Question management
+		admin.GET("/quiz-packages/:id", quizPackageHandler.GetQuizPackageAdmin)
+		admin.GET("/quiz-packages/:id/stats", quizPackageHandler.GetQuizPackageStats)
+		admin.GET("/quiz-packages/:id/item-analysis", quizPackageHandler.GetQuizPackageItemAnalysis)
+		admin.POST("/quiz-packages/:id/clone", quizPackageHandler.CloneQuizPackage)
+		admin.POST("/quiz-packages/:id/questions/import", questionHandler.ImportQuestions)
+		admin.GET("/quiz-packages/:id/questions/export", questionHandler.ExportQuestions)
+
+		// Question management
+		admin.GET("/questions/package/:packageId", questionHandler.GetQuestionsByPackageAdmin)
 		admin.POST("/questions", questionHandler.CreateQuestion)
 		admin.PUT("/questions/:id", questionHandler.UpdateQuestion)
 		admin.DELETE("/questions/:id", questionHandler.DeleteQuestion)
+		admin.GET("/questions/:id/versions", questionHandler.GetQuestionVersions)
+
+		// Question bank pools
+		admin.GET("/quiz-packages/:id/pools", questionPoolHandler.ListPools)
+		admin.POST("/quiz-packages/:id/pools", questionPoolHandler.CreatePool)
+		admin.PUT("/question-pools/:id", questionPoolHandler.UpdatePool)
+		admin.DELETE("/question-pools/:id", questionPoolHandler.DeletePool)
+
+		// Manual grading
+		admin.GET("/quiz-packages/:id/grading-queue", gradingHandler.GetGradingQueue)
+		admin.PUT("/answers/:id/grade", gradingHandler.GradeAnswer)
+		admin.GET("/answers/:id/reviews", gradingHandler.GetAnswerReviews)
+		admin.POST("/questions/:id/regrade", gradingHandler.RegradeQuestion)
+		admin.POST("/quiz-packages/:id/regrade", gradingHandler.RegradeQuizPackage)
 
 		// Image upload
 		admin.POST("/upload/image", imageHandler.UploadImage)
@@ -111,11 +200,34 @@ func main() {
 		admin.GET("/students", studentHandler.ListStudents)
 		admin.GET("/students/courses", studentHandler.GetCoursesWithStudentCount)
 		admin.GET("/students/course/:courseId", studentHandler.GetStudentsByCourse)
-		admin.DELETE("/students/:id", studentHandler.DeleteStudent)
+		admin.DELETE("/students/:id", middleware.AdminOnly(), studentHandler.DeleteStudent)
+		admin.DELETE("/users/:id/sessions", middleware.AdminOnly(), authHandler.RevokeUserSessions)
 
 		// Enrollment management
 		admin.GET("/enrollments/course/:courseId", studentHandler.GetEnrollmentsByCourse)
 		admin.PUT("/enrollments/:enrollmentId/status", studentHandler.UpdateEnrollmentStatus)
+
+		// Staff accounts
+		staff := admin.Group("/staff", middleware.AdminOnly())
+		staff.GET("", staffHandler.ListStaff)
+		staff.POST("", staffHandler.InviteStaff)
+		staff.PUT("/:id", staffHandler.UpdateStaff)
+		staff.DELETE("/:id", staffHandler.RemoveStaff)
+		staff.DELETE("/:id/2fa", staffHandler.ResetTwoFactor)
+
+		// Trash: deleted courses, quiz packages, questions and pools
+		admin.GET("/trash/:kind", trashHandler.ListTrash)
+		admin.POST("/trash/:kind/:id/restore", trashHandler.RestoreTrashItem)
+		admin.DELETE("/trash/:kind/:id", trashHandler.PurgeTrashItem)
+		admin.POST("/trash/purge", middleware.AdminOnly(), trashHandler.PurgeExpiredTrash)
+
+		// Login lockouts
+		admin.GET("/lockouts", middleware.AdminOnly(), lockoutHandler.ListLockouts)
+		admin.POST("/lockouts/:id/unlock", middleware.AdminOnly(), lockoutHandler.UnlockLockout)
+
+		// Audit log
+		admin.GET("/audit-logs", middleware.AdminOnly(), auditHandler.ListAuditLogs)
+		admin.GET("/audit-logs/export", middleware.AdminOnly(), auditHandler.ExportAuditLogs)
 	}
 
 	// Student routes (requires auth)
@@ -128,6 +240,7 @@ func main() {
 		student.POST("/quiz/complete/:attemptId", studentHandler.CompleteQuiz)
 		student.GET("/attempts", studentHandler.GetMyAttempts)
 		student.GET("/attempts/:attemptId", studentHandler.GetAttemptDetail)
+		student.GET("/attempts/:attemptId/review", studentHandler.ReviewAttempt)
 	}
 
 	// Start server
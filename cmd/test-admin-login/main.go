@@ -15,7 +15,7 @@ func main() {
 	cfg := config.Load()
 
 	// Connect to database
-	if err := database.Connect(cfg.DatabaseURL); err != nil {
+	if err := database.Connect(cfg.DatabaseDriver, cfg.DatabaseURL); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
@@ -4,21 +4,116 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
 	ServerPort     string
-	DatabaseURL    string
+	DatabaseDriver string // sqlite, postgres or mysql
+	DatabaseURL    string // File path for SQLite, DSN for PostgreSQL/MySQL
 	JWTSecret      string
-	JWTExpireHours int
+	JWTExpireHours int // How long a login session lasts without being refreshed
+
+	AccessTokenMinutes int // Lifetime of an access token; refresh tokens renew it
+
+	// Exam timing
+	ExamGraceSeconds    int // Extra time accepted after an attempt's deadline
+	AttemptSweepMinutes int // How often stale in-progress attempts are closed
+	QuizTokenMinutes    int // How long a phone-check quiz token can wait before the exam time starts counting
+
+	// Brute-force protection for sign-ins and quiz lookups
+	LoginLimitStore       string // Where failure counters live: memory
+	LoginMaxFailures      int    // Failed sign-ins on one account before it is locked
+	LoginIPMaxFailures    int    // Failed sign-ins from one IP address before it is locked
+	LoginWindowMinutes    int    // Failures older than this are forgotten
+	LoginLockoutMinutes   int
+	LoginDelaySeconds     int // Wait after the first failed sign-in; doubles with each further failure
+	LoginMaxDelaySeconds  int
+	QuizLookupMaxFailures int // Lookups of unregistered phone numbers or emails, and wrong passcodes, from one IP address before it is locked
+
+	// Proxies whose X-Forwarded-For header is believed when working out a
+	// client's IP address; empty trusts none
+	TrustedProxies []string
+
+	// Two-factor authentication for staff
+	RequireStaff2FA bool   // Staff must set up an authenticator app before they can sign in
+	TwoFactorIssuer string // Name authenticator apps show next to the account
+
+	// Trash
+	TrashRetentionDays int // How long deleted courses, packages and questions can be restored; 0 keeps them forever
+	TrashPurgeHours    int // How often records past the retention are purged
+
+	// One-time passcodes. Each channel's sender is log, file, twilio, smtp,
+	// telegram, or empty to turn the channel off.
+	OTPSMSSender      string
+	OTPEmailSender    string
+	OTPTelegramSender string
+	OTPFile           string // Where the file sender writes codes
+	OTPTTLMinutes     int
+	OTPMaxAttempts    int // Wrong codes allowed before a new one is needed
+	OTPResendSeconds  int
+	OTPMaxPerHour     int
+
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	TwilioFrom       string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPFrom         string
+	TelegramBotToken string
 }
 
 func Load() *Config {
 	return &Config{
 		ServerPort:     getEnv("SERVER_PORT", "8080"),
+		DatabaseDriver: getEnv("DATABASE_DRIVER", "sqlite"),
 		DatabaseURL:    getEnv("DATABASE_URL", "quiz.db"),
 		JWTSecret:      getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
 		JWTExpireHours: getEnvAsInt("JWT_EXPIRE_HOURS", 24),
+
+		AccessTokenMinutes: getEnvAsInt("JWT_ACCESS_MINUTES", 15),
+
+		ExamGraceSeconds:    getEnvAsInt("EXAM_GRACE_SECONDS", 60),
+		AttemptSweepMinutes: getEnvAsInt("ATTEMPT_SWEEP_MINUTES", 5),
+		QuizTokenMinutes:    getEnvAsInt("QUIZ_TOKEN_MINUTES", 15),
+
+		LoginLimitStore:       getEnv("LOGIN_LIMIT_STORE", "memory"),
+		LoginMaxFailures:      getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+		LoginIPMaxFailures:    getEnvAsInt("LOGIN_IP_MAX_FAILURES", 50),
+		LoginWindowMinutes:    getEnvAsInt("LOGIN_WINDOW_MINUTES", 15),
+		LoginLockoutMinutes:   getEnvAsInt("LOGIN_LOCKOUT_MINUTES", 15),
+		LoginDelaySeconds:     getEnvAsInt("LOGIN_DELAY_SECONDS", 1),
+		LoginMaxDelaySeconds:  getEnvAsInt("LOGIN_MAX_DELAY_SECONDS", 30),
+		QuizLookupMaxFailures: getEnvAsInt("QUIZ_LOOKUP_MAX_FAILURES", 20),
+
+		TrustedProxies: getEnvAsList("TRUSTED_PROXIES", "127.0.0.1"),
+
+		RequireStaff2FA: getEnvAsBool("REQUIRE_STAFF_2FA", false),
+		TwoFactorIssuer: getEnv("TWO_FACTOR_ISSUER", "Mitsuki JPY"),
+
+		TrashRetentionDays: getEnvAsInt("TRASH_RETENTION_DAYS", 30),
+		TrashPurgeHours:    getEnvAsInt("TRASH_PURGE_HOURS", 24),
+
+		OTPSMSSender:      getEnv("OTP_SMS_SENDER", "log"),
+		OTPEmailSender:    getEnv("OTP_EMAIL_SENDER", "log"),
+		OTPTelegramSender: os.Getenv("OTP_TELEGRAM_SENDER"),
+		OTPFile:           getEnv("OTP_FILE", "otp.log"),
+		OTPTTLMinutes:     getEnvAsInt("OTP_TTL_MINUTES", 5),
+		OTPMaxAttempts:    getEnvAsInt("OTP_MAX_ATTEMPTS", 5),
+		OTPResendSeconds:  getEnvAsInt("OTP_RESEND_SECONDS", 60),
+		OTPMaxPerHour:     getEnvAsInt("OTP_MAX_PER_HOUR", 5),
+
+		TwilioAccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+		TwilioAuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+		TwilioFrom:       os.Getenv("TWILIO_FROM"),
+		SMTPHost:         os.Getenv("SMTP_HOST"),
+		SMTPPort:         getEnvAsInt("SMTP_PORT", 587),
+		SMTPUsername:     os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:     os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:         os.Getenv("SMTP_FROM"),
+		TelegramBotToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
 	}
 }
 
@@ -42,3 +137,27 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return value
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default: %t", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsList reads a comma-separated list; "none" gives an empty one
+func getEnvAsList(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" && item != "none" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
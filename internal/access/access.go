@@ -0,0 +1,125 @@
+// Package access decides what staff may do in each course. Admins may do
+// everything; teachers and assistants only act in courses they are members
+// of, as far as their course role allows.
+package access
+
+import (
+	"errors"
+	"mitsuki-jpy-quiz/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Permission is what a staff member wants to do in a course
+type Permission int
+
+const (
+	View   Permission = iota + 1 // See the course, its questions, students and results
+	Grade                        // Grade answers and manage enrollments
+	Edit                         // Change quiz packages, questions and pools
+	Manage                       // Change or delete the course and manage its staff
+)
+
+// Allows reports whether a course role grants the permission
+func Allows(role models.CourseRole, permission Permission) bool {
+	switch role {
+	case models.CourseOwner:
+		return true
+	case models.CourseTeacher:
+		return permission <= Edit
+	case models.CourseAssistant:
+		return permission <= Grade
+	}
+	return false
+}
+
+// Can reports whether the user may act on the course
+func Can(db *gorm.DB, userID uint, role models.UserRole, courseID uint, permission Permission) (bool, error) {
+	if role == models.RoleAdmin {
+		return true, nil
+	}
+	if !role.IsStaff() {
+		return false, nil
+	}
+
+	var member models.CourseMember
+	err := db.Where("course_id = ? AND user_id = ?", courseID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return Allows(member.Role, permission), nil
+}
+
+// Courses returns the IDs of the courses the user is a member of. all is true
+// for admins, who see every course.
+func Courses(db *gorm.DB, userID uint, role models.UserRole) (ids []uint, all bool, err error) {
+	if role == models.RoleAdmin {
+		return nil, true, nil
+	}
+	ids = []uint{}
+	err = db.Model(&models.CourseMember{}).Where("user_id = ?", userID).Pluck("course_id", &ids).Error
+	return ids, false, err
+}
+
+// Scope limits a query on a table with a course_id column to the user's courses
+func Scope(db *gorm.DB, userID uint, role models.UserRole, column string) (*gorm.DB, error) {
+	ids, all, err := Courses(db.Session(&gorm.Session{NewDB: true}), userID, role)
+	if err != nil || all {
+		return db, err
+	}
+	return db.Where(column+" IN ?", append(ids, 0)), nil
+}
+
+// The course each kind of record belongs to. Deleted records are included so
+// that their history stays reachable by the course staff.
+
+func CourseOfPackage(db *gorm.DB, id uint) (uint, error) {
+	return courseOf(db, "quiz_packages", "course_id", id)
+}
+
+func CourseOfQuestion(db *gorm.DB, id uint) (uint, error) {
+	return courseVia(db, "questions", id)
+}
+
+func CourseOfPool(db *gorm.DB, id uint) (uint, error) {
+	return courseVia(db, "question_pools", id)
+}
+
+func CourseOfAttempt(db *gorm.DB, id uint) (uint, error) {
+	return courseOf(db, "attempts", "course_id", id)
+}
+
+func CourseOfAnswer(db *gorm.DB, id uint) (uint, error) {
+	attemptID, err := courseOf(db, "answers", "attempt_id", id)
+	if err != nil {
+		return 0, err
+	}
+	return CourseOfAttempt(db, attemptID)
+}
+
+func CourseOfEnrollment(db *gorm.DB, id uint) (uint, error) {
+	return courseOf(db, "enrollments", "course_id", id)
+}
+
+func courseOf(db *gorm.DB, table, column string, id uint) (uint, error) {
+	var ids []uint
+	if err := db.Table(table).Where("id = ?", id).Limit(1).Pluck(column, &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return ids[0], nil
+}
+
+// courseVia looks up a record's quiz package and then its course
+func courseVia(db *gorm.DB, table string, id uint) (uint, error) {
+	packageID, err := courseOf(db, table, "quiz_package_id", id)
+	if err != nil {
+		return 0, err
+	}
+	return CourseOfPackage(db, packageID)
+}
@@ -0,0 +1,254 @@
+package analytics
+
+import (
+	"encoding/json"
+	"math"
+	"mitsuki-jpy-quiz/internal/grading"
+	"mitsuki-jpy-quiz/internal/models"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Thresholds used to flag questions worth reviewing
+const (
+	groupFraction     = 0.27 // Top and bottom share of attempts for the discrimination index
+	minFlagResponses  = 5    // Fewer responses than this are too noisy to flag
+	tooEasyPercent    = 90.0
+	tooHardPercent    = 20.0
+	lowDiscrimination = 0.2
+)
+
+// Flags attached to an item
+const (
+	FlagTooEasy                = "too_easy"
+	FlagTooHard                = "too_hard"
+	FlagLowDiscrimination      = "low_discrimination"
+	FlagNegativeDiscrimination = "negative_discrimination" // Weaker students do better; often a wrong answer key
+)
+
+const noAnswer = "(no answer)"
+
+// Choice is how many responses gave one particular answer
+type Choice struct {
+	Answer     string  `json:"answer"`
+	Count      int     `json:"count"`
+	Percentage float64 `json:"percentage"`
+	IsCorrect  bool    `json:"is_correct"`
+}
+
+// Item is the analysis of one question across completed attempts
+type Item struct {
+	QuestionID   uint                `json:"question_id"`
+	OrderNumber  int                 `json:"order_number"`
+	QuestionText string              `json:"question_text"`
+	QuestionType models.QuestionType `json:"question_type"`
+	Points       int                 `json:"points"`
+	IsActive     bool                `json:"is_active"`
+
+	Responses          int      `json:"responses"`
+	CorrectCount       int      `json:"correct_count"`
+	PercentCorrect     *float64 `json:"percent_correct"`      // nil without responses
+	Discrimination     *float64 `json:"discrimination_index"` // -1..1, nil when a group has no responses
+	AverageTimeSeconds *float64 `json:"average_time_seconds"` // nil when no time was recorded
+
+	Choices []Choice `json:"choices"`
+	Flags   []string `json:"flags"`
+}
+
+// Report is the item analysis for a quiz package
+type Report struct {
+	QuizPackageID    uint   `json:"quiz_package_id"`
+	AttemptsAnalyzed int    `json:"attempts_analyzed"`
+	GroupSize        int    `json:"group_size"` // Attempts in each of the top and bottom groups
+	Items            []Item `json:"items"`
+}
+
+// ItemAnalysis computes per-question statistics from the package's completed attempts
+func ItemAnalysis(db *gorm.DB, packageID uint) (*Report, error) {
+	var questions []models.Question
+	if err := db.Where("quiz_package_id = ?", packageID).
+		Order("order_number ASC, id ASC").
+		Find(&questions).Error; err != nil {
+		return nil, err
+	}
+
+	var attempts []models.Attempt
+	if err := db.Where("quiz_package_id = ? AND status = ?", packageID, models.StatusCompleted).
+		Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		QuizPackageID:    packageID,
+		AttemptsAnalyzed: len(attempts),
+		Items:            []Item{},
+	}
+
+	// Rank attempts by percentage score to form the top and bottom groups
+	sort.SliceStable(attempts, func(i, j int) bool {
+		return scoreRatio(attempts[i]) > scoreRatio(attempts[j])
+	})
+	groupSize := int(math.Round(groupFraction * float64(len(attempts))))
+	report.GroupSize = groupSize
+
+	upper := make(map[uint]bool, groupSize)
+	lower := make(map[uint]bool, groupSize)
+	attemptIDs := make([]uint, 0, len(attempts))
+	for i, attempt := range attempts {
+		attemptIDs = append(attemptIDs, attempt.ID)
+		if i < groupSize {
+			upper[attempt.ID] = true
+		} else if i >= len(attempts)-groupSize {
+			lower[attempt.ID] = true
+		}
+	}
+
+	answersByQuestion := make(map[uint][]models.Answer)
+	if len(attemptIDs) > 0 {
+		var answers []models.Answer
+		if err := db.Where("attempt_id IN ?", attemptIDs).Find(&answers).Error; err != nil {
+			return nil, err
+		}
+		for _, answer := range answers {
+			answersByQuestion[answer.QuestionID] = append(answersByQuestion[answer.QuestionID], answer)
+		}
+	}
+
+	for i := range questions {
+		report.Items = append(report.Items, analyzeItem(&questions[i], answersByQuestion[questions[i].ID], upper, lower))
+	}
+
+	return report, nil
+}
+
+func analyzeItem(question *models.Question, answers []models.Answer, upper, lower map[uint]bool) Item {
+	item := Item{
+		QuestionID:   question.ID,
+		OrderNumber:  question.OrderNumber,
+		QuestionText: question.QuestionText,
+		QuestionType: question.QuestionType,
+		Points:       question.Points,
+		IsActive:     question.IsActive,
+		Responses:    len(answers),
+		Flags:        []string{},
+	}
+
+	var upperTotal, upperCorrect, lowerTotal, lowerCorrect int
+	var timedCount, timeTotal int
+	for _, answer := range answers {
+		if answer.IsCorrect {
+			item.CorrectCount++
+		}
+		if upper[answer.AttemptID] {
+			upperTotal++
+			if answer.IsCorrect {
+				upperCorrect++
+			}
+		}
+		if lower[answer.AttemptID] {
+			lowerTotal++
+			if answer.IsCorrect {
+				lowerCorrect++
+			}
+		}
+		if answer.TimeSpentSeconds > 0 {
+			timedCount++
+			timeTotal += answer.TimeSpentSeconds
+		}
+	}
+
+	if item.Responses > 0 {
+		percent := round1(float64(item.CorrectCount) * 100 / float64(item.Responses))
+		item.PercentCorrect = &percent
+	}
+	if upperTotal > 0 && lowerTotal > 0 {
+		d := float64(upperCorrect)/float64(upperTotal) - float64(lowerCorrect)/float64(lowerTotal)
+		d = math.Round(d*100) / 100
+		item.Discrimination = &d
+	}
+	if timedCount > 0 {
+		avg := round1(float64(timeTotal) / float64(timedCount))
+		item.AverageTimeSeconds = &avg
+	}
+
+	item.Choices = choices(question, answers)
+
+	if item.Responses >= minFlagResponses {
+		if *item.PercentCorrect >= tooEasyPercent {
+			item.Flags = append(item.Flags, FlagTooEasy)
+		}
+		if *item.PercentCorrect <= tooHardPercent {
+			item.Flags = append(item.Flags, FlagTooHard)
+		}
+		if item.Discrimination != nil {
+			if *item.Discrimination < 0 {
+				item.Flags = append(item.Flags, FlagNegativeDiscrimination)
+			} else if *item.Discrimination < lowDiscrimination {
+				item.Flags = append(item.Flags, FlagLowDiscrimination)
+			}
+		}
+	}
+
+	return item
+}
+
+// choices groups responses by answer. Multiple choice options are listed
+// first in their original order, even when nobody picked them.
+func choices(question *models.Question, answers []models.Answer) []Choice {
+	list := []Choice{}
+	index := make(map[string]int)
+
+	add := func(answer string) int {
+		key := strings.ToLower(strings.TrimSpace(answer))
+		if key == "" {
+			key, answer = noAnswer, noAnswer
+		}
+		if i, ok := index[key]; ok {
+			return i
+		}
+		isCorrect, _ := grading.Grade(question, answer)
+		index[key] = len(list)
+		list = append(list, Choice{Answer: strings.TrimSpace(answer), IsCorrect: isCorrect && answer != noAnswer})
+		return len(list) - 1
+	}
+
+	seeded := 0
+	if question.QuestionType == models.TypeMultipleChoice && question.Options != "" {
+		var options []string
+		if err := json.Unmarshal([]byte(question.Options), &options); err == nil {
+			for _, option := range options {
+				add(option)
+			}
+			seeded = len(list)
+		}
+	}
+
+	for _, answer := range answers {
+		list[add(answer.StudentAnswer)].Count++
+	}
+
+	for i := range list {
+		if len(answers) > 0 {
+			list[i].Percentage = round1(float64(list[i].Count) * 100 / float64(len(answers)))
+		}
+	}
+
+	// Unlisted answers (free text, stale options) follow, most common first
+	extra := list[seeded:]
+	sort.SliceStable(extra, func(i, j int) bool { return extra[i].Count > extra[j].Count })
+
+	return list
+}
+
+func scoreRatio(attempt models.Attempt) float64 {
+	if attempt.TotalPoints <= 0 {
+		return 0
+	}
+	return float64(attempt.Score) / float64(attempt.TotalPoints)
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
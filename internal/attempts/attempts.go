@@ -0,0 +1,173 @@
+package attempts
+
+import (
+	"log"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Deadline returns the time by which an attempt started at start must be submitted
+func Deadline(start time.Time, examMinutes int) time.Time {
+	return start.Add(time.Duration(examMinutes) * time.Minute)
+}
+
+// IsExpired reports whether the attempt is past its deadline plus the grace period.
+// Attempts without a deadline never expire here; the sweeper backfills them.
+func IsExpired(attempt *models.Attempt, now time.Time, grace time.Duration) bool {
+	if attempt.Deadline == nil {
+		return false
+	}
+	return now.After(attempt.Deadline.Add(grace))
+}
+
+// RetakesUsed counts the attempts a student has used up on a quiz package.
+// Abandoned attempts count as well as completed ones, since their questions
+// were shown. Attempts in progress do not; they are resumed or submitted.
+func RetakesUsed(db *gorm.DB, studentID, quizPackageID uint) int {
+	var count int64
+	db.Model(&models.Attempt{}).Where(
+		"student_id = ? AND quiz_package_id = ? AND status IN ?",
+		studentID, quizPackageID, []models.AttemptStatus{models.StatusCompleted, models.StatusAbandoned},
+	).Count(&count)
+	return int(count)
+}
+
+// Finalize totals the saved answers and marks the attempt as completed
+func Finalize(db *gorm.DB, attempt *models.Attempt, endTime time.Time) error {
+	totalScore, err := sumPoints(db, attempt.ID)
+	if err != nil {
+		return err
+	}
+
+	attempt.Status = models.StatusCompleted
+	attempt.EndTime = &endTime
+	attempt.Score = totalScore
+
+	return db.Save(attempt).Error
+}
+
+// Rescore re-totals an attempt's saved answers after a grade was changed
+func Rescore(db *gorm.DB, attemptID uint) (int, error) {
+	totalScore, err := sumPoints(db, attemptID)
+	if err != nil {
+		return 0, err
+	}
+	err = db.Model(&models.Attempt{}).Where("id = ?", attemptID).Update("score", totalScore).Error
+	return totalScore, err
+}
+
+func sumPoints(db *gorm.DB, attemptID uint) (int, error) {
+	var totalScore int64
+	err := db.Model(&models.Answer{}).
+		Where("attempt_id = ?", attemptID).
+		Select("COALESCE(SUM(points_earned), 0)").
+		Scan(&totalScore).Error
+	return int(totalScore), err
+}
+
+// Sweep closes in-progress attempts whose deadline plus grace has passed.
+// Attempts with saved answers are auto-completed; empty ones are abandoned.
+func Sweep(grace time.Duration) (completed int, abandoned int, err error) {
+	if err := backfillDeadlines(); err != nil {
+		return 0, 0, err
+	}
+
+	var stale []models.Attempt
+	if err := database.DB.
+		Where("status = ? AND deadline < ?", models.StatusInProgress, time.Now().Add(-grace)).
+		Find(&stale).Error; err != nil {
+		return 0, 0, err
+	}
+
+	for i := range stale {
+		attempt := &stale[i]
+
+		if err := Close(database.DB, attempt); err != nil {
+			log.Printf("Sweeper: failed to close attempt %d: %v", attempt.ID, err)
+			continue
+		}
+		if attempt.Status == models.StatusCompleted {
+			completed++
+		} else {
+			abandoned++
+		}
+	}
+
+	return completed, abandoned, nil
+}
+
+// Close ends an in-progress attempt at its deadline: with saved answers it is
+// completed and scored, without any it is abandoned
+func Close(db *gorm.DB, attempt *models.Attempt) error {
+	var answerCount int64
+	if err := db.Model(&models.Answer{}).Where("attempt_id = ?", attempt.ID).Count(&answerCount).Error; err != nil {
+		return err
+	}
+
+	if answerCount == 0 {
+		attempt.Status = models.StatusAbandoned
+		attempt.EndTime = attempt.Deadline
+		return db.Save(attempt).Error
+	}
+	return Finalize(db, attempt, *attempt.Deadline)
+}
+
+// backfillDeadlines sets a deadline on in-progress attempts created before
+// deadlines were recorded, using their course's exam time.
+func backfillDeadlines() error {
+	var legacy []models.Attempt
+	if err := database.DB.
+		Where("status = ? AND deadline IS NULL", models.StatusInProgress).
+		Find(&legacy).Error; err != nil {
+		return err
+	}
+
+	examTimes := make(map[uint]int)
+	for i := range legacy {
+		attempt := &legacy[i]
+
+		examTime, ok := examTimes[attempt.CourseID]
+		if !ok {
+			var course models.Course
+			if err := database.DB.Unscoped().First(&course, attempt.CourseID).Error; err == nil {
+				examTime = course.ExamTime
+			}
+			examTimes[attempt.CourseID] = examTime
+		}
+
+		deadline := Deadline(attempt.StartTime, examTime)
+		if err := database.DB.Model(attempt).Update("deadline", deadline).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartSweeper runs Sweep every interval in a background goroutine
+func StartSweeper(interval, grace time.Duration) {
+	if interval <= 0 {
+		log.Println("Attempt sweeper disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			completed, abandoned, err := Sweep(grace)
+			if err != nil {
+				log.Printf("Sweeper: failed to close stale attempts: %v", err)
+				continue
+			}
+			if completed > 0 || abandoned > 0 {
+				log.Printf("Sweeper: auto-completed %d and abandoned %d stale attempts", completed, abandoned)
+			}
+		}
+	}()
+
+	log.Printf("Attempt sweeper running every %s", interval)
+}
@@ -0,0 +1,44 @@
+package attempts
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestRetakesUsed(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		student := models.User{Name: "Aiko", Email: "aiko@example.com", Password: "x", Role: models.RoleStudent}
+		db.Create(&student)
+		course := models.Course{Title: "N5 Grammar", StudentLimit: 50, ExamTime: 30}
+		db.Create(&course)
+		pkg := models.QuizPackage{CourseID: course.ID, Title: "Week 1"}
+		other := models.QuizPackage{CourseID: course.ID, Title: "Week 2"}
+		db.Create(&pkg)
+		db.Create(&other)
+
+		for _, a := range []struct {
+			pkg    models.QuizPackage
+			status models.AttemptStatus
+		}{
+			{pkg, models.StatusCompleted},
+			{pkg, models.StatusAbandoned},
+			{pkg, models.StatusInProgress},
+			{other, models.StatusCompleted},
+		} {
+			attempt := models.Attempt{StudentID: student.ID, CourseID: course.ID, QuizPackageID: a.pkg.ID, Status: a.status}
+			if err := db.Create(&attempt).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := RetakesUsed(db, student.ID, pkg.ID); got != 2 {
+			t.Errorf("RetakesUsed = %d, want 2 (completed and abandoned)", got)
+		}
+		if got := RetakesUsed(db, student.ID+1, pkg.ID); got != 0 {
+			t.Errorf("RetakesUsed for another student = %d, want 0", got)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+// Package audit records who changed what through the admin API. Every write
+// is logged by the audit middleware; handlers describe the record they
+// changed with Note so the entry carries its before and after state.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"mitsuki-jpy-quiz/internal/models"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	contextKey = "audit_change"
+	skipKey    = "audit_skip"
+)
+
+// Fields that change on every save and would only add noise to a diff
+var ignoredFields = map[string]bool{"updated_at": true}
+
+// Change describes the record a handler wrote
+type Change struct {
+	Action     string      // e.g. course.update
+	EntityType string      // e.g. course
+	EntityID   interface{} // ID of the record
+	Before     interface{} // The record before the write; nil when it was created
+	After      interface{} // The record after the write; nil when it was deleted
+}
+
+// Note describes the write a request made, for the audit middleware to record
+func Note(c *gin.Context, change Change) {
+	c.Set(contextKey, change)
+}
+
+// Skip leaves a request that turned out not to write anything, such as a
+// dry run, out of the log
+func Skip(c *gin.Context) {
+	c.Set(skipKey, true)
+}
+
+// Skipped reports whether the request was left out with Skip
+func Skipped(c *gin.Context) bool {
+	return c.GetBool(skipKey)
+}
+
+// FromRequest builds the log entry for a finished admin request. Requests
+// whose handler did not call Note are logged by their route.
+func FromRequest(c *gin.Context) models.AuditLog {
+	entry := models.AuditLog{
+		ActorEmail: c.GetString("user_email"),
+		ActorRole:  c.GetString("user_role"),
+		Method:     c.Request.Method,
+		Path:       truncate(c.Request.URL.Path, 255),
+		Status:     c.Writer.Status(),
+		IPAddress:  c.ClientIP(),
+		UserAgent:  truncate(c.Request.UserAgent(), 255),
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		if id, ok := userID.(uint); ok {
+			entry.ActorID = &id
+		}
+	}
+
+	if value, ok := c.Get(contextKey); ok {
+		change := value.(Change)
+		entry.Action = change.Action
+		entry.EntityType = change.EntityType
+		if change.EntityID != nil {
+			entry.EntityID = fmt.Sprint(change.EntityID)
+		}
+		entry.Before = snapshot(change.Before)
+		entry.After = snapshot(change.After)
+		entry.Changes = Diff(entry.Before, entry.After)
+		return entry
+	}
+
+	// e.g. "DELETE users/:id/sessions" on entity "users" with the :id value
+	route := strings.TrimPrefix(c.FullPath(), "/api/admin/")
+	entry.Action = truncate(c.Request.Method+" "+route, 100)
+	entry.EntityType = strings.SplitN(route, "/", 2)[0]
+	if len(c.Params) > 0 {
+		entry.EntityID = c.Params[0].Value
+	}
+	return entry
+}
+
+// Record saves a log entry
+func Record(db *gorm.DB, entry *models.AuditLog) error {
+	return db.Create(entry).Error
+}
+
+// Diff returns the fields that differ between two JSON objects as
+// {"field": {"from": x, "to": y}}, or "" when there is nothing to compare.
+// Nested objects are compared field by field, as "parent.field".
+func Diff(before, after string) string {
+	if before == "" || after == "" {
+		return ""
+	}
+	var from, to map[string]interface{}
+	if json.Unmarshal([]byte(before), &from) != nil || json.Unmarshal([]byte(after), &to) != nil {
+		return ""
+	}
+
+	changes := map[string]map[string]interface{}{}
+	diffObjects("", from, to, changes)
+	if len(changes) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(changes)
+	return string(data)
+}
+
+func diffObjects(prefix string, from, to map[string]interface{}, changes map[string]map[string]interface{}) {
+	fields := map[string]bool{}
+	for field := range from {
+		fields[field] = true
+	}
+	for field := range to {
+		fields[field] = true
+	}
+
+	for field := range fields {
+		if ignoredFields[field] {
+			continue
+		}
+		a, b := from[field], to[field]
+		nestedA, okA := a.(map[string]interface{})
+		nestedB, okB := b.(map[string]interface{})
+		if okA && okB {
+			diffObjects(prefix+field+".", nestedA, nestedB, changes)
+		} else if !reflect.DeepEqual(a, b) {
+			changes[prefix+field] = map[string]interface{}{"from": a, "to": b}
+		}
+	}
+}
+
+func snapshot(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
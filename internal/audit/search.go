@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"encoding/csv"
+	"io"
+	"mitsuki-jpy-quiz/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Filter narrows down the audit log. Zero fields match everything.
+type Filter struct {
+	ActorID    uint
+	Action     string // Exact action, or a prefix ending in "." such as "course."
+	EntityType string
+	EntityID   string
+	Query      string // Matched against actor email, action, path and the changes
+	From       *time.Time
+	To         *time.Time
+}
+
+// Apply adds the filter's conditions to a query on audit_logs
+func (f Filter) Apply(db *gorm.DB) *gorm.DB {
+	if f.ActorID != 0 {
+		db = db.Where("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		if f.Action[len(f.Action)-1] == '.' {
+			db = db.Where("action LIKE ?", f.Action+"%")
+		} else {
+			db = db.Where("action = ?", f.Action)
+		}
+	}
+	if f.EntityType != "" {
+		db = db.Where("entity_type = ?", f.EntityType)
+	}
+	if f.EntityID != "" {
+		db = db.Where("entity_id = ?", f.EntityID)
+	}
+	if f.Query != "" {
+		like := "%" + f.Query + "%"
+		db = db.Where("actor_email LIKE ? OR action LIKE ? OR path LIKE ? OR changes LIKE ?", like, like, like, like)
+	}
+	if f.From != nil {
+		db = db.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		db = db.Where("created_at < ?", *f.To)
+	}
+	return db
+}
+
+// Search returns one page of matching entries, newest first, and how many match in total
+func Search(db *gorm.DB, filter Filter, page, perPage int) ([]models.AuditLog, int64, error) {
+	var total int64
+	if err := filter.Apply(db.Model(&models.AuditLog{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	logs := []models.AuditLog{}
+	err := filter.Apply(db).
+		Order("id DESC").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&logs).Error
+	return logs, total, err
+}
+
+var csvHeader = []string{
+	"id", "created_at", "actor_id", "actor_email", "actor_role", "action",
+	"entity_type", "entity_id", "method", "path", "status", "ip_address",
+	"changes", "before", "after",
+}
+
+// WriteCSV writes every matching entry, newest first, reading them in batches
+func WriteCSV(w io.Writer, db *gorm.DB, filter Filter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	var lastID uint
+	for {
+		query := filter.Apply(db).Order("id DESC").Limit(500)
+		if lastID != 0 {
+			query = query.Where("id < ?", lastID)
+		}
+		var batch []models.AuditLog
+		if err := query.Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, entry := range batch {
+			if err := writer.Write(csvRow(&entry)); err != nil {
+				return err
+			}
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvRow(entry *models.AuditLog) []string {
+	actorID := ""
+	if entry.ActorID != nil {
+		actorID = strconv.FormatUint(uint64(*entry.ActorID), 10)
+	}
+	row := []string{
+		strconv.FormatUint(uint64(entry.ID), 10),
+		entry.CreatedAt.UTC().Format(time.RFC3339),
+		actorID,
+		entry.ActorEmail,
+		entry.ActorRole,
+		entry.Action,
+		entry.EntityType,
+		entry.EntityID,
+		entry.Method,
+		entry.Path,
+		strconv.Itoa(entry.Status),
+		entry.IPAddress,
+		entry.Changes,
+		entry.Before,
+		entry.After,
+	}
+	for i, cell := range row {
+		row[i] = defuseFormula(cell)
+	}
+	return row
+}
+
+// defuseFormula keeps spreadsheets from running a cell as a formula. Emails,
+// paths and changed values are chosen by users, so a cell starting with one of
+// = + - @ (or a tab or carriage return) is prefixed with an apostrophe.
+func defuseFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"testing"
+)
+
+func TestCSVRowDefusesFormulas(t *testing.T) {
+	entry := &models.AuditLog{
+		ActorEmail: "=HYPERLINK(\"http://example.com\")@x.com",
+		Action:     "course.update",
+		Path:       "+cmd",
+		Changes:    "-2+3",
+		Before:     "@SUM(A1)",
+		After:      "\tnote",
+		IPAddress:  "127.0.0.1",
+	}
+	row := csvRow(entry)
+	want := map[int]string{
+		3:  "'=HYPERLINK(\"http://example.com\")@x.com",
+		5:  "course.update",
+		9:  "'+cmd",
+		11: "127.0.0.1",
+		12: "'-2+3",
+		13: "'@SUM(A1)",
+		14: "'\tnote",
+	}
+	for i, cell := range want {
+		if row[i] != cell {
+			t.Errorf("%s = %q, want %q", csvHeader[i], row[i], cell)
+		}
+	}
+}
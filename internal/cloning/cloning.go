@@ -0,0 +1,245 @@
+// Package cloning deep-copies quiz packages and courses so existing material
+// can be reused for a new intake without re-typing every question.
+package cloning
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/questionversions"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Where question images are stored on disk and served from (see handlers.UploadImage)
+const (
+	imageDir       = "web/uploads/questions"
+	imageURLPrefix = "/uploads/questions/"
+)
+
+// Upload filenames start with a unix timestamp; copies get a fresh one
+var timestampPrefix = regexp.MustCompile(`^\d+_`)
+
+// Cloner copies packages and courses inside one transaction. Images are
+// duplicated on disk as it goes, so call Rollback if the transaction fails
+// to remove the copies again.
+type Cloner struct {
+	tx     *gorm.DB
+	copied []string // Image files written by this cloner
+}
+
+// New returns a Cloner that writes through tx
+func New(tx *gorm.DB) *Cloner {
+	return &Cloner{tx: tx}
+}
+
+// ClonePackage copies a quiz package and all its questions into courseID.
+// An empty title keeps the source title with " (Copy)" appended.
+func (cl *Cloner) ClonePackage(packageID, courseID uint, title string) (*models.QuizPackage, error) {
+	var source models.QuizPackage
+	if err := cl.tx.First(&source, packageID).Error; err != nil {
+		return nil, err
+	}
+
+	clone := source
+	clone.ID = 0
+	clone.CreatedAt, clone.UpdatedAt = time.Time{}, time.Time{}
+	clone.CourseID = courseID
+	clone.Course = models.Course{}
+	clone.Questions = nil
+	clone.Pools = nil
+	clone.Title = title
+	if clone.Title == "" {
+		clone.Title = source.Title + " (Copy)"
+	}
+	if err := cl.create(&clone, clone.IsActive); err != nil {
+		return nil, err
+	}
+
+	if err := cl.cloneQuestions(source.ID, clone.ID); err != nil {
+		return nil, err
+	}
+	if err := cl.clonePools(source.ID, clone.ID); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+// CloneCourse copies a course with every quiz package in it. Enrollments and
+// attempts are not copied. An empty title appends " (Copy)" to the source's.
+func (cl *Cloner) CloneCourse(courseID uint, title string) (*models.Course, error) {
+	var source models.Course
+	if err := cl.tx.First(&source, courseID).Error; err != nil {
+		return nil, err
+	}
+
+	clone := source
+	clone.ID = 0
+	clone.CreatedAt, clone.UpdatedAt = time.Time{}, time.Time{}
+	clone.QuizPackages = nil
+	clone.Enrollments = nil
+	clone.SeatsRemaining = nil
+	clone.Title = title
+	if clone.Title == "" {
+		clone.Title = source.Title + " (Copy)"
+	}
+	if err := cl.create(&clone, clone.IsActive); err != nil {
+		return nil, err
+	}
+
+	var packages []models.QuizPackage
+	if err := cl.tx.Where("course_id = ?", source.ID).Order("id ASC").Find(&packages).Error; err != nil {
+		return nil, err
+	}
+	for _, pkg := range packages {
+		// Packages keep their titles inside the new course
+		copied, err := cl.ClonePackage(pkg.ID, clone.ID, pkg.Title)
+		if err != nil {
+			return nil, fmt.Errorf("copy quiz package %d: %w", pkg.ID, err)
+		}
+		clone.QuizPackages = append(clone.QuizPackages, *copied)
+	}
+
+	return &clone, nil
+}
+
+// Rollback deletes the image files copied so far
+func (cl *Cloner) Rollback() {
+	for _, path := range cl.copied {
+		os.Remove(path)
+	}
+	cl.copied = nil
+}
+
+func (cl *Cloner) cloneQuestions(fromPackageID, toPackageID uint) error {
+	var questions []models.Question
+	if err := cl.tx.Where("quiz_package_id = ?", fromPackageID).
+		Order("order_number ASC, id ASC").
+		Find(&questions).Error; err != nil {
+		return err
+	}
+	if len(questions) == 0 {
+		return nil
+	}
+
+	// is_active defaults to true, so Create turns false into true
+	var inactive []int
+	for i := range questions {
+		q := &questions[i]
+		if !q.IsActive {
+			inactive = append(inactive, i)
+		}
+		q.ID = 0
+		q.CreatedAt, q.UpdatedAt = time.Time{}, time.Time{}
+		q.QuizPackageID = toPackageID
+
+		imageURL, err := cl.copyImage(q.ImageURL)
+		if err != nil {
+			return err
+		}
+		q.ImageURL = imageURL
+	}
+
+	if err := cl.tx.Omit(clause.Associations).Create(&questions).Error; err != nil {
+		return err
+	}
+	// Copies start their own history at version 1
+	for i := range questions {
+		questions[i].Version = 0
+		if err := questionversions.Record(cl.tx, &questions[i]); err != nil {
+			return err
+		}
+	}
+
+	if len(inactive) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(inactive))
+	for n, i := range inactive {
+		questions[i].IsActive = false
+		ids[n] = questions[i].ID
+	}
+	return cl.tx.Model(&models.Question{}).Where("id IN ?", ids).Update("is_active", false).Error
+}
+
+// clonePools copies a question bank package's pools. Pools select by tag and
+// difficulty, so they apply to the copied questions unchanged.
+func (cl *Cloner) clonePools(fromPackageID, toPackageID uint) error {
+	var pools []models.QuestionPool
+	if err := cl.tx.Where("quiz_package_id = ?", fromPackageID).Order("id ASC").Find(&pools).Error; err != nil {
+		return err
+	}
+	if len(pools) == 0 {
+		return nil
+	}
+
+	for i := range pools {
+		pools[i].ID = 0
+		pools[i].CreatedAt, pools[i].UpdatedAt = time.Time{}, time.Time{}
+		pools[i].QuizPackageID = toPackageID
+	}
+	return cl.tx.Create(&pools).Error
+}
+
+// create inserts a course or package and keeps it inactive if the source was.
+// isActive is passed separately because Create applies the column default.
+func (cl *Cloner) create(record interface{}, isActive bool) error {
+	if err := cl.tx.Omit(clause.Associations).Create(record).Error; err != nil {
+		return err
+	}
+	if !isActive {
+		return cl.tx.Model(record).Update("is_active", false).Error
+	}
+	return nil
+}
+
+// copyImage duplicates an uploaded question image and returns the copy's URL.
+// External URLs and images whose file is already gone are left unchanged.
+func (cl *Cloner) copyImage(imageURL string) (string, error) {
+	if !strings.HasPrefix(imageURL, imageURLPrefix) {
+		return imageURL, nil
+	}
+	name := filepath.Base(strings.TrimPrefix(imageURL, imageURLPrefix))
+
+	src, err := os.Open(filepath.Join(imageDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return imageURL, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("open image %s: %w", name, err)
+	}
+	defer src.Close()
+
+	base := timestampPrefix.ReplaceAllString(name, "")
+	var dst *os.File
+	var copyName string
+	for n := 0; ; n++ {
+		copyName = fmt.Sprintf("%d_%s", time.Now().Unix()+int64(n), base)
+		dst, err = os.OpenFile(filepath.Join(imageDir, copyName), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("copy image %s: %w", name, err)
+	}
+	path := dst.Name()
+	cl.copied = append(cl.copied, path)
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("copy image %s: %w", name, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("copy image %s: %w", name, err)
+	}
+
+	return imageURLPrefix + copyName, nil
+}
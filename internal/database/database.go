@@ -1,9 +1,12 @@
 package database
 
 import (
+	"fmt"
 	"log"
-	"mitsuki-jpy-quiz/internal/models"
+	"strings"
 
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -11,10 +14,34 @@ import (
 
 var DB *gorm.DB
 
-func Connect(databaseURL string) error {
-	var err error
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+// Dialector returns the GORM dialector for the given driver and DSN
+func Dialector(driver, dsn string) (gorm.Dialector, error) {
+	switch strings.ToLower(driver) {
+	case "", DriverSQLite, "sqlite3":
+		return sqlite.Open(dsn), nil
+	case DriverPostgres, "postgresql":
+		return postgres.Open(dsn), nil
+	case DriverMySQL:
+		return mysql.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q (use sqlite, postgres or mysql)", driver)
+	}
+}
+
+func Connect(driver, dsn string) error {
+	dialector, err := Dialector(driver, dsn)
+	if err != nil {
+		return err
+	}
 
-	DB, err = gorm.Open(sqlite.Open(databaseURL), &gorm.Config{
+	DB, err = gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 
@@ -22,25 +49,21 @@ func Connect(databaseURL string) error {
 		return err
 	}
 
-	log.Println("Database connection established")
+	log.Printf("Database connection established (%s)", DB.Dialector.Name())
 	return nil
 }
 
-func Migrate() error {
-	err := DB.AutoMigrate(
-		&models.User{},
-		&models.Course{},
-		&models.QuizPackage{},
-		&models.Question{},
-		&models.Attempt{},
-		&models.Answer{},
-		&models.Enrollment{},
-	)
+// GroupConcat returns the dialect-specific SQL that joins expr values of a
+// group into one string separated by separator.
+func GroupConcat(expr, separator string) string {
+	quoted := "'" + strings.ReplaceAll(separator, "'", "''") + "'"
 
-	if err != nil {
-		return err
+	switch DB.Dialector.Name() {
+	case DriverPostgres:
+		return fmt.Sprintf("STRING_AGG(%s, %s)", expr, quoted)
+	case DriverMySQL:
+		return fmt.Sprintf("GROUP_CONCAT(%s SEPARATOR %s)", expr, quoted)
+	default:
+		return fmt.Sprintf("GROUP_CONCAT(%s, %s)", expr, quoted)
 	}
-
-	log.Println("Database migration completed")
-	return nil
 }
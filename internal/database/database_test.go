@@ -0,0 +1,105 @@
+package database_test
+
+import (
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"sort"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDialector(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{"", database.DriverSQLite},
+		{"sqlite", database.DriverSQLite},
+		{"sqlite3", database.DriverSQLite},
+		{"SQLite", database.DriverSQLite},
+		{"postgres", database.DriverPostgres},
+		{"postgresql", database.DriverPostgres},
+		{"mysql", database.DriverMySQL},
+	}
+	for _, tt := range tests {
+		dialector, err := database.Dialector(tt.driver, "dsn")
+		if err != nil {
+			t.Errorf("Dialector(%q) error: %v", tt.driver, err)
+			continue
+		}
+		if got := dialector.Name(); got != tt.want {
+			t.Errorf("Dialector(%q) = %s, want %s", tt.driver, got, tt.want)
+		}
+	}
+
+	if _, err := database.Dialector("oracle", "dsn"); err == nil {
+		t.Error("Dialector(oracle) should fail")
+	}
+}
+
+func TestGroupConcatSQL(t *testing.T) {
+	tests := []struct {
+		dialector gorm.Dialector
+		want      string
+	}{
+		{sqlite.Open(""), "GROUP_CONCAT(c.title, ', ')"},
+		{postgres.Open(""), "STRING_AGG(c.title, ', ')"},
+		{mysql.Open(""), "GROUP_CONCAT(c.title SEPARATOR ', ')"},
+	}
+
+	previous := database.DB
+	defer func() { database.DB = previous }()
+	for _, tt := range tests {
+		database.DB = &gorm.DB{Config: &gorm.Config{Dialector: tt.dialector}}
+		if got := database.GroupConcat("c.title", ", "); got != tt.want {
+			t.Errorf("%s: GroupConcat = %s, want %s", tt.dialector.Name(), got, tt.want)
+		}
+	}
+
+	database.DB = &gorm.DB{Config: &gorm.Config{Dialector: sqlite.Open("")}}
+	if got, want := database.GroupConcat("name", "', '"), "GROUP_CONCAT(name, ''', ''')"; got != want {
+		t.Errorf("quotes in separator: got %s, want %s", got, want)
+	}
+}
+
+func TestGroupConcat(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		courses := []models.Course{{Title: "N5 Grammar"}, {Title: "Kanji Basics"}, {Title: "N4 Reading"}}
+		if err := db.Create(&courses).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		var rows []struct {
+			Active bool
+			Titles string
+		}
+		db.Model(&courses[2]).Update("is_active", false)
+		err := db.Table("courses").
+			Select("is_active AS active, " + database.GroupConcat("title", ", ") + " AS titles").
+			Group("is_active").
+			Order("is_active").
+			Scan(&rows).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rows) != 2 {
+			t.Fatalf("got %d groups, want 2: %+v", len(rows), rows)
+		}
+		// The order within a group is up to the database
+		titles := strings.Split(rows[1].Titles, ", ")
+		sort.Strings(titles)
+		if got := strings.Join(titles, "|"); got != "Kanji Basics|N5 Grammar" {
+			t.Errorf("active titles = %q", rows[1].Titles)
+		}
+		if rows[0].Titles != "N4 Reading" {
+			t.Errorf("inactive titles = %q, want N4 Reading", rows[0].Titles)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package enrollments
+
+import (
+	"errors"
+	"log"
+	"mitsuki-jpy-quiz/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrCourseFull is returned when approving would exceed the course's student limit
+var ErrCourseFull = errors.New("course has reached its student limit")
+
+// ApprovedCount returns how many active students are approved in the course
+func ApprovedCount(db *gorm.DB, courseID uint) int64 {
+	var count int64
+	db.Model(&models.Enrollment{}).
+		Joins("JOIN users ON users.id = enrollments.student_id AND users.deleted_at IS NULL").
+		Where("enrollments.course_id = ? AND enrollments.status = ?", courseID, models.EnrollmentApproved).
+		Count(&count)
+	return count
+}
+
+// SeatsRemaining returns the number of open seats in the course.
+// A non-positive StudentLimit means the course is unlimited and returns -1.
+func SeatsRemaining(db *gorm.DB, course *models.Course) int {
+	if course.StudentLimit <= 0 {
+		return -1
+	}
+
+	remaining := course.StudentLimit - int(ApprovedCount(db, course.ID))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// IsFull reports whether every seat in the course is taken
+func IsFull(db *gorm.DB, course *models.Course) bool {
+	return SeatsRemaining(db, course) == 0
+}
+
+// Approve marks the enrollment approved if the course still has a free seat
+func Approve(db *gorm.DB, enrollment *models.Enrollment) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var course models.Course
+		if err := tx.First(&course, enrollment.CourseID).Error; err != nil {
+			return err
+		}
+
+		if enrollment.Status != models.EnrollmentApproved && IsFull(tx, &course) {
+			return ErrCourseFull
+		}
+
+		enrollment.Status = models.EnrollmentApproved
+		return tx.Model(enrollment).Update("status", enrollment.Status).Error
+	})
+}
+
+// PromoteWaiting approves up to max of the oldest pending or waitlisted
+// enrollments, never exceeding the course's open seats. Callers use it when
+// seats free up in a course that was full.
+func PromoteWaiting(db *gorm.DB, courseID uint, max int) ([]models.Enrollment, error) {
+	if max <= 0 {
+		return nil, nil
+	}
+
+	var promoted []models.Enrollment
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var course models.Course
+		if err := tx.First(&course, courseID).Error; err != nil {
+			return err
+		}
+
+		// Unlimited courses have no seats to hand out
+		seats := SeatsRemaining(tx, &course)
+		if seats <= 0 {
+			return nil
+		}
+		if seats > max {
+			seats = max
+		}
+
+		query := tx.Joins("JOIN users ON users.id = enrollments.student_id AND users.deleted_at IS NULL").
+			Where("enrollments.course_id = ? AND enrollments.status IN ?", courseID,
+				[]models.EnrollmentStatus{models.EnrollmentPending, models.EnrollmentWaitlisted}).
+			Order("enrollments.created_at ASC").
+			Limit(seats)
+
+		var candidates []models.Enrollment
+		if err := query.Find(&candidates).Error; err != nil {
+			return err
+		}
+
+		for i := range candidates {
+			candidates[i].Status = models.EnrollmentApproved
+			if err := tx.Model(&candidates[i]).Update("status", candidates[i].Status).Error; err != nil {
+				return err
+			}
+		}
+		promoted = candidates
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, enrollment := range promoted {
+		log.Printf("Enrollment %d (student %d) promoted to approved in course %d",
+			enrollment.ID, enrollment.StudentID, courseID)
+	}
+	return promoted, nil
+}
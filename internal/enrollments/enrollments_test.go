@@ -0,0 +1,54 @@
+package enrollments
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"strconv"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestApprovedCount(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		course := &models.Course{Title: "N5 Grammar", StudentLimit: 3}
+		other := &models.Course{Title: "Kanji Basics", StudentLimit: 3}
+		db.Create(course)
+		db.Create(other)
+
+		var students []*models.User
+		for i := 0; i < 5; i++ {
+			student := &models.User{Name: "Student", Email: "s" + strconv.Itoa(i) + "@example.com", Password: "x", Role: models.RoleStudent}
+			if err := db.Create(student).Error; err != nil {
+				t.Fatal(err)
+			}
+			students = append(students, student)
+		}
+		statuses := []models.EnrollmentStatus{models.EnrollmentApproved, models.EnrollmentApproved, models.EnrollmentPending, models.EnrollmentDeclined, models.EnrollmentApproved}
+		for i, status := range statuses {
+			db.Create(&models.Enrollment{StudentID: students[i].ID, CourseID: course.ID, Status: status})
+		}
+		db.Create(&models.Enrollment{StudentID: students[2].ID, CourseID: other.ID, Status: models.EnrollmentApproved})
+
+		if got := ApprovedCount(db, course.ID); got != 3 {
+			t.Errorf("ApprovedCount = %d, want 3", got)
+		}
+		if !IsFull(db, course) {
+			t.Error("course with 3 of 3 seats taken should be full")
+		}
+
+		// A deleted student's seat is free again
+		db.Delete(students[4])
+		if got := ApprovedCount(db, course.ID); got != 2 {
+			t.Errorf("ApprovedCount after deleting a student = %d, want 2", got)
+		}
+		if got := SeatsRemaining(db, course); got != 1 {
+			t.Errorf("SeatsRemaining = %d, want 1", got)
+		}
+
+		course.StudentLimit = 0
+		if got := SeatsRemaining(db, course); got != -1 {
+			t.Errorf("SeatsRemaining of an unlimited course = %d, want -1", got)
+		}
+	})
+}
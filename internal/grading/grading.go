@@ -0,0 +1,243 @@
+package grading
+
+import (
+	"encoding/json"
+	"math"
+	"mitsuki-jpy-quiz/internal/models"
+	"strings"
+)
+
+// Grade checks a student's answer against the question's answer key and
+// returns whether it is fully correct along with the points earned.
+// Multiple select, ordering, matching and fill-in-the-blank questions earn
+// partial credit (see Credit), rounded down to whole points.
+//
+// Keys and answers that refer to options may use the option text or a
+// letter ("A" is the first stored option). Pass answers through Resolve
+// first if the options were shown shuffled.
+func Grade(question *models.Question, studentAnswer string) (bool, int) {
+	credit := Credit(question, studentAnswer)
+	if credit >= 1 {
+		return true, question.Points
+	}
+	return false, int(math.Floor(credit*float64(question.Points) + 1e-9))
+}
+
+// Credit returns the share of the question answered correctly, from 0 to 1.
+// Single-answer types are all or nothing; short answers and blanks are
+// compared under the question's AnswerRules. Partial credit rules:
+//   - multiple_select: (correct picks - wrong picks) / correct options, not below 0
+//   - ordering: items in the right position / items
+//   - matching: prompts paired correctly / prompts
+//   - fill_blank: gaps filled correctly / gaps
+func Credit(question *models.Question, studentAnswer string) float64 {
+	if strings.TrimSpace(studentAnswer) == "" {
+		return 0
+	}
+
+	switch question.QuestionType {
+	case models.TypeMultipleChoice:
+		options := question.OptionList()
+		key, keyOK := optionIndex(options, question.CorrectAnswer)
+		given, givenOK := optionIndex(options, studentAnswer)
+		if keyOK && givenOK {
+			return boolCredit(key == given)
+		}
+	case models.TypeMultipleSelect:
+		return multipleSelectCredit(question, studentAnswer)
+	case models.TypeOrdering:
+		return orderingCredit(question, studentAnswer)
+	case models.TypeMatching:
+		return matchingCredit(question, studentAnswer)
+	case models.TypeShortAnswer:
+		return shortAnswerCredit(question, studentAnswer)
+	case models.TypeFillBlank:
+		return fillBlankCredit(question, studentAnswer)
+	}
+
+	return boolCredit(normalize(studentAnswer) == normalize(question.CorrectAnswer))
+}
+
+// Resolve translates answers that refer to options by a letter of the
+// displayed order back to the canonical option text. optionOrder maps each
+// displayed position to an index into the stored options, as recorded for the
+// attempt; nil means the options were shown in stored order. Multiple select
+// and ordering answers come back as a JSON array of option texts. Answers
+// given as option text, and answers to other question types, are returned
+// unchanged.
+func Resolve(question *models.Question, studentAnswer string, optionOrder []int) string {
+	switch question.QuestionType {
+	case models.TypeMultipleChoice:
+		return resolveOne(question.OptionList(), studentAnswer, optionOrder)
+	case models.TypeMultipleSelect, models.TypeOrdering:
+		if strings.TrimSpace(studentAnswer) == "" {
+			return studentAnswer
+		}
+		options := question.OptionList()
+		items := parseList(studentAnswer)
+		for i := range items {
+			items[i] = resolveOne(options, items[i], optionOrder)
+		}
+		encoded, err := json.Marshal(items)
+		if err != nil {
+			return studentAnswer
+		}
+		return string(encoded)
+	}
+	return studentAnswer
+}
+
+// Translate maps an answer given as the text of options from shownOptions,
+// the list an attempt was served, onto the question's current options so
+// Grade compares it with the current key. An option still listed is matched
+// by its text; one whose text was edited since is matched by its stored
+// position. Answers to other question types are returned unchanged.
+func Translate(question *models.Question, shownOptions []string, studentAnswer string) string {
+	if !question.QuestionType.HasOptionList() || strings.TrimSpace(studentAnswer) == "" {
+		return studentAnswer
+	}
+	current := question.OptionList()
+	translate := func(answer string) string {
+		if _, ok := textIndex(current, answer); ok {
+			return answer
+		}
+		if i, ok := textIndex(shownOptions, answer); ok && i < len(current) {
+			return current[i]
+		}
+		return answer
+	}
+
+	if question.QuestionType == models.TypeMultipleChoice {
+		return translate(studentAnswer)
+	}
+	items := parseList(studentAnswer)
+	for i := range items {
+		items[i] = translate(items[i])
+	}
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return studentAnswer
+	}
+	return string(encoded)
+}
+
+// CorrectAnswer returns the answer key for display, with options referred to
+// by letter replaced by their text. Multiple select and ordering keys come
+// back as a JSON array; other keys are returned as stored.
+func CorrectAnswer(question *models.Question) string {
+	switch question.QuestionType {
+	case models.TypeMultipleChoice:
+		options := question.OptionList()
+		if i, ok := optionIndex(options, question.CorrectAnswer); ok {
+			return options[i]
+		}
+	case models.TypeMultipleSelect, models.TypeOrdering:
+		options := question.OptionList()
+		var texts []string
+		for _, i := range optionIndexes(options, question.CorrectAnswer) {
+			if i < 0 {
+				return question.CorrectAnswer
+			}
+			texts = append(texts, options[i])
+		}
+		if encoded, err := json.Marshal(texts); err == nil {
+			return string(encoded)
+		}
+	}
+	return question.CorrectAnswer
+}
+
+func boolCredit(correct bool) float64 {
+	if correct {
+		return 1
+	}
+	return 0
+}
+
+// normalize is the comparison form of typed answers
+func normalize(answer string) string {
+	return strings.TrimSpace(strings.ToLower(answer))
+}
+
+// resolveOne maps a single displayed letter back to its stored option
+func resolveOne(options []string, answer string, optionOrder []int) string {
+	if _, ok := textIndex(options, answer); ok {
+		return answer
+	}
+
+	position, ok := letterIndex(answer)
+	if !ok {
+		return answer
+	}
+	if optionOrder != nil {
+		if position >= len(optionOrder) {
+			return answer
+		}
+		position = optionOrder[position]
+	}
+	if position < 0 || position >= len(options) {
+		return answer
+	}
+	return options[position]
+}
+
+// optionIndex finds the stored option an answer refers to, by text first and
+// then by letter
+func optionIndex(options []string, answer string) (int, bool) {
+	if i, ok := textIndex(options, answer); ok {
+		return i, true
+	}
+	if i, ok := letterIndex(answer); ok && i < len(options) {
+		return i, true
+	}
+	return 0, false
+}
+
+func textIndex(options []string, answer string) (int, bool) {
+	answer = normalize(answer)
+	for i, option := range options {
+		if normalize(option) == answer {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// letterIndex turns "A".."Z" (either case) into 0..25
+func letterIndex(answer string) (int, bool) {
+	answer = strings.ToUpper(strings.TrimSpace(answer))
+	if len(answer) != 1 || answer[0] < 'A' || answer[0] > 'Z' {
+		return 0, false
+	}
+	return int(answer[0] - 'A'), true
+}
+
+// parseList reads a JSON array of strings, or failing that a comma-separated
+// list such as "A, C"
+func parseList(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	var items []string
+	if strings.HasPrefix(raw, "[") && json.Unmarshal([]byte(raw), &items) == nil {
+		return items
+	}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// optionIndexes resolves each listed answer to a stored option; entries that
+// name no option come back as -1
+func optionIndexes(options []string, raw string) []int {
+	items := parseList(raw)
+	indexes := make([]int, len(items))
+	for i, item := range items {
+		indexes[i] = -1
+		if index, ok := optionIndex(options, item); ok {
+			indexes[i] = index
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,63 @@
+package grading
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	shown := []string{"あ", "い", "う"}
+	tests := []struct {
+		name     string
+		qtype    models.QuestionType
+		options  string
+		answer   string
+		expected string
+	}{
+		{"unchanged options", models.TypeMultipleChoice, `["あ","い","う"]`, "い", "い"},
+		{"edited option by position", models.TypeMultipleChoice, `["え","い","う"]`, "あ", "え"},
+		{"reordered option by text", models.TypeMultipleChoice, `["う","い","あ"]`, "あ", "あ"},
+		{"removed option kept", models.TypeMultipleChoice, `["え"]`, "う", "う"},
+		{"text not among the options", models.TypeMultipleChoice, `["え","い","う"]`, "お", "お"},
+		{"multiple select", models.TypeMultipleSelect, `["え","い","お"]`, `["あ","い","う"]`, `["え","い","お"]`},
+		{"ordering", models.TypeOrdering, `["い","あ","え"]`, `["う","あ","い"]`, `["え","あ","い"]`},
+		{"blank answer", models.TypeMultipleChoice, `["え","い","う"]`, "", ""},
+		{"other question types", models.TypeShortAnswer, `["え","い","う"]`, "あ", "あ"},
+	}
+	for _, tt := range tests {
+		question := &models.Question{QuestionType: tt.qtype, Options: tt.options}
+		if got := Translate(question, shown, tt.answer); got != tt.expected {
+			t.Errorf("%s: Translate(%q) = %q, want %q", tt.name, tt.answer, got, tt.expected)
+		}
+	}
+}
+
+func TestRegexAnswerRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		pattern string
+		answer  string
+		correct bool
+	}{
+		{"katakana pattern, hiragana answer", `{"regex":true,"fold_kana":true}`, "タベ(ル|タ)", "たべた", true},
+		{"hiragana pattern, katakana answer", `{"regex":true,"fold_kana":true}`, "たべ(る|た)", "タベル", true},
+		{"katakana class", `{"regex":true,"fold_kana":true}`, "[アイ]る", "いる", true},
+		{"full-width pattern", `{"regex":true,"fold_width":true}`, "ＡＢＣ\\d+", "abc12", true},
+		{"half-width katakana pattern", `{"regex":true,"nfkc":true,"fold_kana":true}`, "ﾀﾍﾞﾙ", "たべる", true},
+		{"kana pattern, romaji answer", `{"regex":true,"romaji":true}`, "たべ(る|た)", "taberu", true},
+		{"without folding", `{"regex":true}`, "タベル", "たべる", false},
+		{"folded but different", `{"regex":true,"fold_kana":true}`, "タベ(ル|タ)", "のむ", false},
+	}
+	for _, tt := range tests {
+		question := &models.Question{
+			QuestionType:  models.TypeShortAnswer,
+			CorrectAnswer: tt.pattern,
+			AnswerRules:   tt.rules,
+			Points:        1,
+		}
+		if correct, _ := Grade(question, tt.answer); correct != tt.correct {
+			t.Errorf("%s: Grade(%q) against %q = %v, want %v", tt.name, tt.answer, tt.pattern, correct, tt.correct)
+		}
+	}
+}
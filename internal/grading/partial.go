@@ -0,0 +1,171 @@
+package grading
+
+import (
+	"encoding/json"
+	"mitsuki-jpy-quiz/internal/models"
+	"regexp"
+	"strings"
+)
+
+// A gap in fill-in-the-blank question text: three or more underscores
+var blankPattern = regexp.MustCompile(`_{3,}`)
+
+// Blanks counts the gaps in fill-in-the-blank question text
+func Blanks(questionText string) int {
+	return len(blankPattern.FindAllStringIndex(questionText, -1))
+}
+
+func multipleSelectCredit(question *models.Question, studentAnswer string) float64 {
+	options := question.OptionList()
+	key := make(map[int]bool)
+	for _, index := range optionIndexes(options, question.CorrectAnswer) {
+		if index >= 0 {
+			key[index] = true
+		}
+	}
+	if len(key) == 0 {
+		return 0
+	}
+
+	picked := make(map[int]bool)
+	hits, misses := 0, 0
+	for _, index := range optionIndexes(options, studentAnswer) {
+		if index >= 0 && picked[index] {
+			continue
+		}
+		picked[index] = true
+		if key[index] {
+			hits++
+		} else {
+			misses++
+		}
+	}
+
+	credit := float64(hits-misses) / float64(len(key))
+	if credit < 0 {
+		return 0
+	}
+	return credit
+}
+
+func orderingCredit(question *models.Question, studentAnswer string) float64 {
+	options := question.OptionList()
+	key := optionIndexes(options, question.CorrectAnswer)
+	if len(key) == 0 {
+		return 0
+	}
+
+	given := optionIndexes(options, studentAnswer)
+	inPlace := 0
+	for i := range key {
+		if i < len(given) && key[i] >= 0 && given[i] == key[i] {
+			inPlace++
+		}
+	}
+	return float64(inPlace) / float64(len(key))
+}
+
+func matchingCredit(question *models.Question, studentAnswer string) float64 {
+	key := parsePairs(question.CorrectAnswer)
+	if len(key) == 0 {
+		return 0
+	}
+
+	given := parsePairs(studentAnswer)
+	matched := 0
+	for prompt, choice := range key {
+		if answer, ok := given[prompt]; ok && answer == choice {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(key))
+}
+
+func fillBlankCredit(question *models.Question, studentAnswer string) float64 {
+	rules := question.Rules()
+	key := parseBlanks(question.CorrectAnswer, rules)
+	if len(key) == 0 {
+		return 0
+	}
+
+	given := parseGaps(studentAnswer, len(key))
+	filled := 0
+	for i, accepted := range key {
+		if i >= len(given) {
+			break
+		}
+		matcher, err := newTextMatcher(rules, accepted)
+		if err == nil && matcher.Match(given[i]) {
+			filled++
+		}
+	}
+	return float64(filled) / float64(len(key))
+}
+
+// parsePairs reads a matching key or answer: a JSON object from prompt to
+// choice. Both sides are normalized so comparisons ignore case and spacing.
+func parsePairs(raw string) map[string]string {
+	var pairs map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &pairs); err != nil {
+		return nil
+	}
+	normalized := make(map[string]string, len(pairs))
+	for prompt, choice := range pairs {
+		normalized[normalize(prompt)] = normalize(choice)
+	}
+	return normalized
+}
+
+// parseBlanks reads a fill-in-the-blank key: a JSON array with one entry per
+// gap, each either a string (alternatives separated by "|", unless it is a
+// regular expression) or an array of accepted answers
+func parseBlanks(raw string, rules models.AnswerRules) [][]string {
+	split := splitAlternatives
+	if rules.Regex {
+		split = func(pattern string) []string { return []string{pattern} }
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &entries); err != nil {
+		// A bare string is the key of a single gap
+		if raw = strings.TrimSpace(raw); raw == "" {
+			return nil
+		}
+		return [][]string{split(raw)}
+	}
+
+	blanks := make([][]string, len(entries))
+	for i, entry := range entries {
+		var accepted []string
+		var single string
+		if json.Unmarshal(entry, &accepted) == nil {
+			blanks[i] = accepted
+		} else if json.Unmarshal(entry, &single) == nil {
+			blanks[i] = split(single)
+		}
+	}
+	return blanks
+}
+
+// parseGaps reads a fill-in-the-blank answer: a JSON array of strings, or the
+// plain text of the only gap
+func parseGaps(raw string, gaps int) []string {
+	var answers []string
+	if trimmed := strings.TrimSpace(raw); strings.HasPrefix(trimmed, "[") && json.Unmarshal([]byte(trimmed), &answers) == nil {
+		return answers
+	}
+	if gaps == 1 {
+		return []string{raw}
+	}
+	return nil
+}
+
+func splitAlternatives(raw string) []string {
+	var alternatives []string
+	for _, alternative := range strings.Split(raw, "|") {
+		if alternative = strings.TrimSpace(alternative); alternative != "" {
+			alternatives = append(alternatives, alternative)
+		}
+	}
+	return alternatives
+}
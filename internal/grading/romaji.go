@@ -0,0 +1,112 @@
+package grading
+
+import "strings"
+
+// Romaji to hiragana, Hepburn and kunrei spellings. Longest match wins, so
+// "kya" is tried before "ky" and "k".
+var romajiTable = map[string]string{
+	"a": "あ", "i": "い", "u": "う", "e": "え", "o": "お",
+	"ka": "か", "ki": "き", "ku": "く", "ke": "け", "ko": "こ",
+	"ga": "が", "gi": "ぎ", "gu": "ぐ", "ge": "げ", "go": "ご",
+	"sa": "さ", "si": "し", "shi": "し", "su": "す", "se": "せ", "so": "そ",
+	"za": "ざ", "zi": "じ", "ji": "じ", "zu": "ず", "ze": "ぜ", "zo": "ぞ",
+	"ta": "た", "ti": "ち", "chi": "ち", "tu": "つ", "tsu": "つ", "te": "て", "to": "と",
+	"da": "だ", "di": "ぢ", "du": "づ", "de": "で", "do": "ど",
+	"na": "な", "ni": "に", "nu": "ぬ", "ne": "ね", "no": "の",
+	"ha": "は", "hi": "ひ", "hu": "ふ", "fu": "ふ", "he": "へ", "ho": "ほ",
+	"ba": "ば", "bi": "び", "bu": "ぶ", "be": "べ", "bo": "ぼ",
+	"pa": "ぱ", "pi": "ぴ", "pu": "ぷ", "pe": "ぺ", "po": "ぽ",
+	"ma": "ま", "mi": "み", "mu": "む", "me": "め", "mo": "も",
+	"ya": "や", "yu": "ゆ", "yo": "よ",
+	"ra": "ら", "ri": "り", "ru": "る", "re": "れ", "ro": "ろ",
+	"wa": "わ", "wi": "うぃ", "we": "うぇ", "wo": "を",
+	"n'": "ん",
+
+	"kya": "きゃ", "kyu": "きゅ", "kyo": "きょ",
+	"gya": "ぎゃ", "gyu": "ぎゅ", "gyo": "ぎょ",
+	"sha": "しゃ", "shu": "しゅ", "sho": "しょ", "she": "しぇ",
+	"sya": "しゃ", "syu": "しゅ", "syo": "しょ",
+	"ja": "じゃ", "ju": "じゅ", "jo": "じょ", "je": "じぇ",
+	"jya": "じゃ", "jyu": "じゅ", "jyo": "じょ",
+	"zya": "じゃ", "zyu": "じゅ", "zyo": "じょ",
+	"cha": "ちゃ", "chu": "ちゅ", "cho": "ちょ", "che": "ちぇ",
+	"tya": "ちゃ", "tyu": "ちゅ", "tyo": "ちょ",
+	"nya": "にゃ", "nyu": "にゅ", "nyo": "にょ",
+	"hya": "ひゃ", "hyu": "ひゅ", "hyo": "ひょ",
+	"bya": "びゃ", "byu": "びゅ", "byo": "びょ",
+	"pya": "ぴゃ", "pyu": "ぴゅ", "pyo": "ぴょ",
+	"mya": "みゃ", "myu": "みゅ", "myo": "みょ",
+	"rya": "りゃ", "ryu": "りゅ", "ryo": "りょ",
+	"fa": "ふぁ", "fi": "ふぃ", "fe": "ふぇ", "fo": "ふぉ",
+	"ti'": "てぃ", "thi": "てぃ", "dhi": "でぃ",
+
+	"xa": "ぁ", "xi": "ぃ", "xu": "ぅ", "xe": "ぇ", "xo": "ぉ",
+	"la": "ぁ", "li": "ぃ", "lu": "ぅ", "le": "ぇ", "lo": "ぉ",
+	"xya": "ゃ", "xyu": "ゅ", "xyo": "ょ", "lya": "ゃ", "lyu": "ゅ", "lyo": "ょ",
+	"xtu": "っ", "xtsu": "っ", "ltu": "っ", "ltsu": "っ",
+
+	"-": "ー",
+}
+
+// romajiToHiragana converts the romaji in text to hiragana and leaves
+// everything else (kana, kanji, digits) alone. Expects lowercase input.
+func romajiToHiragana(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		// A doubled consonant is a small tsu: "kitte" -> きって
+		if i+1 < len(text) && c == text[i+1] && isRomajiConsonant(c) && c != 'n' {
+			b.WriteString("っ")
+			i++
+			continue
+		}
+		// "tch" as in "matcha" -> まっちゃ
+		if strings.HasPrefix(text[i:], "tch") {
+			b.WriteString("っ")
+			i++
+			continue
+		}
+
+		// n not followed by a vowel or y is ん; "nn" before a consonant or at
+		// the end is one ん, while "onna" is お-ん-な
+		if c == 'n' && !startsSyllable(text[i+1:]) {
+			b.WriteString("ん")
+			if i+1 < len(text) && text[i+1] == 'n' && !startsSyllable(text[i+2:]) {
+				i++
+			}
+			i++
+			continue
+		}
+
+		matched := false
+		for size := 4; size >= 1; size-- {
+			if i+size > len(text) {
+				continue
+			}
+			if kana, ok := romajiTable[text[i:i+size]]; ok {
+				b.WriteString(kana)
+				i += size
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+// startsSyllable reports whether rest begins with a vowel or y, i.e. a
+// preceding n belongs to the next syllable
+func startsSyllable(rest string) bool {
+	return rest != "" && strings.ContainsRune("aeiouy'", rune(rest[0]))
+}
+
+func isRomajiConsonant(c byte) bool {
+	return c >= 'a' && c <= 'z' && !strings.ContainsRune("aeiou", rune(c))
+}
@@ -0,0 +1,184 @@
+package grading
+
+import (
+	"encoding/json"
+	"fmt"
+	"mitsuki-jpy-quiz/internal/models"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// textMatcher compares typed answers with a question's accepted answers
+// under its AnswerRules
+type textMatcher struct {
+	rules    models.AnswerRules
+	accepted []string         // Normalized accepted answers
+	patterns []*regexp.Regexp // Accepted answers in regex mode
+}
+
+// newTextMatcher prepares the accepted answers. In regex mode a pattern that
+// does not compile is returned as an error.
+func newTextMatcher(rules models.AnswerRules, accepted []string) (*textMatcher, error) {
+	m := &textMatcher{rules: rules}
+	for _, answer := range accepted {
+		if strings.TrimSpace(answer) == "" {
+			continue
+		}
+		if rules.Regex {
+			folded, err := foldPattern(strings.TrimSpace(answer), rules)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %v", answer, err)
+			}
+			pattern, err := regexp.Compile(`(?i)^(?:` + folded + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %v", answer, err)
+			}
+			m.patterns = append(m.patterns, pattern)
+			continue
+		}
+		m.accepted = append(m.accepted, normalizeText(answer, rules))
+	}
+	return m, nil
+}
+
+// Match reports whether the student's answer is one of the accepted answers
+func (m *textMatcher) Match(studentAnswer string) bool {
+	answer := normalizeText(studentAnswer, m.rules)
+	if answer == "" {
+		return false
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(answer) {
+			return true
+		}
+	}
+	for _, accepted := range m.accepted {
+		if answer == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeText applies the rules in a fixed order: NFKC, width folding,
+// lowercasing, romaji to hiragana, then katakana to hiragana
+func normalizeText(text string, rules models.AnswerRules) string {
+	return strings.TrimSpace(foldText(strings.TrimSpace(text), rules))
+}
+
+func foldText(text string, rules models.AnswerRules) string {
+	if rules.NFKC {
+		text = norm.NFKC.String(text)
+	}
+	if rules.FoldWidth {
+		text = width.Fold.String(text)
+	}
+	text = strings.ToLower(text)
+	if rules.Romaji {
+		text = romajiToHiragana(text)
+	}
+	if rules.FoldKana {
+		text = katakanaToHiragana(text)
+	}
+	return text
+}
+
+// maxFoldedRange bounds the character class ranges folded one character at a
+// time; wider ones, such as those of negated classes, are kept as they are
+const maxFoldedRange = 0x400
+
+// foldPattern applies the rules to the literal text of a regular expression,
+// so that it matches answers normalized under them. Character classes also
+// accept the folded form of their characters. Romaji is not applied, as it
+// spans several letters; with it on, patterns are written in kana.
+func foldPattern(pattern string, rules models.AnswerRules) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	rules.Romaji = false
+	foldRegexp(re, rules)
+	return re.String(), nil
+}
+
+func foldRegexp(re *syntax.Regexp, rules models.AnswerRules) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		re.Rune = []rune(foldText(string(re.Rune), rules))
+	case syntax.OpCharClass:
+		re.Rune = foldClass(re.Rune, rules)
+	}
+	for _, sub := range re.Sub {
+		foldRegexp(sub, rules)
+	}
+}
+
+// foldClass adds the folded form of each character to a class's ranges,
+// returned sorted and merged as regexp/syntax keeps them
+func foldClass(ranges []rune, rules models.AnswerRules) []rune {
+	type span struct{ lo, hi rune }
+	var spans []span
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		spans = append(spans, span{lo, hi})
+		if hi-lo > maxFoldedRange {
+			continue
+		}
+		for r := lo; r <= hi; r++ {
+			if folded := []rune(foldText(string(r), rules)); len(folded) == 1 && folded[0] != r {
+				spans = append(spans, span{folded[0], folded[0]})
+			}
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].lo < spans[j].lo })
+	merged := make([]rune, 0, 2*len(spans))
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.lo <= merged[n-1]+1 {
+			if s.hi > merged[n-1] {
+				merged[n-1] = s.hi
+			}
+			continue
+		}
+		merged = append(merged, s.lo, s.hi)
+	}
+	return merged
+}
+
+// katakanaToHiragana maps ァ..ヶ onto ぁ..ゖ; the long vowel mark ー is kept
+func katakanaToHiragana(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - 0x60
+		}
+		return r
+	}, text)
+}
+
+// acceptedAnswers splits a short answer key into its accepted answers: a JSON
+// array, or "|"-separated alternatives outside regex mode
+func acceptedAnswers(key string, rules models.AnswerRules) []string {
+	key = strings.TrimSpace(key)
+	var answers []string
+	if strings.HasPrefix(key, "[") && json.Unmarshal([]byte(key), &answers) == nil {
+		return answers
+	}
+	if rules.Regex {
+		return []string{key}
+	}
+	return splitAlternatives(key)
+}
+
+func shortAnswerCredit(question *models.Question, studentAnswer string) float64 {
+	rules := question.Rules()
+	matcher, err := newTextMatcher(rules, acceptedAnswers(question.CorrectAnswer, rules))
+	if err != nil {
+		return 0
+	}
+	return boolCredit(matcher.Match(studentAnswer))
+}
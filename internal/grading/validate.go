@@ -0,0 +1,175 @@
+package grading
+
+import (
+	"encoding/json"
+	"fmt"
+	"mitsuki-jpy-quiz/internal/models"
+	"strings"
+)
+
+// Validate checks that a question's options and answer key fit its type, so
+// it can be graded. The message is meant for the admin who wrote the question.
+func Validate(question *models.Question) error {
+	if !question.QuestionType.IsValid() {
+		names := make([]string, len(models.QuestionTypes))
+		for i, t := range models.QuestionTypes {
+			names[i] = string(t)
+		}
+		return fmt.Errorf("question_type must be one of %s", strings.Join(names, ", "))
+	}
+	key := strings.TrimSpace(question.CorrectAnswer)
+	if key == "" {
+		return fmt.Errorf("correct_answer is required")
+	}
+	var rules models.AnswerRules
+	if strings.TrimSpace(question.AnswerRules) != "" {
+		if err := json.Unmarshal([]byte(question.AnswerRules), &rules); err != nil {
+			return fmt.Errorf("answer_rules must be a JSON object like {\"nfkc\": true, \"fold_kana\": true}")
+		}
+	}
+
+	switch question.QuestionType {
+	case models.TypeMultipleChoice:
+		options, err := optionList(question)
+		if err != nil {
+			return err
+		}
+		if _, ok := optionIndex(options, key); !ok {
+			return fmt.Errorf("correct_answer %q does not match any option", key)
+		}
+
+	case models.TypeShortAnswer:
+		if _, err := newTextMatcher(rules, acceptedAnswers(key, rules)); err != nil {
+			return err
+		}
+
+	case models.TypeTrueFalse:
+		if normalize(key) != "true" && normalize(key) != "false" {
+			return fmt.Errorf("correct_answer must be true or false")
+		}
+
+	case models.TypeMultipleSelect:
+		options, err := optionList(question)
+		if err != nil {
+			return err
+		}
+		indexes, err := keyIndexes(options, key)
+		if err != nil {
+			return err
+		}
+		if len(indexes) == 0 {
+			return fmt.Errorf("correct_answer must list at least one option")
+		}
+
+	case models.TypeOrdering:
+		options, err := optionList(question)
+		if err != nil {
+			return err
+		}
+		indexes, err := keyIndexes(options, key)
+		if err != nil {
+			return err
+		}
+		for _, option := range options {
+			if strings.TrimSpace(option) == "" {
+				return fmt.Errorf("ordering options must not be blank")
+			}
+		}
+		if len(indexes) != len(options) {
+			return fmt.Errorf("correct_answer must list all %d options in order", len(options))
+		}
+
+	case models.TypeMatching:
+		var options models.MatchingOptions
+		if err := json.Unmarshal([]byte(question.Options), &options); err != nil {
+			return fmt.Errorf(`options must be {"prompts": [...], "choices": [...]}`)
+		}
+		if len(options.Prompts) == 0 || len(options.Choices) == 0 {
+			return fmt.Errorf("matching needs at least one prompt and one choice")
+		}
+		var pairs map[string]string
+		if err := json.Unmarshal([]byte(key), &pairs); err != nil {
+			return fmt.Errorf(`correct_answer must be a JSON object like {"prompt": "choice"}`)
+		}
+		choices := make(map[string]bool, len(options.Choices))
+		for _, choice := range options.Choices {
+			choices[normalize(choice)] = true
+		}
+		matched := parsePairs(key)
+		for _, prompt := range options.Prompts {
+			choice, ok := matched[normalize(prompt)]
+			if !ok {
+				return fmt.Errorf("correct_answer has no choice for prompt %q", prompt)
+			}
+			if !choices[choice] {
+				return fmt.Errorf("correct_answer for prompt %q is not one of the choices", prompt)
+			}
+		}
+		if len(pairs) != len(options.Prompts) {
+			return fmt.Errorf("correct_answer pairs must match the prompts one to one")
+		}
+
+	case models.TypeFillBlank:
+		gaps := Blanks(question.QuestionText)
+		if gaps == 0 {
+			return fmt.Errorf("question_text needs at least one ___ gap")
+		}
+		blanks := parseBlanks(key, rules)
+		if len(blanks) != gaps {
+			return fmt.Errorf("correct_answer has %d entries but question_text has %d gaps", len(blanks), gaps)
+		}
+		for i, accepted := range blanks {
+			if len(accepted) == 0 {
+				return fmt.Errorf("gap %d has no accepted answer", i+1)
+			}
+			if _, err := newTextMatcher(rules, accepted); err != nil {
+				return fmt.Errorf("gap %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// optionList decodes and checks the options of a list-based question.
+// Blank options (unused choice fields) are ignored.
+func optionList(question *models.Question) ([]string, error) {
+	var options []string
+	if err := json.Unmarshal([]byte(question.Options), &options); err != nil {
+		return nil, fmt.Errorf("options must be a JSON array of strings")
+	}
+	seen := make(map[string]bool, len(options))
+	filled := 0
+	for _, option := range options {
+		if strings.TrimSpace(option) == "" {
+			continue
+		}
+		if seen[normalize(option)] {
+			return nil, fmt.Errorf("option %q is listed twice", option)
+		}
+		seen[normalize(option)] = true
+		filled++
+	}
+	if filled < 2 {
+		return nil, fmt.Errorf("%s needs at least 2 options", question.QuestionType)
+	}
+	return options, nil
+}
+
+// keyIndexes resolves a list answer key, rejecting unknown and repeated options
+func keyIndexes(options []string, key string) ([]int, error) {
+	items := parseList(key)
+	seen := make(map[int]bool, len(items))
+	indexes := make([]int, 0, len(items))
+	for _, item := range items {
+		index, ok := optionIndex(options, item)
+		if !ok {
+			return nil, fmt.Errorf("correct_answer %q does not match any option", item)
+		}
+		if seen[index] {
+			return nil, fmt.Errorf("correct_answer lists %q twice", options[index])
+		}
+		seen[index] = true
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
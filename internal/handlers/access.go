@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// currentUser returns the signed-in user's ID and role, as set by AuthMiddleware
+func currentUser(c *gin.Context) (uint, models.UserRole) {
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(uint)
+	return id, models.UserRole(c.GetString("user_role"))
+}
+
+// authorize checks that the signed-in staff member has the permission on the
+// course. Otherwise it responds and returns false.
+func authorize(c *gin.Context, courseID uint, permission access.Permission) bool {
+	userID, role := currentUser(c)
+	allowed, err := access.Can(database.DB, userID, role, courseID, permission)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission for this course"})
+		return false
+	}
+	return true
+}
+
+// authorizeVia finds the course of a record with lookup and checks the
+// permission on it. A missing record gets a 404 with the notFound message.
+func authorizeVia(c *gin.Context, lookup func(*gorm.DB, uint) (uint, error), id uint, permission access.Permission, notFound string) bool {
+	courseID, err := lookup(database.DB, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	return authorize(c, courseID, permission)
+}
+
+// staffCourses limits a query on a table with a course_id column to the
+// signed-in staff member's courses
+func staffCourses(c *gin.Context, db *gorm.DB, column string) (*gorm.DB, bool) {
+	userID, role := currentUser(c)
+	scoped, err := access.Scope(db, userID, role, column)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return nil, false
+	}
+	return scoped, true
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct{}
+
+func NewAuditHandler() *AuditHandler {
+	return &AuditHandler{}
+}
+
+// Most entries a page of the audit log returns
+const maxAuditPageSize = 200
+
+// auditFilter reads the audit log filters from the query string
+func auditFilter(c *gin.Context) (audit.Filter, bool) {
+	filter := audit.Filter{
+		Action:     strings.TrimSpace(c.Query("action")),
+		EntityType: strings.TrimSpace(c.Query("entity_type")),
+		EntityID:   strings.TrimSpace(c.Query("entity_id")),
+		Query:      strings.TrimSpace(c.Query("q")),
+	}
+
+	if actor := c.Query("actor_id"); actor != "" {
+		id, err := strconv.ParseUint(actor, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor_id"})
+			return filter, false
+		}
+		filter.ActorID = uint(id)
+	}
+
+	// Dates are YYYY-MM-DD (the whole day) or RFC 3339 timestamps
+	for param, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			day, dayErr := time.Parse("2006-01-02", value)
+			if dayErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " date; use YYYY-MM-DD or RFC 3339"})
+				return filter, false
+			}
+			at = day
+			if param == "to" {
+				at = day.AddDate(0, 0, 1)
+			}
+		}
+		*target = &at
+	}
+
+	return filter, true
+}
+
+// ListAuditLogs returns a page of the audit log, newest first (Admin only).
+// Filters: actor_id, action (or a prefix such as "course."), entity_type,
+// entity_id, q (free text), from and to.
+func (h *AuditHandler) ListAuditLogs(c *gin.Context) {
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "50"))
+	if perPage < 1 {
+		perPage = 50
+	}
+	if perPage > maxAuditPageSize {
+		perPage = maxAuditPageSize
+	}
+
+	logs, total, err := audit.Search(database.DB, filter, page, perPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":       logs,
+		"total":       total,
+		"page":        page,
+		"per_page":    perPage,
+		"total_pages": (total + int64(perPage) - 1) / int64(perPage),
+	})
+}
+
+// ExportAuditLogs downloads every entry matching the same filters as CSV (Admin only)
+func (h *AuditHandler) ExportAuditLogs(c *gin.Context) {
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("\xef\xbb\xbf") // BOM so Excel opens Japanese text as UTF-8
+	if err := audit.WriteCSV(&buf, database.DB, filter); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export audit log"})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-log-%s.csv", time.Now().Format("2006-01-02"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"mitsuki-jpy-quiz/config"
+	"mitsuki-jpy-quiz/internal/attempts"
 	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/enrollments"
 	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/otp"
+	"mitsuki-jpy-quiz/internal/sessions"
+	"mitsuki-jpy-quiz/internal/throttle"
 	"mitsuki-jpy-quiz/pkg/utils"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,11 +22,116 @@ import (
 )
 
 type AuthHandler struct {
-	Config *config.Config
+	Config     *config.Config
+	OTPSenders map[otp.Channel]otp.Sender // Configured passcode channels
+	limits
 }
 
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	return &AuthHandler{Config: cfg}
+func NewAuthHandler(cfg *config.Config, senders map[otp.Channel]otp.Sender, limiter *throttle.Limiter) *AuthHandler {
+	return &AuthHandler{Config: cfg, OTPSenders: senders, limits: limits{Limiter: limiter}}
+}
+
+// limits gives handlers that check passwords and codes the failure counters
+type limits struct {
+	Limiter *throttle.Limiter // Slows down and locks out repeated failures
+}
+
+// loginPolicy limits password and code guesses by staff and students
+func loginPolicy(cfg *config.Config) throttle.Policy {
+	return throttle.Policy{
+		MaxFailures:   cfg.LoginMaxFailures,
+		IPMaxFailures: cfg.LoginIPMaxFailures,
+		Window:        time.Duration(cfg.LoginWindowMinutes) * time.Minute,
+		Lockout:       time.Duration(cfg.LoginLockoutMinutes) * time.Minute,
+		BaseDelay:     time.Duration(cfg.LoginDelaySeconds) * time.Second,
+		MaxDelay:      time.Duration(cfg.LoginMaxDelaySeconds) * time.Second,
+	}
+}
+
+// lookupPolicy limits how many unregistered phone numbers and emails one IP
+// address can try on the quiz page
+func (h *AuthHandler) lookupPolicy() throttle.Policy {
+	return throttle.Policy{
+		IPMaxFailures: h.Config.QuizLookupMaxFailures,
+		Window:        time.Duration(h.Config.LoginWindowMinutes) * time.Minute,
+		Lockout:       time.Duration(h.Config.LoginLockoutMinutes) * time.Minute,
+	}
+}
+
+// throttled responds with 429 and returns true while the identifier or the
+// client's IP address has to wait. Store errors let the request through.
+func (l limits) throttled(c *gin.Context, policy throttle.Policy, scope, identifier string) bool {
+	err := l.Limiter.Check(policy, scope, c.ClientIP(), identifier)
+	var blocked *throttle.BlockedError
+	if errors.As(err, &blocked) {
+		retryAfter := int(blocked.RetryAfter.Seconds() + 0.5)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": blocked.Error(), "retry_after": retryAfter, "locked": blocked.Locked})
+		return true
+	}
+	if err != nil {
+		log.Printf("Failed to check login limits: %v", err)
+	}
+	return false
+}
+
+// failed counts a failure against the identifier and the client's IP address
+// and records any lockout it starts
+func (l limits) failed(c *gin.Context, policy throttle.Policy, scope, identifier string) {
+	lockouts, err := l.Limiter.Fail(policy, scope, c.ClientIP(), identifier)
+	if err != nil {
+		log.Printf("Failed to count failed %s login: %v", scope, err)
+		return
+	}
+	for _, lockout := range lockouts {
+		target := "IP address " + lockout.IPAddress
+		if lockout.Identifier != "" {
+			target = fmt.Sprintf("%q", lockout.Identifier)
+		}
+		log.Printf("Locked out %s for %s sign-ins until %s", target, scope, lockout.LockedUntil.Format(time.RFC3339))
+	}
+	if err := throttle.Record(database.DB, lockouts); err != nil {
+		log.Printf("Failed to record lockout: %v", err)
+	}
+}
+
+// succeeded clears the identifier's failures
+func (l limits) succeeded(scope, identifier string) {
+	if err := l.Limiter.Succeed(scope, identifier); err != nil {
+		log.Printf("Failed to reset login limits: %v", err)
+	}
+}
+
+// startSession opens a login session for the user and responds with its tokens
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User, status int) {
+	tokens, err := sessions.Start(database.DB, h.Config, user, sessionClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(status, sessionResponse(tokens, user))
+}
+
+func sessionClient(c *gin.Context) sessions.Client {
+	return sessions.Client{UserAgent: c.Request.UserAgent(), IPAddress: c.ClientIP()}
+}
+
+func sessionResponse(tokens *sessions.Tokens, user *models.User) gin.H {
+	return gin.H{
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"user": gin.H{
+			"id":    user.ID,
+			"email": user.Email,
+			"name":  user.Name,
+			"role":  user.Role,
+		},
+	}
 }
 
 type LoginRequest struct {
@@ -32,7 +145,8 @@ type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 }
 
-// Admin Login
+// Admin Login (admins, teachers and assistants). With two-factor
+// authentication on, a correct password only returns a pending token.
 func (h *AuthHandler) AdminLogin(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -40,32 +154,29 @@ func (h *AuthHandler) AdminLogin(c *gin.Context) {
 		return
 	}
 
+	policy := loginPolicy(h.Config)
+	if h.throttled(c, policy, throttle.ScopeAdmin, req.Email) {
+		return
+	}
+
 	var user models.User
-	if err := database.DB.Where("email = ? AND role = ?", req.Email, models.RoleAdmin).First(&user).Error; err != nil {
+	if err := database.DB.Where("email = ? AND role IN ?", req.Email, []models.UserRole{models.RoleAdmin, models.RoleTeacher, models.RoleAssistant}).First(&user).Error; err != nil {
+		h.failed(c, policy, throttle.ScopeAdmin, req.Email)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		h.failed(c, policy, throttle.ScopeAdmin, req.Email)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Email, string(user.Role), h.Config.JWTSecret, h.Config.JWTExpireHours)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+	h.succeeded(throttle.ScopeAdmin, req.Email)
+	if h.secondFactor(c, &user) {
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":    user.ID,
-			"email": user.Email,
-			"name":  user.Name,
-			"role":  user.Role,
-		},
-	})
+	h.startSession(c, &user, http.StatusOK)
 }
 
 // Student Login
@@ -76,32 +187,26 @@ func (h *AuthHandler) StudentLogin(c *gin.Context) {
 		return
 	}
 
+	policy := loginPolicy(h.Config)
+	if h.throttled(c, policy, throttle.ScopeStudent, req.Email) {
+		return
+	}
+
 	var user models.User
 	if err := database.DB.Where("email = ? AND role = ?", req.Email, models.RoleStudent).First(&user).Error; err != nil {
+		h.failed(c, policy, throttle.ScopeStudent, req.Email)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		h.failed(c, policy, throttle.ScopeStudent, req.Email)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Email, string(user.Role), h.Config.JWTSecret, h.Config.JWTExpireHours)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":    user.ID,
-			"email": user.Email,
-			"name":  user.Name,
-			"role":  user.Role,
-		},
-	})
+	h.succeeded(throttle.ScopeStudent, req.Email)
+	h.startSession(c, &user, http.StatusOK)
 }
 
 // Student Register
@@ -138,21 +243,7 @@ func (h *AuthHandler) StudentRegister(c *gin.Context) {
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Email, string(user.Role), h.Config.JWTSecret, h.Config.JWTExpireHours)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":    user.ID,
-			"email": user.Email,
-			"name":  user.Name,
-			"role":  user.Role,
-		},
-	})
+	h.startSession(c, &user, http.StatusCreated)
 }
 
 // CourseRegistrationRequest for public course registration
@@ -165,6 +256,17 @@ type CourseRegistrationRequest struct {
 	PostalCode  string `json:"postal_code"`  // Optional
 	FacebookURL string `json:"facebook_url"` // Optional
 	Password    string `json:"password"`     // Optional - will be auto-generated if not provided
+
+	TelegramChatID string `json:"telegram_chat_id"` // Optional - for quiz passcodes over Telegram
+}
+
+// initialEnrollment returns the status and message for a new registration.
+// Once every seat is taken, new registrations go on the waitlist.
+func initialEnrollment(course *models.Course) (models.EnrollmentStatus, string) {
+	if enrollments.IsFull(database.DB, course) {
+		return models.EnrollmentWaitlisted, "This course is currently full. You have been added to the waitlist and will be approved automatically when a seat opens."
+	}
+	return models.EnrollmentPending, "Registration submitted successfully! Waiting for admin approval."
 }
 
 // RegisterForCourse - Public endpoint for course registration
@@ -193,16 +295,17 @@ func (h *AuthHandler) RegisterForCourse(c *gin.Context) {
 			if err := database.DB.Where("student_id = ? AND course_id = ?", existingUserByPhone.ID, courseID).First(&existingEnrollment).Error; err == nil {
 				// Check if declined - allow re-registration by updating existing enrollment
 				if existingEnrollment.Status == models.EnrollmentDeclined {
-					// Update declined enrollment to pending
-					existingEnrollment.Status = models.EnrollmentPending
+					// Update declined enrollment to pending (or waitlisted if full)
+					status, message := initialEnrollment(&course)
+					existingEnrollment.Status = status
 					if err := database.DB.Save(&existingEnrollment).Error; err != nil {
 						c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update registration"})
 						return
 					}
 
 					c.JSON(http.StatusCreated, gin.H{
-						"message": "Registration submitted successfully! Waiting for admin approval.",
-						"status":  "pending",
+						"message": message,
+						"status":  status,
 					})
 					return
 				}
@@ -217,10 +320,11 @@ func (h *AuthHandler) RegisterForCourse(c *gin.Context) {
 			}
 
 			// User exists but not enrolled, create enrollment
+			status, message := initialEnrollment(&course)
 			enrollment := models.Enrollment{
 				StudentID: existingUserByPhone.ID,
 				CourseID:  course.ID,
-				Status:    models.EnrollmentPending,
+				Status:    status,
 			}
 
 			if err := database.DB.Create(&enrollment).Error; err != nil {
@@ -229,8 +333,8 @@ func (h *AuthHandler) RegisterForCourse(c *gin.Context) {
 			}
 
 			c.JSON(http.StatusCreated, gin.H{
-				"message":            "Registration submitted successfully! Waiting for admin approval.",
-				"status":             "pending",
+				"message":            message,
+				"status":             status,
 				"already_registered": true,
 			})
 			return
@@ -271,6 +375,8 @@ func (h *AuthHandler) RegisterForCourse(c *gin.Context) {
 		PostalCode:  req.PostalCode,
 		FacebookURL: req.FacebookURL,
 		Role:        models.RoleStudent,
+
+		TelegramChatID: req.TelegramChatID,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -278,11 +384,12 @@ func (h *AuthHandler) RegisterForCourse(c *gin.Context) {
 		return
 	}
 
-	// Create enrollment with pending status
+	// Create enrollment with pending status (or waitlisted if full)
+	status, message := initialEnrollment(&course)
 	enrollment := models.Enrollment{
 		StudentID: user.ID,
 		CourseID:  course.ID,
-		Status:    models.EnrollmentPending,
+		Status:    status,
 	}
 
 	if err := database.DB.Create(&enrollment).Error; err != nil {
@@ -291,8 +398,8 @@ func (h *AuthHandler) RegisterForCourse(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Registration submitted successfully! Waiting for admin approval.",
-		"status":  "pending",
+		"message": message,
+		"status":  status,
 		"user": gin.H{
 			"id":    user.ID,
 			"name":  user.Name,
@@ -357,7 +464,9 @@ func (h *AuthHandler) CheckRegistrationStatus(c *gin.Context) {
 	})
 }
 
-// CheckPhoneNumberForQuiz - Verify if phone number OR email is approved to take quiz for a specific course
+// CheckPhoneNumberForQuiz - Verify if phone number OR email is approved to take quiz for a specific course.
+// It only looks the student up; the quiz token is issued once they enter the
+// one-time passcode (see RequestQuizOTP and VerifyQuizOTP).
 func (h *AuthHandler) CheckPhoneNumberForQuiz(c *gin.Context) {
 	courseID := c.Query("course_id")
 	identifier := c.Query("phone_number") // This can be phone number OR email
@@ -373,47 +482,58 @@ func (h *AuthHandler) CheckPhoneNumberForQuiz(c *gin.Context) {
 		return
 	}
 
+	if h.throttled(c, h.lookupPolicy(), throttle.ScopeQuiz, "") {
+		return
+	}
+
+	response, user, quizPackage := quizEligibility(identifier, courseID, quizPackageID)
+	if user == nil {
+		h.failed(c, h.lookupPolicy(), throttle.ScopeQuiz, "")
+	}
+	if quizPackage != nil {
+		response["otp_required"] = true
+		response["otp_channels"] = h.otpChannels(user)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// quizEligibility looks the student up by phone number or email and checks
+// their enrollment and retake limit. The response is what check-phone returns.
+// The user is returned when found; the quiz package only when the student is
+// approved to take it.
+func quizEligibility(identifier, courseID, quizPackageID string) (gin.H, *models.User, *models.QuizPackage) {
 	// Find user by phone number OR email (check both fields)
 	var user models.User
 	if err := database.DB.Where("phone_number = ? OR email = ?", identifier, identifier).First(&user).Error; err != nil {
 		// Neither phone number nor email found
-		c.JSON(http.StatusOK, gin.H{
+		return gin.H{
 			"approved": false,
 			"message":  "This phone number or email is not registered. Please register first.",
-		})
-		return
+		}, nil, nil
 	}
 
 	// Check if enrolled in this course
 	var enrollment models.Enrollment
 	if err := database.DB.Where("student_id = ? AND course_id = ?", user.ID, courseID).First(&enrollment).Error; err != nil {
 		// User exists but not enrolled in this course
-		c.JSON(http.StatusOK, gin.H{
+		return gin.H{
 			"approved": false,
 			"message":  "You are not registered for this course. Please register first.",
-		})
-		return
+		}, &user, nil
 	}
 
 	// Check if enrollment is approved
 	if enrollment.Status != models.EnrollmentApproved {
-		if enrollment.Status == models.EnrollmentPending {
-			c.JSON(http.StatusOK, gin.H{
-				"approved": false,
-				"message":  "Your registration is pending approval. Please wait for admin confirmation.",
-			})
-		} else if enrollment.Status == models.EnrollmentDeclined {
-			c.JSON(http.StatusOK, gin.H{
-				"approved": false,
-				"message":  "Your registration was declined. Please contact the administrator.",
-			})
-		} else {
-			c.JSON(http.StatusOK, gin.H{
-				"approved": false,
-				"message":  "Your registration is not approved yet.",
-			})
+		message := "Your registration is not approved yet."
+		switch enrollment.Status {
+		case models.EnrollmentPending:
+			message = "Your registration is pending approval. Please wait for admin confirmation."
+		case models.EnrollmentWaitlisted:
+			message = "This course is full and you are on the waitlist. You will be approved when a seat opens."
+		case models.EnrollmentDeclined:
+			message = "Your registration was declined. Please contact the administrator."
 		}
-		return
+		return gin.H{"approved": false, "message": message}, &user, nil
 	}
 
 	// Check retake limit if quiz package ID is provided
@@ -424,41 +544,58 @@ func (h *AuthHandler) CheckPhoneNumberForQuiz(c *gin.Context) {
 		"message":      "You are approved to take this quiz.",
 	}
 
-	if quizPackageID != "" {
-		// Get quiz package to check max retake count
-		var quizPackage models.QuizPackage
-		if err := database.DB.First(&quizPackage, quizPackageID).Error; err == nil {
-			// Count previous attempts for this student and quiz package
-			var attemptCount int64
-			database.DB.Model(&models.Attempt{}).Where(
-				"student_id = ? AND course_id = ? AND quiz_package_id = ?",
-				user.ID, courseID, quizPackageID,
-			).Count(&attemptCount)
-
-			maxRetakes := quizPackage.MaxRetakeCount
-			if maxRetakes == 0 {
-				maxRetakes = 1 // Default fallback
-			}
+	if quizPackageID == "" {
+		return response, &user, nil
+	}
 
-			// Add retake information to response
-			response["retake_info"] = gin.H{
-				"current_attempts":   int(attemptCount),
-				"max_retakes":        maxRetakes,
-				"attempts_remaining": maxRetakes - int(attemptCount),
-				"quiz_package_name":  quizPackage.Title,
-			}
+	// Get quiz package to check max retake count
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, quizPackageID).Error; err != nil {
+		return response, &user, nil
+	}
 
-			// Check if retake limit exceeded
-			if int(attemptCount) >= maxRetakes {
-				response["approved"] = false
-				response["retake_limit_reached"] = true
-				response["message"] = "You have reached the maximum number of retakes for this quiz."
-			} else if int(attemptCount) > 0 {
-				remaining := maxRetakes - int(attemptCount)
-				response["message"] = fmt.Sprintf("You have %d attempt(s) remaining for this quiz.", remaining)
-			}
-		}
+	// A running attempt is not counted so the student can resume it
+	attemptCount := attempts.RetakesUsed(database.DB, user.ID, quizPackage.ID)
+
+	maxRetakes := quizPackage.MaxRetakeCount
+	if maxRetakes == 0 {
+		maxRetakes = 1 // Default fallback
 	}
 
-	c.JSON(http.StatusOK, response)
+	// Add retake information to response
+	response["retake_info"] = gin.H{
+		"current_attempts":   attemptCount,
+		"max_retakes":        maxRetakes,
+		"attempts_remaining": maxRetakes - attemptCount,
+		"quiz_package_name":  quizPackage.Title,
+	}
+
+	// Check if retake limit exceeded
+	if attemptCount >= maxRetakes {
+		response["approved"] = false
+		response["retake_limit_reached"] = true
+		response["message"] = "You have reached the maximum number of retakes for this quiz."
+		return response, &user, nil
+	} else if attemptCount > 0 {
+		remaining := maxRetakes - attemptCount
+		response["message"] = fmt.Sprintf("You have %d attempt(s) remaining for this quiz.", remaining)
+	}
+
+	if quizPackage.CourseID != enrollment.CourseID {
+		return response, &user, nil
+	}
+	return response, &user, &quizPackage
+}
+
+// quizToken signs the token a phone-verified student takes one attempt of the
+// quiz package with. It lasts long enough to start the quiz and use the whole
+// exam time, plus the grace period.
+func (h *AuthHandler) quizToken(user *models.User, quizPackage *models.QuizPackage) (string, *utils.QuizClaims, error) {
+	var course models.Course
+	if err := database.DB.First(&course, quizPackage.CourseID).Error; err != nil {
+		return "", nil, err
+	}
+	lifetime := time.Duration(h.Config.QuizTokenMinutes+course.ExamTime)*time.Minute +
+		time.Duration(h.Config.ExamGraceSeconds)*time.Second
+	return utils.GenerateQuizToken(user.ID, course.ID, quizPackage.ID, h.Config.JWTSecret, lifetime)
 }
@@ -1,99 +1,229 @@
 package handlers
 
 import (
+	"log"
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/cloning"
 	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/enrollments"
 	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/trash"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CourseHandler struct{}
 
+// withSeatsRemaining fills in the open seat count for each course
+func withSeatsRemaining(courses ...*models.Course) {
+	for _, course := range courses {
+		seats := enrollments.SeatsRemaining(database.DB, course)
+		course.SeatsRemaining = &seats
+	}
+}
+
 func NewCourseHandler() *CourseHandler {
 	return &CourseHandler{}
 }
 
-// Create Course (Admin only)
+// canCreateCourses reports whether the signed-in staff member may start new
+// courses, and responds with 403 if not
+func canCreateCourses(c *gin.Context) bool {
+	if _, role := currentUser(c); role != models.RoleAdmin && role != models.RoleTeacher {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins and teachers can create courses"})
+		return false
+	}
+	return true
+}
+
+// addOwner makes the signed-in staff member the owner of a course they created
+func addOwner(tx *gorm.DB, c *gin.Context, courseID uint) error {
+	userID, _ := currentUser(c)
+	return tx.Create(&models.CourseMember{CourseID: courseID, UserID: userID, Role: models.CourseOwner}).Error
+}
+
+// Create Course (Admins and teachers; the creator becomes its owner)
 func (h *CourseHandler) CreateCourse(c *gin.Context) {
+	if !canCreateCourses(c) {
+		return
+	}
+
 	var course models.Course
 	if err := c.ShouldBindJSON(&course); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Left out, the exam time takes the column default
+	if course.ExamTime < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exam time must be a positive number of minutes"})
+		return
+	}
 
-	if err := database.DB.Create(&course).Error; err != nil {
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&course).Error; err != nil {
+			return err
+		}
+		return addOwner(tx, c, course.ID)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create course"})
 		return
 	}
 
+	audit.Note(c, audit.Change{Action: "course.create", EntityType: "course", EntityID: course.ID, After: course})
 	c.JSON(http.StatusCreated, course)
 }
 
-// Get All Courses
+// Get All Courses (questions are not included on the public endpoint)
 func (h *CourseHandler) GetCourses(c *gin.Context) {
 	var courses []models.Course
-	// Preload QuizPackages and their Questions for accurate counts
-	if err := database.DB.Preload("QuizPackages.Questions").Find(&courses).Error; err != nil {
+	if err := database.DB.Preload("QuizPackages").Find(&courses).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch courses"})
 		return
 	}
 
+	for i := range courses {
+		withSeatsRemaining(&courses[i])
+	}
+
 	c.JSON(http.StatusOK, courses)
 }
 
-// Get Course by ID
+// Get Course by ID (questions are not included on the public endpoint)
 func (h *CourseHandler) GetCourse(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
+	var course models.Course
+	if err := database.DB.Preload("QuizPackages").First(&course, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
+
+	withSeatsRemaining(&course)
+
+	c.JSON(http.StatusOK, course)
+}
+
+// Get the staff member's courses with full question data
+func (h *CourseHandler) GetCoursesAdmin(c *gin.Context) {
+	query, ok := staffCourses(c, database.DB, "id")
+	if !ok {
+		return
+	}
+
+	var courses []models.Course
+	// Preload QuizPackages and their Questions for accurate counts
+	if err := query.Preload("QuizPackages.Questions").Find(&courses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch courses"})
+		return
+	}
+
+	for i := range courses {
+		withSeatsRemaining(&courses[i])
+	}
+
+	c.JSON(http.StatusOK, courses)
+}
+
+// Get Course by ID with full question data (course staff)
+func (h *CourseHandler) GetCourseAdmin(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorize(c, uint(id), access.View) {
+		return
+	}
+
 	var course models.Course
 	if err := database.DB.Preload("QuizPackages.Questions").First(&course, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
 		return
 	}
 
+	withSeatsRemaining(&course)
+
 	c.JSON(http.StatusOK, course)
 }
 
-// Update Course (Admin only)
+// Update Course (course owners)
 func (h *CourseHandler) UpdateCourse(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorize(c, uint(id), access.Manage) {
+		return
+	}
 
 	var course models.Course
 	if err := database.DB.First(&course, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
 		return
 	}
+	wasFull := enrollments.IsFull(database.DB, &course)
+	before := course
 
 	if err := c.ShouldBindJSON(&course); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The URL names the record to update; ids in the body, nested records
+	// included, are ignored
+	course.ID, course.CreatedAt = before.ID, before.CreatedAt
+	// Attempts would be out of time as soon as they start
+	if course.ExamTime <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exam time must be a positive number of minutes"})
+		return
+	}
 
-	if err := database.DB.Save(&course).Error; err != nil {
+	if err := database.DB.Omit(clause.Associations).Save(&course).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update course"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "course.update", EntityType: "course", EntityID: course.ID, Before: before, After: course})
+
+	// Raising the limit of a full course opens seats for waiting students
+	if wasFull {
+		seats := enrollments.SeatsRemaining(database.DB, &course)
+		if _, err := enrollments.PromoteWaiting(database.DB, course.ID, seats); err != nil {
+			log.Printf("Failed to promote waitlisted students for course %d: %v", course.ID, err)
+		}
+	}
+
+	withSeatsRemaining(&course)
 
 	c.JSON(http.StatusOK, course)
 }
 
-// Delete Course (Admin only)
+// Delete Course (course owners)
 func (h *CourseHandler) DeleteCourse(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorize(c, uint(id), access.Manage) {
+		return
+	}
+
+	var course models.Course
+	if err := database.DB.First(&course, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
 
-	if err := database.DB.Delete(&models.Course{}, id).Error; err != nil {
+	if err := trash.Delete(database.DB, trash.Courses, course.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete course"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "course.delete", EntityType: "course", EntityID: course.ID, Before: course})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Course deleted successfully"})
 }
 
-// Get Course Statistics (Admin only)
+// Get Course Statistics (course staff)
 func (h *CourseHandler) GetCourseStats(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorize(c, uint(id), access.View) {
+		return
+	}
 
 	var course models.Course
 	if err := database.DB.First(&course, id).Error; err != nil {
@@ -115,29 +245,55 @@ func (h *CourseHandler) GetCourseStats(c *gin.Context) {
 
 	// Get list of students with their attempts
 	type StudentAttempt struct {
-		StudentName  string `json:"student_name"`
-		DeviceID     string `json:"device_id"`
-		AttemptCount int    `json:"attempt_count"`
-		BestScore    int    `json:"best_score"`
-		TotalPoints  int    `json:"total_points"`
-		LastAttempt  string `json:"last_attempt"`
-	}
-
-	var studentAttempts []StudentAttempt
-	database.DB.Raw(`
-		SELECT 
-			u.name as student_name,
-			a.device_id,
-			COUNT(a.id) as attempt_count,
-			MAX(a.score) as best_score,
-			MAX(a.total_points) as total_points,
-			MAX(a.created_at) as last_attempt
-		FROM attempts a
-		JOIN users u ON a.student_id = u.id
-		WHERE a.course_id = ?
-		GROUP BY u.name, a.device_id
-		ORDER BY last_attempt DESC
-	`, id).Scan(&studentAttempts)
+		StudentName  string    `json:"student_name"`
+		DeviceID     string    `json:"device_id"`
+		AttemptCount int       `json:"attempt_count"`
+		BestScore    int       `json:"best_score"`
+		TotalPoints  int       `json:"total_points"`
+		LastAttempt  time.Time `json:"last_attempt"`
+	}
+
+	// Aggregated in Go rather than SQL so MAX(created_at) comes back as a
+	// time on every database driver
+	var rows []struct {
+		StudentName string
+		DeviceID    string
+		Score       int
+		TotalPoints int
+		CreatedAt   time.Time
+	}
+	database.DB.Model(&models.Attempt{}).
+		Select("users.name AS student_name, attempts.device_id, attempts.score, attempts.total_points, attempts.created_at").
+		Joins("JOIN users ON users.id = attempts.student_id").
+		Where("attempts.course_id = ?", id).
+		Order("attempts.created_at DESC").
+		Scan(&rows)
+
+	// Rows arrive newest first, so groups are ordered by their last attempt
+	studentAttempts := []StudentAttempt{}
+	groupIndex := make(map[[2]string]int)
+	for _, row := range rows {
+		key := [2]string{row.StudentName, row.DeviceID}
+		i, exists := groupIndex[key]
+		if !exists {
+			i = len(studentAttempts)
+			groupIndex[key] = i
+			studentAttempts = append(studentAttempts, StudentAttempt{
+				StudentName: row.StudentName,
+				DeviceID:    row.DeviceID,
+				LastAttempt: row.CreatedAt,
+			})
+		}
+
+		group := &studentAttempts[i]
+		group.AttemptCount++
+		if row.Score > group.BestScore {
+			group.BestScore = row.Score
+		}
+		if row.TotalPoints > group.TotalPoints {
+			group.TotalPoints = row.TotalPoints
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"course_id":        course.ID,
@@ -147,3 +303,58 @@ func (h *CourseHandler) GetCourseStats(c *gin.Context) {
 		"student_attempts": studentAttempts,
 	})
 }
+
+// CloneCourseRequest optionally names a copied course
+type CloneCourseRequest struct {
+	Title string `json:"title"` // Defaults to "<source title> (Copy)"
+}
+
+// CloneCourse deep-copies a course with all its quiz packages, questions and
+// images. Enrollments, attempts and staff stay with the original; whoever
+// copies it owns the copy (admins and teachers who can see the course).
+func (h *CourseHandler) CloneCourse(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+	if !canCreateCourses(c) || !authorize(c, uint(id), access.View) {
+		return
+	}
+
+	var req CloneCourseRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var source models.Course
+	if err := database.DB.First(&source, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
+
+	var clone *models.Course
+	var cloner *cloning.Cloner
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		cloner = cloning.New(tx)
+		if clone, err = cloner.CloneCourse(source.ID, strings.TrimSpace(req.Title)); err != nil {
+			return err
+		}
+		return addOwner(tx, c, clone.ID)
+	}); err != nil {
+		// The transaction can fail before it gets to create the cloner
+		if cloner != nil {
+			cloner.Rollback()
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy course"})
+		return
+	}
+
+	withSeatsRemaining(clone)
+
+	audit.Note(c, audit.Change{Action: "course.clone", EntityType: "course", EntityID: clone.ID, Before: source, After: clone})
+	c.JSON(http.StatusCreated, clone)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestGetCourseStats(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		course := newCourse(t, db, "N5 Grammar")
+		other := newCourse(t, db, "Kanji Basics")
+		pkg := &models.QuizPackage{CourseID: course.ID, Title: "Week 1"}
+		otherPkg := &models.QuizPackage{CourseID: other.ID, Title: "Week 1"}
+		create(t, db, pkg)
+		create(t, db, otherPkg)
+		teacher := newStaff(t, db, models.RoleTeacher, models.CourseTeacher, course)
+		outsider := newStaff(t, db, models.RoleTeacher, models.CourseOwner, other)
+
+		aiko := newUser(t, db, "Aiko", models.RoleStudent)
+		ben := newUser(t, db, "Ben", models.RoleStudent)
+		chika := newUser(t, db, "Chika", models.RoleStudent)
+
+		now := time.Now().Truncate(time.Second)
+		attempt := func(student *models.User, pkg *models.QuizPackage, device string, score int, ago time.Duration) {
+			create(t, db, &models.Attempt{
+				CreatedAt:     now.Add(-ago),
+				StudentID:     student.ID,
+				CourseID:      pkg.CourseID,
+				QuizPackageID: pkg.ID,
+				DeviceID:      device,
+				Status:        models.StatusCompleted,
+				Score:         score,
+				TotalPoints:   10,
+			})
+		}
+		attempt(aiko, pkg, "dev-a", 3, 3*time.Hour)
+		attempt(aiko, pkg, "dev-a", 7, time.Hour)
+		attempt(ben, pkg, "dev-b", 5, 2*time.Hour)
+		attempt(chika, pkg, "", 1, 4*time.Hour)
+		attempt(ben, otherPkg, "dev-b", 9, time.Minute)
+
+		h := NewCourseHandler()
+		path := "/courses/" + strconv.Itoa(int(course.ID)) + "/stats"
+		var stats struct {
+			CourseID        uint   `json:"course_id"`
+			CourseTitle     string `json:"course_title"`
+			TotalAttempts   int64  `json:"total_attempts"`
+			UniqueStudents  int64  `json:"unique_students"`
+			StudentAttempts []struct {
+				StudentName  string    `json:"student_name"`
+				DeviceID     string    `json:"device_id"`
+				AttemptCount int       `json:"attempt_count"`
+				BestScore    int       `json:"best_score"`
+				TotalPoints  int       `json:"total_points"`
+				LastAttempt  time.Time `json:"last_attempt"`
+			} `json:"student_attempts"`
+		}
+		decode(t, serve(t, teacher, "GET", "/courses/:id/stats", path, nil, h.GetCourseStats), http.StatusOK, &stats)
+
+		if stats.CourseID != course.ID || stats.CourseTitle != "N5 Grammar" {
+			t.Errorf("course = %d %q", stats.CourseID, stats.CourseTitle)
+		}
+		if stats.TotalAttempts != 4 {
+			t.Errorf("total_attempts = %d, want 4", stats.TotalAttempts)
+		}
+		// Attempts without a device are not counted as separate students
+		if stats.UniqueStudents != 2 {
+			t.Errorf("unique_students = %d, want 2", stats.UniqueStudents)
+		}
+
+		want := []struct {
+			name   string
+			device string
+			count  int
+			best   int
+			last   time.Time
+		}{
+			{"Aiko", "dev-a", 2, 7, now.Add(-time.Hour)},
+			{"Ben", "dev-b", 1, 5, now.Add(-2 * time.Hour)},
+			{"Chika", "", 1, 1, now.Add(-4 * time.Hour)},
+		}
+		if len(stats.StudentAttempts) != len(want) {
+			t.Fatalf("got %d student groups, want %d: %+v", len(stats.StudentAttempts), len(want), stats.StudentAttempts)
+		}
+		for i, w := range want {
+			got := stats.StudentAttempts[i]
+			if got.StudentName != w.name || got.DeviceID != w.device || got.AttemptCount != w.count ||
+				got.BestScore != w.best || got.TotalPoints != 10 || !within(got.LastAttempt, w.last) {
+				t.Errorf("group %d = %+v, want %s/%s with %d attempts, best %d, last %v",
+					i, got, w.name, w.device, w.count, w.best, w.last)
+			}
+		}
+
+		w := serve(t, outsider, "GET", "/courses/:id/stats", path, nil, h.GetCourseStats)
+		decode(t, w, http.StatusForbidden, nil)
+	})
+}
+
+// A course owner cannot overwrite another course by putting its id in the body
+func TestUpdateCourseIgnoresBodyID(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		course := newCourse(t, db, "N5 Grammar")
+		other := newCourse(t, db, "Kanji Basics")
+		otherPkg := &models.QuizPackage{CourseID: other.ID, Title: "Week 1"}
+		create(t, db, otherPkg)
+		owner := newStaff(t, db, models.RoleTeacher, models.CourseOwner, course)
+
+		h := NewCourseHandler()
+		body := map[string]interface{}{
+			"id":            other.ID,
+			"title":         "Renamed",
+			"student_limit": 20,
+			"exam_time":     45,
+			"quiz_packages": []map[string]interface{}{{"id": otherPkg.ID, "title": "Taken"}},
+		}
+		var updated models.Course
+		w := serve(t, owner, "PUT", "/courses/:id", "/courses/"+strconv.Itoa(int(course.ID)), body, h.UpdateCourse)
+		decode(t, w, http.StatusOK, &updated)
+		if updated.ID != course.ID {
+			t.Errorf("response is course %d, want %d", updated.ID, course.ID)
+		}
+
+		var stored models.Course
+		db.First(&stored, course.ID)
+		if stored.Title != "Renamed" || stored.StudentLimit != 20 {
+			t.Errorf("course = %q with limit %d, want the update", stored.Title, stored.StudentLimit)
+		}
+		var untouched models.Course
+		db.First(&untouched, other.ID)
+		if untouched.Title != "Kanji Basics" {
+			t.Errorf("other course title = %q, want it untouched", untouched.Title)
+		}
+		var pkg models.QuizPackage
+		db.First(&pkg, otherPkg.ID)
+		if pkg.CourseID != other.ID || pkg.Title != "Week 1" {
+			t.Errorf("other course's package = course %d %q, want it untouched", pkg.CourseID, pkg.Title)
+		}
+	})
+}
+
+// An exam time of zero would end every attempt as soon as it starts
+func TestUpdateCourseRejectsZeroExamTime(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		course := newCourse(t, db, "N5 Grammar")
+		owner := newStaff(t, db, models.RoleTeacher, models.CourseOwner, course)
+
+		h := NewCourseHandler()
+		path := "/courses/" + strconv.Itoa(int(course.ID))
+		for _, examTime := range []int{0, -5} {
+			body := map[string]interface{}{"title": "N5 Grammar", "exam_time": examTime}
+			decode(t, serve(t, owner, "PUT", "/courses/:id", path, body, h.UpdateCourse), http.StatusBadRequest, nil)
+		}
+
+		var stored models.Course
+		db.First(&stored, course.ID)
+		if stored.ExamTime != 30 {
+			t.Errorf("exam_time = %d, want it unchanged", stored.ExamTime)
+		}
+	})
+}
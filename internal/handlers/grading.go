@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/attempts"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/grading"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/regrade"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type GradingHandler struct{}
+
+func NewGradingHandler() *GradingHandler {
+	return &GradingHandler{}
+}
+
+// reviewableTypes are the free-text question types a teacher may need to mark by hand
+var reviewableTypes = []models.QuestionType{models.TypeShortAnswer, models.TypeFillBlank}
+
+type gradingQueueItem struct {
+	AnswerID      uint       `json:"answer_id"`
+	AttemptID     uint       `json:"attempt_id"`
+	QuestionID    uint       `json:"question_id"`
+	StudentID     uint       `json:"student_id"`
+	StudentName   string     `json:"student_name"`
+	StudentEmail  string     `json:"student_email"`
+	QuestionText  string     `json:"question_text"`
+	QuestionType  string     `json:"question_type"`
+	CorrectAnswer string     `json:"correct_answer" gorm:"-"`
+	Points        int        `json:"points"`
+	StudentAnswer string     `json:"student_answer"`
+	IsCorrect     bool       `json:"is_correct"`
+	PointsEarned  int        `json:"points_earned"`
+	SubmittedAt   *time.Time `json:"submitted_at"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	ReviewComment string     `json:"review_comment"`
+}
+
+// GetGradingQueue lists free-text answers of completed attempts that need a
+// teacher's review (course staff). status is pending (default), reviewed or all.
+func (h *GradingHandler) GetGradingQueue(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, quizPackage.CourseID, access.View) {
+		return
+	}
+
+	query := database.DB.Table("answers").
+		Joins("JOIN attempts ON attempts.id = answers.attempt_id AND attempts.deleted_at IS NULL").
+		Joins("JOIN questions ON questions.id = answers.question_id").
+		Joins("LEFT JOIN users ON users.id = attempts.student_id").
+		Where("answers.deleted_at IS NULL").
+		Where("attempts.quiz_package_id = ? AND attempts.status = ?", quizPackage.ID, models.StatusCompleted).
+		Where("questions.question_type IN ?", reviewableTypes)
+
+	status := strings.ToLower(c.DefaultQuery("status", "pending"))
+	switch status {
+	case "pending":
+		query = query.Where("answers.is_correct = ? AND answers.reviewed_at IS NULL", false)
+	case "reviewed":
+		query = query.Where("answers.reviewed_at IS NOT NULL")
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be pending, reviewed or all"})
+		return
+	}
+
+	items := []gradingQueueItem{}
+	if err := query.Select(`answers.id AS answer_id, answers.attempt_id, answers.question_id,
+			attempts.student_id, users.name AS student_name, users.email AS student_email,
+			questions.question_text, questions.question_type, questions.points,
+			answers.student_answer, answers.is_correct, answers.points_earned,
+			attempts.end_time AS submitted_at, answers.reviewed_at, answers.review_comment`).
+		Order("attempts.end_time, answers.id").
+		Scan(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch grading queue"})
+		return
+	}
+
+	// Show the answer key the automatic compare used
+	questionIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		questionIDs = append(questionIDs, item.QuestionID)
+	}
+	var questions []models.Question
+	database.DB.Unscoped().Where("id IN ?", questionIDs).Find(&questions)
+	keys := make(map[uint]string, len(questions))
+	for i := range questions {
+		keys[questions[i].ID] = grading.CorrectAnswer(&questions[i])
+	}
+	for i := range items {
+		items[i].CorrectAnswer = keys[items[i].QuestionID]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quiz_package_id": quizPackage.ID,
+		"status":          status,
+		"total":           len(items),
+		"answers":         items,
+	})
+}
+
+type GradeAnswerRequest struct {
+	IsCorrect    *bool  `json:"is_correct"`
+	PointsEarned *int   `json:"points_earned"`
+	Comment      string `json:"comment"`
+}
+
+// GradeAnswer overrides an answer's automatic grade, records the change and
+// re-totals the attempt score (course assistants and up)
+func (h *GradingHandler) GradeAnswer(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, _ := c.Get("user_id")
+	reviewerID := userID.(uint)
+
+	var req GradeAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.IsCorrect == nil && req.PointsEarned == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide is_correct or points_earned"})
+		return
+	}
+
+	var answer models.Answer
+	if err := database.DB.First(&answer, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found"})
+		return
+	}
+
+	var attempt models.Attempt
+	if err := database.DB.First(&attempt, answer.AttemptID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	}
+	if !authorize(c, attempt.CourseID, access.Grade) {
+		return
+	}
+	if attempt.Status != models.StatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only answers of completed attempts can be graded"})
+		return
+	}
+
+	var question models.Question
+	if err := database.DB.Unscoped().First(&question, answer.QuestionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+
+	// Marking correct without points awards full marks; marking wrong awards none
+	points := 0
+	switch {
+	case req.PointsEarned != nil:
+		points = *req.PointsEarned
+	case *req.IsCorrect:
+		points = question.Points
+	}
+	if points < 0 || points > question.Points {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Points must be between 0 and " + strconv.Itoa(question.Points)})
+		return
+	}
+	isCorrect := points == question.Points
+	if req.IsCorrect != nil {
+		isCorrect = *req.IsCorrect
+	}
+
+	now := time.Now()
+	comment := strings.TrimSpace(req.Comment)
+	review := models.AnswerReview{
+		AnswerID:             answer.ID,
+		AttemptID:            answer.AttemptID,
+		ReviewerID:           reviewerID,
+		PreviousIsCorrect:    answer.IsCorrect,
+		PreviousPointsEarned: answer.PointsEarned,
+		IsCorrect:            isCorrect,
+		PointsEarned:         points,
+		Comment:              comment,
+	}
+
+	before := answer
+
+	var score int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&answer).Updates(map[string]interface{}{
+			"is_correct":     isCorrect,
+			"points_earned":  points,
+			"reviewed_at":    now,
+			"reviewed_by":    reviewerID,
+			"review_comment": comment,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		score, err = attempts.Rescore(tx, answer.AttemptID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade answer"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "answer.grade", EntityType: "answer", EntityID: answer.ID, Before: before, After: answer})
+
+	c.JSON(http.StatusOK, gin.H{
+		"answer":        answer,
+		"review":        review,
+		"attempt_score": score,
+		"total_points":  attempt.TotalPoints,
+	})
+}
+
+// GetAnswerReviews returns the grading history of an answer, newest first (course staff)
+func (h *GradingHandler) GetAnswerReviews(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var answer models.Answer
+	if err := database.DB.First(&answer, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found"})
+		return
+	}
+	if !authorizeVia(c, access.CourseOfAttempt, answer.AttemptID, access.View, "Attempt not found") {
+		return
+	}
+
+	var reviews []models.AnswerReview
+	if err := database.DB.Preload("Reviewer").
+		Where("answer_id = ?", answer.ID).
+		Order("created_at DESC, id DESC").
+		Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch grading history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"answer":  answer,
+		"reviews": reviews,
+	})
+}
+
+// RegradeQuestion re-marks every stored answer to a question against its
+// current answer key (course teachers). With ?dry_run=true only the preview of
+// affected attempts and score deltas is returned.
+func (h *GradingHandler) RegradeQuestion(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var question models.Question
+	if err := database.DB.First(&question, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+	if !authorizeVia(c, access.CourseOfPackage, question.QuizPackageID, access.Edit, "Quiz package not found") {
+		return
+	}
+
+	h.regrade(c, []models.Question{question}, audit.Change{Action: "question.regrade", EntityType: "question", EntityID: question.ID})
+}
+
+// RegradeQuizPackage re-marks the stored answers to all of a package's
+// questions (course teachers); ?dry_run=true previews the changes
+func (h *GradingHandler) RegradeQuizPackage(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, quizPackage.CourseID, access.Edit) {
+		return
+	}
+
+	var questions []models.Question
+	if err := database.DB.Where("quiz_package_id = ?", quizPackage.ID).Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+
+	h.regrade(c, questions, audit.Change{Action: "quiz_package.regrade", EntityType: "quiz_package", EntityID: quizPackage.ID})
+}
+
+func (h *GradingHandler) regrade(c *gin.Context, questions []models.Question, change audit.Change) {
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+
+	if dryRun {
+		audit.Skip(c)
+		plan, err := regrade.Preview(database.DB, questions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview regrade"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "regrade": plan})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	plan, err := regrade.Apply(database.DB, questions, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regrade answers"})
+		return
+	}
+	change.After = plan
+	audit.Note(c, change)
+	c.JSON(http.StatusOK, gin.H{"dry_run": false, "regrade": plan})
+}
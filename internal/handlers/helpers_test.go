@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mitsuki-jpy-quiz/internal/models"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve calls handler on route as the given user, as AuthMiddleware would
+// leave the context, and returns the recorded response
+func serve(t *testing.T, user *models.User, method, route, path string, body interface{}, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := gin.New()
+	router.Handle(method, route, func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user_role", string(user.Role))
+		c.Set("user_email", user.Email)
+	}, handler)
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// decode reads a JSON response into v, failing on an unexpected status
+func decode(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+	}
+}
+
+func create(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+var userCount int
+
+func newUser(t *testing.T, db *gorm.DB, name string, role models.UserRole) *models.User {
+	t.Helper()
+	userCount++
+	user := &models.User{
+		Name:     name,
+		Email:    fmt.Sprintf("user%d@example.com", userCount),
+		Password: "x",
+		Role:     role,
+	}
+	create(t, db, user)
+	return user
+}
+
+// newStaff creates a staff account with a role in each of the courses
+func newStaff(t *testing.T, db *gorm.DB, role models.UserRole, courseRole models.CourseRole, courses ...*models.Course) *models.User {
+	t.Helper()
+	user := newUser(t, db, string(role), role)
+	for _, course := range courses {
+		create(t, db, &models.CourseMember{CourseID: course.ID, UserID: user.ID, Role: courseRole})
+	}
+	return user
+}
+
+func newCourse(t *testing.T, db *gorm.DB, title string) *models.Course {
+	t.Helper()
+	course := &models.Course{Title: title, StudentLimit: 50, ExamTime: 30}
+	create(t, db, course)
+	return course
+}
+
+func enroll(t *testing.T, db *gorm.DB, student *models.User, course *models.Course, status models.EnrollmentStatus) *models.Enrollment {
+	t.Helper()
+	enrollment := &models.Enrollment{StudentID: student.ID, CourseID: course.ID, Status: status}
+	create(t, db, enrollment)
+	return enrollment
+}
+
+// within reports whether two times are less than a second apart; databases
+// store them with different precision
+func within(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d > -time.Second && d < time.Second
+}
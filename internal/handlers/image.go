@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"fmt"
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,8 +21,18 @@ func NewImageHandler() *ImageHandler {
 	return &ImageHandler{}
 }
 
-// UploadImage handles image file uploads
+// UploadImage handles image file uploads for the questions of the quiz
+// package given as quiz_package_id (course teachers)
 func (h *ImageHandler) UploadImage(c *gin.Context) {
+	packageID, _ := strconv.Atoi(c.PostForm("quiz_package_id"))
+	if packageID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quiz_package_id is required"})
+		return
+	}
+	if !authorizeVia(c, access.CourseOfPackage, uint(packageID), access.Edit, "Quiz package not found") {
+		return
+	}
+
 	// Get the file from form data
 	file, err := c.FormFile("image")
 	if err != nil {
@@ -77,7 +91,8 @@ func (h *ImageHandler) UploadImage(c *gin.Context) {
 	})
 }
 
-// DeleteImage handles image deletion
+// DeleteImage handles image deletion (course teachers of every question that
+// shows the image, now or in an earlier version; admins for unused images)
 func (h *ImageHandler) DeleteImage(c *gin.Context) {
 	filename := c.Param("filename")
 
@@ -85,6 +100,38 @@ func (h *ImageHandler) DeleteImage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Filename is required"})
 		return
 	}
+	if filename != filepath.Base(filename) || strings.HasPrefix(filename, ".") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filename"})
+		return
+	}
+
+	imageURL := "/uploads/questions/" + filename
+	var questionIDs []uint
+	if err := database.DB.Model(&models.Question{}).Unscoped().
+		Where("image_url = ?", imageURL).
+		Pluck("id", &questionIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	var versionQuestionIDs []uint
+	if err := database.DB.Model(&models.QuestionVersion{}).
+		Where("image_url = ?", imageURL).
+		Distinct().Pluck("question_id", &versionQuestionIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	questionIDs = append(questionIDs, versionQuestionIDs...)
+
+	// Nobody can vouch for an image no question uses
+	if _, role := currentUser(c); len(questionIDs) == 0 && role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can delete images that no question uses"})
+		return
+	}
+	for _, questionID := range questionIDs {
+		if !authorizeVia(c, access.CourseOfQuestion, questionID, access.Edit, "Question not found") {
+			return
+		}
+	}
 
 	// Construct file path
 	filepath := filepath.Join("web/uploads/questions", filename)
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func uploadImage(t *testing.T, user *models.User, packageID uint) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("quiz_package_id", strconv.Itoa(int(packageID)))
+	part, _ := form.CreateFormFile("image", "cat.png")
+	part.Write([]byte("\x89PNG\r\n\x1a\n"))
+	form.Close()
+
+	router := gin.New()
+	router.POST("/upload/image", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user_role", string(user.Role))
+	}, NewImageHandler().UploadImage)
+	req := httptest.NewRequest("POST", "/upload/image", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestImagePermissions(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		t.Chdir(t.TempDir())
+
+		course := newCourse(t, db, "N5 Grammar")
+		other := newCourse(t, db, "Kanji Basics")
+		pkg := &models.QuizPackage{CourseID: course.ID, Title: "Week 1"}
+		otherPkg := &models.QuizPackage{CourseID: other.ID, Title: "Week 1"}
+		create(t, db, pkg)
+		create(t, db, otherPkg)
+		admin := newUser(t, db, "Admin", models.RoleAdmin)
+		teacher := newStaff(t, db, models.RoleTeacher, models.CourseTeacher, course)
+		assistant := newStaff(t, db, models.RoleAssistant, models.CourseAssistant, course)
+
+		// Uploads need edit rights on the package's course
+		decode(t, uploadImage(t, assistant, pkg.ID), http.StatusForbidden, nil)
+		decode(t, uploadImage(t, teacher, otherPkg.ID), http.StatusForbidden, nil)
+		decode(t, uploadImage(t, teacher, 0), http.StatusBadRequest, nil)
+		var uploaded struct {
+			ImageURL string `json:"image_url"`
+			Filename string `json:"filename"`
+		}
+		decode(t, uploadImage(t, teacher, pkg.ID), http.StatusOK, &uploaded)
+
+		// Deletes need edit rights on every question that shows the image
+		if err := os.MkdirAll("web/uploads/questions", 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"own.png", "theirs.png", "old.png", "unused.png"} {
+			if err := os.WriteFile(filepath.Join("web/uploads/questions", name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		question := func(pkg *models.QuizPackage, image string) *models.Question {
+			q := &models.Question{QuizPackageID: pkg.ID, QuestionText: "猫", QuestionType: models.TypeShortAnswer,
+				CorrectAnswer: "ねこ", Points: 1, ImageURL: "/uploads/questions/" + image}
+			create(t, db, q)
+			return q
+		}
+		question(pkg, "own.png")
+		question(otherPkg, "theirs.png")
+		edited := question(otherPkg, "new.png")
+		create(t, db, &models.QuestionVersion{QuestionID: edited.ID, Version: 1, ImageURL: "/uploads/questions/old.png"})
+
+		h := NewImageHandler()
+		remove := func(user *models.User, name string) *httptest.ResponseRecorder {
+			return serve(t, user, "DELETE", "/upload/image/:filename", "/upload/image/"+name, nil, h.DeleteImage)
+		}
+		decode(t, remove(teacher, "theirs.png"), http.StatusForbidden, nil)
+		decode(t, remove(teacher, "old.png"), http.StatusForbidden, nil)
+		decode(t, remove(teacher, "unused.png"), http.StatusForbidden, nil)
+		decode(t, remove(assistant, "own.png"), http.StatusForbidden, nil)
+		decode(t, remove(teacher, "..."), http.StatusBadRequest, nil)
+		decode(t, remove(teacher, "own.png"), http.StatusOK, nil)
+		decode(t, remove(teacher, uploaded.Filename), http.StatusForbidden, nil)
+		decode(t, remove(admin, "unused.png"), http.StatusOK, nil)
+
+		left, _ := os.ReadDir("web/uploads/questions")
+		names := make([]string, len(left))
+		for i, entry := range left {
+			names[i] = entry.Name()
+		}
+		got, _ := json.Marshal(names)
+		want, _ := json.Marshal([]string{uploaded.Filename, "old.png", "theirs.png"})
+		if string(got) != string(want) {
+			t.Errorf("files left = %s, want %s", got, want)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/throttle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LockoutHandler struct {
+	Limiter *throttle.Limiter
+}
+
+func NewLockoutHandler(limiter *throttle.Limiter) *LockoutHandler {
+	return &LockoutHandler{Limiter: limiter}
+}
+
+// ListLockouts returns recorded lockouts, newest first (Admin only).
+// Filters: active=true for lockouts still in force, scope (admin, student or
+// quiz) and q (identifier or IP address).
+func (h *LockoutHandler) ListLockouts(c *gin.Context) {
+	query := database.DB.Model(&models.LoginLockout{})
+	if c.Query("active") == "true" {
+		query = query.Where("unlocked_at IS NULL AND locked_until > ?", time.Now())
+	}
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if q := c.Query("q"); q != "" {
+		like := "%" + q + "%"
+		query = query.Where("identifier LIKE ? OR ip_address LIKE ?", like, like)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "50"))
+	if perPage < 1 || perPage > maxAuditPageSize {
+		perPage = 50
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+	lockouts := []models.LoginLockout{}
+	if err := query.Order("id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&lockouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":       lockouts,
+		"total":       total,
+		"page":        page,
+		"per_page":    perPage,
+		"total_pages": (total + int64(perPage) - 1) / int64(perPage),
+	})
+}
+
+// UnlockLockout lifts a lockout before it runs out (Admin only)
+func (h *LockoutHandler) UnlockLockout(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var lockout models.LoginLockout
+	if err := database.DB.First(&lockout, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lockout not found"})
+		return
+	}
+	if lockout.UnlockedAt != nil || time.Now().After(lockout.LockedUntil) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Lockout is no longer in force"})
+		return
+	}
+	before := lockout
+
+	if err := h.Limiter.Unlock(&lockout); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+	userID, _ := currentUser(c)
+	now := time.Now()
+	lockout.UnlockedAt, lockout.UnlockedBy = &now, &userID
+	if err := database.DB.Model(&lockout).Updates(map[string]interface{}{"unlocked_at": now, "unlocked_by": userID}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "lockout.unlock", EntityType: "lockout", EntityID: lockout.ID, Before: before, After: lockout})
+
+	c.JSON(http.StatusOK, lockout)
+}
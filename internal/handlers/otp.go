@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/otp"
+	"mitsuki-jpy-quiz/internal/throttle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QuizOTPRequest asks for a passcode to be sent to a student about to take a quiz
+type QuizOTPRequest struct {
+	CourseID      uint   `json:"course_id" binding:"required"`
+	QuizPackageID uint   `json:"quiz_package_id" binding:"required"`
+	Identifier    string `json:"phone_number" binding:"required"` // Phone number OR email, as for check-phone
+	Channel       string `json:"channel"`                         // sms, email or telegram; defaults to the kind of identifier
+}
+
+// QuizOTPVerification exchanges a passcode for a quiz token
+type QuizOTPVerification struct {
+	CourseID      uint   `json:"course_id" binding:"required"`
+	QuizPackageID uint   `json:"quiz_package_id" binding:"required"`
+	Identifier    string `json:"phone_number" binding:"required"`
+	Code          string `json:"code" binding:"required"`
+}
+
+func (h *AuthHandler) otpPolicy() otp.Policy {
+	return otp.Policy{
+		TTL:         time.Duration(h.Config.OTPTTLMinutes) * time.Minute,
+		MaxAttempts: h.Config.OTPMaxAttempts,
+		ResendAfter: time.Duration(h.Config.OTPResendSeconds) * time.Second,
+		MaxPerHour:  h.Config.OTPMaxPerHour,
+	}
+}
+
+// otpDestination is where the user receives codes on the channel, or "" if nowhere
+func otpDestination(user *models.User, channel otp.Channel) string {
+	switch channel {
+	case otp.ChannelSMS:
+		return user.PhoneNumber
+	case otp.ChannelEmail:
+		return user.Email
+	case otp.ChannelTelegram:
+		return user.TelegramChatID
+	}
+	return ""
+}
+
+// otpChannels lists the configured channels the user can receive codes on
+func (h *AuthHandler) otpChannels(user *models.User) []otp.Channel {
+	channels := []otp.Channel{}
+	for _, channel := range []otp.Channel{otp.ChannelSMS, otp.ChannelEmail, otp.ChannelTelegram} {
+		if _, ok := h.OTPSenders[channel]; ok && otpDestination(user, channel) != "" {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// RequestQuizOTP sends a one-time passcode to a student approved for the quiz
+func (h *AuthHandler) RequestQuizOTP(c *gin.Context) {
+	var req QuizOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if h.throttled(c, h.lookupPolicy(), throttle.ScopeQuiz, "") {
+		return
+	}
+
+	response, user, quizPackage := quizEligibility(req.Identifier, fmt.Sprint(req.CourseID), fmt.Sprint(req.QuizPackageID))
+	if user == nil {
+		h.failed(c, h.lookupPolicy(), throttle.ScopeQuiz, "")
+	}
+	if quizPackage == nil {
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	channel := otp.Channel(req.Channel)
+	if channel == "" {
+		channel = otp.ChannelSMS
+		if strings.Contains(req.Identifier, "@") {
+			channel = otp.ChannelEmail
+		}
+	}
+	sender, ok := h.OTPSenders[channel]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passcodes cannot be sent by " + string(channel)})
+		return
+	}
+	destination := otpDestination(user, channel)
+	if destination == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "There is no " + string(channel) + " contact on file for this student"})
+		return
+	}
+
+	policy := h.otpPolicy()
+	code, err := otp.Issue(database.DB, sender, policy, user, channel, destination)
+	var limited *otp.RateLimitError
+	if errors.As(err, &limited) {
+		retryAfter := int(limited.RetryAfter.Seconds() + 0.5)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": limited.Error(), "retry_after": retryAfter})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to send passcode to user %d by %s: %v", user.ID, channel, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send the passcode, please try again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Passcode sent",
+		"channel":      channel,
+		"destination":  otp.Mask(destination),
+		"expires_at":   code.ExpiresAt,
+		"resend_after": int(policy.ResendAfter.Seconds()),
+	})
+}
+
+// VerifyQuizOTP checks the passcode and returns the quiz token the quiz
+// endpoints require, along with the check-phone details
+func (h *AuthHandler) VerifyQuizOTP(c *gin.Context) {
+	var req QuizOTPVerification
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if h.throttled(c, h.lookupPolicy(), throttle.ScopeQuiz, "") {
+		return
+	}
+
+	response, user, quizPackage := quizEligibility(req.Identifier, fmt.Sprint(req.CourseID), fmt.Sprint(req.QuizPackageID))
+	if user == nil {
+		h.failed(c, h.lookupPolicy(), throttle.ScopeQuiz, "")
+	}
+	if quizPackage == nil {
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	switch err := otp.Verify(database.DB, h.otpPolicy(), user.ID, req.Code); {
+	case errors.Is(err, otp.ErrNoCode), errors.Is(err, otp.ErrExpired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "The passcode has expired or was already used, please request a new one"})
+		return
+	case errors.Is(err, otp.ErrTooManyAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many wrong passcodes, please request a new one"})
+		return
+	case errors.Is(err, otp.ErrInvalidCode):
+		h.failed(c, h.lookupPolicy(), throttle.ScopeQuiz, "")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "The passcode is incorrect"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify the passcode"})
+		return
+	}
+
+	token, claims, err := h.quizToken(user, quizPackage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate quiz token"})
+		return
+	}
+	response["quiz_token"] = token
+	response["quiz_token_expires_at"] = claims.ExpiresAt.Time
+	c.JSON(http.StatusOK, response)
+}
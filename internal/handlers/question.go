@@ -1,21 +1,75 @@
 package handlers
 
 import (
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/audit"
 	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/grading"
 	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/questionbank"
+	"mitsuki-jpy-quiz/internal/questionversions"
+	"mitsuki-jpy-quiz/internal/trash"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type QuestionHandler struct{}
 
+// StudentQuestion is the student-facing view of a question. It leaves out
+// the answer key so it can be served while an attempt is still running.
+type StudentQuestion struct {
+	ID            uint                `json:"id"`
+	QuizPackageID uint                `json:"quiz_package_id"`
+	QuestionText  string              `json:"question_text"`
+	QuestionType  models.QuestionType `json:"question_type"`
+	ImageURL      string              `json:"image_url"`
+	Options       string              `json:"options"`
+	Points        int                 `json:"points"`
+	OrderNumber   int                 `json:"order_number"`
+}
+
+// NewStudentQuestions converts questions into their student-facing form
+func NewStudentQuestions(questions []models.Question) []StudentQuestion {
+	result := make([]StudentQuestion, 0, len(questions))
+	for _, q := range questions {
+		result = append(result, StudentQuestion{
+			ID:            q.ID,
+			QuizPackageID: q.QuizPackageID,
+			QuestionText:  q.QuestionText,
+			QuestionType:  q.QuestionType,
+			ImageURL:      q.ImageURL,
+			Options:       q.Options,
+			Points:        q.Points,
+			OrderNumber:   q.OrderNumber,
+		})
+	}
+	return result
+}
+
+// NewServedQuestions converts an attempt's questions into their student-facing
+// form, as the version served and with options in the order that attempt shows them
+func NewServedQuestions(served []questionbank.ServedQuestion) []StudentQuestion {
+	shown := make([]models.Question, len(served))
+	for i := range served {
+		shown[i] = served[i].Shown()
+	}
+	result := NewStudentQuestions(shown)
+	for i := range served {
+		result[i].Options = served[i].ShownOptions()
+	}
+	return result
+}
+
 func NewQuestionHandler() *QuestionHandler {
 	return &QuestionHandler{}
 }
 
-// Create Question (Admin only)
+// Create Question (course teachers)
 func (h *QuestionHandler) CreateQuestion(c *gin.Context) {
 	var question models.Question
 	if err := c.ShouldBindJSON(&question); err != nil {
@@ -35,25 +89,71 @@ func (h *QuestionHandler) CreateQuestion(c *gin.Context) {
 		return
 	}
 
+	if !question.Difficulty.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Difficulty must be easy, medium or hard"})
+		return
+	}
+	question.Tags = strings.Join(question.TagList(), ",")
+
+	// Options and answer key must fit the question type so it can be graded
+	if err := grading.Validate(&question); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Verify quiz package exists
 	var quizPackage models.QuizPackage
 	if err := database.DB.First(&quizPackage, question.QuizPackageID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Quiz package not found"})
 		return
 	}
+	if !authorize(c, quizPackage.CourseID, access.Edit) {
+		return
+	}
 
-	if err := database.DB.Create(&question).Error; err != nil {
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&question).Error; err != nil {
+			return err
+		}
+		return questionversions.Record(tx, &question)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create question"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "question.create", EntityType: "question", EntityID: question.ID, After: question})
 
 	c.JSON(http.StatusCreated, question)
 }
 
-// Get Questions by Quiz Package ID
+// Get Questions by Quiz Package ID (answer key omitted)
 func (h *QuestionHandler) GetQuestionsByPackage(c *gin.Context) {
 	packageID, _ := strconv.Atoi(c.Param("packageId"))
 
+	// Question bank and shuffled packages only reveal the questions drawn for an attempt
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, packageID).Error; err == nil && quizPackage.DrawsPerAttempt() {
+		c.JSON(http.StatusOK, []StudentQuestion{})
+		return
+	}
+
+	var questions []models.Question
+	if err := database.DB.Where("quiz_package_id = ? AND is_active = ?", packageID, true).
+		Order("order_number ASC").
+		Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, NewStudentQuestions(questions))
+}
+
+// Get Questions by Quiz Package ID with answer key (course staff)
+func (h *QuestionHandler) GetQuestionsByPackageAdmin(c *gin.Context) {
+	packageID, _ := strconv.Atoi(c.Param("packageId"))
+	if !authorizeVia(c, access.CourseOfPackage, uint(packageID), access.View, "Quiz package not found") {
+		return
+	}
+
 	var questions []models.Question
 	if err := database.DB.Where("quiz_package_id = ? AND is_active = ?", packageID, true).
 		Order("order_number ASC").
@@ -65,7 +165,7 @@ func (h *QuestionHandler) GetQuestionsByPackage(c *gin.Context) {
 	c.JSON(http.StatusOK, questions)
 }
 
-// Update Question (Admin only)
+// Update Question (course teachers of both packages when it is moved)
 func (h *QuestionHandler) UpdateQuestion(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
@@ -74,11 +174,23 @@ func (h *QuestionHandler) UpdateQuestion(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
 		return
 	}
+	if !authorizeVia(c, access.CourseOfPackage, question.QuizPackageID, access.Edit, "Quiz package not found") {
+		return
+	}
+	packageID := question.QuizPackageID
+	before := question
 
 	if err := c.ShouldBindJSON(&question); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The URL names the record to update; ids in the body, nested records
+	// included, are ignored
+	question.ID, question.CreatedAt = before.ID, before.CreatedAt
+	if question.QuizPackageID != packageID &&
+		!authorizeVia(c, access.CourseOfPackage, question.QuizPackageID, access.Edit, "Quiz package not found") {
+		return
+	}
 
 	// Validate that points are manually set (greater than 0)
 	if question.Points <= 0 {
@@ -92,22 +204,77 @@ func (h *QuestionHandler) UpdateQuestion(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Save(&question).Error; err != nil {
+	if !question.Difficulty.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Difficulty must be easy, medium or hard"})
+		return
+	}
+	question.Tags = strings.Join(question.TagList(), ",")
+
+	// Options and answer key must fit the question type so it can be graded
+	if err := grading.Validate(&question); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Edits never change what earlier attempts were shown: a changed question
+	// gets a new version and old answers keep pointing at theirs
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(&question).Error; err != nil {
+			return err
+		}
+		return questionversions.Record(tx, &question)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "question.update", EntityType: "question", EntityID: question.ID, Before: before, After: question})
 
 	c.JSON(http.StatusOK, question)
 }
 
-// Delete Question (Admin only)
+// GetQuestionVersions returns every version of a question, newest first (course staff)
+func (h *QuestionHandler) GetQuestionVersions(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var question models.Question
+	if err := database.DB.Unscoped().First(&question, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+	if !authorizeVia(c, access.CourseOfPackage, question.QuizPackageID, access.View, "Quiz package not found") {
+		return
+	}
+
+	versions, err := questionversions.List(database.DB, question.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch question versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"question_id":     question.ID,
+		"current_version": question.Version,
+		"versions":        versions,
+	})
+}
+
+// Delete Question (course teachers)
 func (h *QuestionHandler) DeleteQuestion(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	var question models.Question
+	if err := database.DB.First(&question, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+	if !authorizeVia(c, access.CourseOfPackage, question.QuizPackageID, access.Edit, "Quiz package not found") {
+		return
+	}
 
-	if err := database.DB.Delete(&models.Question{}, id).Error; err != nil {
+	if err := trash.Delete(database.DB, trash.Questions, question.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "question.delete", EntityType: "question", EntityID: question.ID, Before: question})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Question deleted successfully"})
 }
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/questionio"
+	"mitsuki-jpy-quiz/internal/questionversions"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Largest import file accepted (5MB, same as image uploads)
+const maxImportSize = 5 * 1024 * 1024
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// ImportQuestions adds questions to a quiz package from a CSV, JSON or GIFT
+// file (course teachers). The file is sent as multipart field "file" or as the raw
+// request body. Nothing is saved if any row is invalid; with ?dry_run=true
+// the rows are only validated.
+func (h *QuestionHandler) ImportQuestions(c *gin.Context) {
+	packageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz package ID"})
+		return
+	}
+
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, uint(packageID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, quizPackage.CourseID, access.Edit) {
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if dryRun {
+		audit.Skip(c)
+	}
+
+	data, filename, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := questionio.ParseFormat(c.Query("format"))
+	if format == "" {
+		format = questionio.FormatFromFilename(filename)
+	}
+	if format == "" {
+		format = formatFromContentType(c.ContentType())
+	}
+	if format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown import format; use format=csv, json or gift"})
+		return
+	}
+
+	rows, err := questionio.Parse(format, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The file contains no questions"})
+		return
+	}
+
+	// Questions without an order go after the package's existing ones
+	var maxOrder int
+	database.DB.Model(&models.Question{}).
+		Where("quiz_package_id = ?", quizPackage.ID).
+		Select("COALESCE(MAX(order_number), 0)").
+		Scan(&maxOrder)
+
+	questions := make([]models.Question, 0, len(rows))
+	rowErrors := []questionio.RowError{}
+	for i, row := range rows {
+		question, errs := questionio.Build(row, quizPackage.ID)
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, questionio.RowError{Row: row.Line, Errors: errs})
+			continue
+		}
+		if question.OrderNumber == 0 {
+			question.OrderNumber = maxOrder + i + 1
+		}
+		questions = append(questions, question)
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run":   true,
+			"format":    format,
+			"total":     len(rows),
+			"valid":     len(questions),
+			"errors":    rowErrors,
+			"questions": questions,
+		})
+		return
+	}
+
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  fmt.Sprintf("%d of %d rows are invalid; nothing was imported", len(rowErrors), len(rows)),
+			"format": format,
+			"total":  len(rows),
+			"valid":  len(questions),
+			"errors": rowErrors,
+		})
+		return
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&questions).Error; err != nil {
+			return err
+		}
+		for i := range questions {
+			if err := questionversions.Record(tx, &questions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import questions"})
+		return
+	}
+	audit.Note(c, audit.Change{
+		Action:     "question.import",
+		EntityType: "quiz_package",
+		EntityID:   quizPackage.ID,
+		After:      gin.H{"format": format, "imported": len(questions), "filename": filename},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   fmt.Sprintf("Imported %d questions", len(questions)),
+		"format":    format,
+		"imported":  len(questions),
+		"questions": questions,
+	})
+}
+
+// ExportQuestions downloads a quiz package's questions as CSV, JSON or GIFT (course staff)
+func (h *QuestionHandler) ExportQuestions(c *gin.Context) {
+	packageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz package ID"})
+		return
+	}
+
+	format := questionio.ParseFormat(c.DefaultQuery("format", questionio.FormatCSV))
+	if format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown export format; use format=csv, json or gift"})
+		return
+	}
+
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, uint(packageID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, quizPackage.CourseID, access.View) {
+		return
+	}
+
+	var questions []models.Question
+	if err := database.DB.Where("quiz_package_id = ?", quizPackage.ID).
+		Order("order_number ASC, id ASC").
+		Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+
+	var buf bytes.Buffer
+	var contentType, extension string
+	switch format {
+	case questionio.FormatCSV:
+		buf.WriteString("\xef\xbb\xbf") // BOM so Excel opens Japanese text as UTF-8
+		err = questionio.WriteCSV(&buf, questions)
+		contentType, extension = "text/csv; charset=utf-8", "csv"
+	case questionio.FormatJSON:
+		err = questionio.WriteJSON(&buf, questions)
+		contentType, extension = "application/json; charset=utf-8", "json"
+	case questionio.FormatGIFT:
+		err = questionio.WriteGIFT(&buf, questions)
+		contentType, extension = "text/plain; charset=utf-8", "gift.txt"
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export questions"})
+		return
+	}
+
+	name := strings.Trim(unsafeFilename.ReplaceAllString(quizPackage.Title, "-"), "-")
+	if name == "" {
+		name = fmt.Sprintf("package-%d", quizPackage.ID)
+	}
+	filename := fmt.Sprintf("%s-questions-%s.%s", name, time.Now().Format("2006-01-02"), extension)
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// readImportFile returns the uploaded file (multipart "file") or the raw body
+func readImportFile(c *gin.Context) ([]byte, string, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize+1024*1024)
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("No import file provided")
+		}
+		if header.Size > maxImportSize {
+			return nil, "", errors.New("File size exceeds 5MB limit")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, "", errors.New("Failed to read import file")
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, "", errors.New("Failed to read import file")
+		}
+		return data, header.Filename, nil
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, "", errors.New("File size exceeds 5MB limit")
+	}
+	if len(data) > maxImportSize {
+		return nil, "", errors.New("File size exceeds 5MB limit")
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, "", errors.New("No import file provided")
+	}
+	return data, "", nil
+}
+
+func formatFromContentType(contentType string) string {
+	switch contentType {
+	case "text/csv", "application/csv":
+		return questionio.FormatCSV
+	case "application/json":
+		return questionio.FormatJSON
+	}
+	return ""
+}
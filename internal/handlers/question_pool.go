@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/questionbank"
+	"mitsuki-jpy-quiz/internal/trash"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QuestionPoolHandler struct{}
+
+func NewQuestionPoolHandler() *QuestionPoolHandler {
+	return &QuestionPoolHandler{}
+}
+
+type QuestionPoolRequest struct {
+	Name        string            `json:"name" binding:"required"`
+	Tag         string            `json:"tag"`
+	Difficulty  models.Difficulty `json:"difficulty"`
+	DrawCount   int               `json:"draw_count" binding:"required,min=1"`
+	OrderNumber int               `json:"order_number"`
+}
+
+// apply validates the request and copies it onto the pool
+func (req *QuestionPoolRequest) apply(pool *models.QuestionPool) string {
+	if !req.Difficulty.IsValid() {
+		return "Difficulty must be easy, medium or hard"
+	}
+	pool.Name = strings.TrimSpace(req.Name)
+	pool.Tag = strings.ToLower(strings.TrimSpace(req.Tag))
+	pool.Difficulty = req.Difficulty
+	pool.DrawCount = req.DrawCount
+	pool.OrderNumber = req.OrderNumber
+	if pool.Name == "" {
+		return "Name is required"
+	}
+	return ""
+}
+
+// withAvailable fills in how many active questions each pool can draw from
+func withAvailable(packageID uint, pools []models.QuestionPool) {
+	counts, err := questionbank.Available(database.DB, packageID, pools)
+	if err != nil {
+		return
+	}
+	for i := range pools {
+		available := counts[pools[i].ID]
+		pools[i].Available = &available
+	}
+}
+
+// ListPools returns a quiz package's question bank pools (course staff)
+func (h *QuestionPoolHandler) ListPools(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, quizPackage.CourseID, access.View) {
+		return
+	}
+
+	pools, err := questionbank.Pools(database.DB, quizPackage.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pools"})
+		return
+	}
+	withAvailable(quizPackage.ID, pools)
+
+	drawn, _ := questionbank.Draw(database.DB, &quizPackage)
+
+	c.JSON(http.StatusOK, gin.H{
+		"quiz_package_id":       quizPackage.ID,
+		"question_bank":         quizPackage.QuestionBank,
+		"questions_per_attempt": len(drawn),
+		"pools":                 pools,
+	})
+}
+
+// CreatePool adds a "draw N" pool to a quiz package (course teachers)
+func (h *QuestionPoolHandler) CreatePool(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, quizPackage.CourseID, access.Edit) {
+		return
+	}
+
+	var req QuestionPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pool := models.QuestionPool{QuizPackageID: quizPackage.ID}
+	if msg := req.apply(&pool); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DB.Create(&pool).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pool"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "question_pool.create", EntityType: "question_pool", EntityID: pool.ID, After: pool})
+
+	pools := []models.QuestionPool{pool}
+	withAvailable(quizPackage.ID, pools)
+
+	c.JSON(http.StatusCreated, pools[0])
+}
+
+// UpdatePool changes a pool's filters or draw count (course teachers)
+func (h *QuestionPoolHandler) UpdatePool(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var pool models.QuestionPool
+	if err := database.DB.First(&pool, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return
+	}
+	if !authorizeVia(c, access.CourseOfPackage, pool.QuizPackageID, access.Edit, "Quiz package not found") {
+		return
+	}
+
+	before := pool
+
+	var req QuestionPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := req.apply(&pool); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DB.Save(&pool).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pool"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "question_pool.update", EntityType: "question_pool", EntityID: pool.ID, Before: before, After: pool})
+
+	pools := []models.QuestionPool{pool}
+	withAvailable(pool.QuizPackageID, pools)
+
+	c.JSON(http.StatusOK, pools[0])
+}
+
+// DeletePool removes a pool (course teachers)
+func (h *QuestionPoolHandler) DeletePool(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var pool models.QuestionPool
+	if err := database.DB.First(&pool, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return
+	}
+	if !authorizeVia(c, access.CourseOfPackage, pool.QuizPackageID, access.Edit, "Quiz package not found") {
+		return
+	}
+
+	if err := trash.Delete(database.DB, trash.Pools, pool.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pool"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "question_pool.delete", EntityType: "question_pool", EntityID: pool.ID, Before: pool})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pool deleted successfully"})
+}
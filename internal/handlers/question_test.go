@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// A teacher cannot overwrite another course's question by putting its id in
+// the body
+func TestUpdateQuestionIgnoresBodyID(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		course := newCourse(t, db, "N5 Grammar")
+		other := newCourse(t, db, "Kanji Basics")
+		pkg := &models.QuizPackage{CourseID: course.ID, Title: "Week 1"}
+		otherPkg := &models.QuizPackage{CourseID: other.ID, Title: "Week 1"}
+		create(t, db, pkg)
+		create(t, db, otherPkg)
+		question := &models.Question{QuizPackageID: pkg.ID, QuestionText: "猫", QuestionType: models.TypeShortAnswer, CorrectAnswer: "ねこ", Points: 1}
+		otherQuestion := &models.Question{QuizPackageID: otherPkg.ID, QuestionText: "犬", QuestionType: models.TypeShortAnswer, CorrectAnswer: "いぬ", Points: 1}
+		create(t, db, question)
+		create(t, db, otherQuestion)
+		teacher := newStaff(t, db, models.RoleTeacher, models.CourseTeacher, course)
+
+		h := NewQuestionHandler()
+		body := map[string]interface{}{
+			"id":              otherQuestion.ID,
+			"quiz_package_id": pkg.ID,
+			"question_text":   "鳥",
+			"question_type":   models.TypeShortAnswer,
+			"correct_answer":  "とり",
+			"points":          2,
+		}
+		var updated models.Question
+		w := serve(t, teacher, "PUT", "/questions/:id", "/questions/"+strconv.Itoa(int(question.ID)), body, h.UpdateQuestion)
+		decode(t, w, http.StatusOK, &updated)
+		if updated.ID != question.ID {
+			t.Errorf("response is question %d, want %d", updated.ID, question.ID)
+		}
+
+		var stored models.Question
+		db.First(&stored, question.ID)
+		if stored.QuestionText != "鳥" || stored.Points != 2 {
+			t.Errorf("question = %q for %d points, want the update", stored.QuestionText, stored.Points)
+		}
+		var untouched models.Question
+		db.First(&untouched, otherQuestion.ID)
+		if untouched.QuizPackageID != otherPkg.ID || untouched.QuestionText != "犬" || untouched.CorrectAnswer != "いぬ" {
+			t.Errorf("other question = package %d %q, want it untouched", untouched.QuizPackageID, untouched.QuestionText)
+		}
+	})
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/analytics"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/cloning"
 	"mitsuki-jpy-quiz/internal/database"
 	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/questionbank"
+	"mitsuki-jpy-quiz/internal/trash"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type QuizPackageHandler struct{}
@@ -15,7 +24,7 @@ func NewQuizPackageHandler() *QuizPackageHandler {
 	return &QuizPackageHandler{}
 }
 
-// Create Quiz Package (Admin only)
+// Create Quiz Package (course teachers)
 func (h *QuizPackageHandler) CreateQuizPackage(c *gin.Context) {
 	var quizPackage models.QuizPackage
 	if err := c.ShouldBindJSON(&quizPackage); err != nil {
@@ -35,17 +44,34 @@ func (h *QuizPackageHandler) CreateQuizPackage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Course not found"})
 		return
 	}
+	if !authorize(c, course.ID, access.Edit) {
+		return
+	}
 
 	if err := database.DB.Create(&quizPackage).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create quiz package"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "quiz_package.create", EntityType: "quiz_package", EntityID: quizPackage.ID, After: quizPackage})
 
 	c.JSON(http.StatusCreated, quizPackage)
 }
 
-// Get Quiz Package by ID
+// Get Quiz Package by ID (answer key omitted)
 func (h *QuizPackageHandler) GetQuizPackage(c *gin.Context) {
+	h.getQuizPackage(c, false)
+}
+
+// Get Quiz Package by ID with answer key (course staff)
+func (h *QuizPackageHandler) GetQuizPackageAdmin(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorizeVia(c, access.CourseOfPackage, uint(id), access.View, "Quiz package not found") {
+		return
+	}
+	h.getQuizPackage(c, true)
+}
+
+func (h *QuizPackageHandler) getQuizPackage(c *gin.Context, includeAnswers bool) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
 	var quizPackage models.QuizPackage
@@ -58,24 +84,36 @@ func (h *QuizPackageHandler) GetQuizPackage(c *gin.Context) {
 	var questionCount int64
 	database.DB.Model(&models.Question{}).Where("quiz_package_id = ?", id).Count(&questionCount)
 
+	var questions interface{} = NewStudentQuestions(quizPackage.Questions)
+	if includeAnswers {
+		questions = quizPackage.Questions
+	} else if quizPackage.DrawsPerAttempt() {
+		// Students only see the questions (and option order) drawn for their attempt
+		questions = []StudentQuestion{}
+		drawn, _ := questionbank.Draw(database.DB, &quizPackage)
+		questionCount = int64(len(drawn))
+	}
+
 	// Return enriched data
 	response := gin.H{
-		"id":             quizPackage.ID,
-		"title":          quizPackage.Title,
-		"course_id":      quizPackage.CourseID,
-		"course_title":   quizPackage.Course.Title,
-		"duration":       quizPackage.Course.ExamTime,
-		"max_retakes":    quizPackage.MaxRetakeCount,
-		"question_count": questionCount,
-		"questions":      quizPackage.Questions,
-		"created_at":     quizPackage.CreatedAt,
-		"updated_at":     quizPackage.UpdatedAt,
+		"id":              quizPackage.ID,
+		"title":           quizPackage.Title,
+		"course_id":       quizPackage.CourseID,
+		"course_title":    quizPackage.Course.Title,
+		"duration":        quizPackage.Course.ExamTime,
+		"max_retakes":     quizPackage.MaxRetakeCount,
+		"question_bank":   quizPackage.QuestionBank,
+		"shuffle_options": quizPackage.ShuffleOptions,
+		"question_count":  questionCount,
+		"questions":       questions,
+		"created_at":      quizPackage.CreatedAt,
+		"updated_at":      quizPackage.UpdatedAt,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-// Update Quiz Package (Admin only)
+// Update Quiz Package (course teachers of both courses when it is moved)
 func (h *QuizPackageHandler) UpdateQuizPackage(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
@@ -84,11 +122,22 @@ func (h *QuizPackageHandler) UpdateQuizPackage(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
 		return
 	}
+	if !authorize(c, quizPackage.CourseID, access.Edit) {
+		return
+	}
+	courseID := quizPackage.CourseID
+	before := quizPackage
 
 	if err := c.ShouldBindJSON(&quizPackage); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The URL names the record to update; ids in the body, nested records
+	// included, are ignored
+	quizPackage.ID, quizPackage.CreatedAt = before.ID, before.CreatedAt
+	if quizPackage.CourseID != courseID && !authorize(c, quizPackage.CourseID, access.Edit) {
+		return
+	}
 
 	// Validate max retake count
 	if quizPackage.MaxRetakeCount < 1 {
@@ -96,22 +145,32 @@ func (h *QuizPackageHandler) UpdateQuizPackage(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Save(&quizPackage).Error; err != nil {
+	if err := database.DB.Omit(clause.Associations).Save(&quizPackage).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quiz package"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "quiz_package.update", EntityType: "quiz_package", EntityID: quizPackage.ID, Before: before, After: quizPackage})
 
 	c.JSON(http.StatusOK, quizPackage)
 }
 
-// Delete Quiz Package (Admin only)
+// Delete Quiz Package (course teachers)
 func (h *QuizPackageHandler) DeleteQuizPackage(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, quizPackage.CourseID, access.Edit) {
+		return
+	}
 
-	if err := database.DB.Delete(&models.QuizPackage{}, id).Error; err != nil {
+	if err := trash.Delete(database.DB, trash.QuizPackages, quizPackage.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete quiz package"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "quiz_package.delete", EntityType: "quiz_package", EntityID: quizPackage.ID, Before: quizPackage})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Quiz package deleted successfully"})
 }
@@ -124,6 +183,9 @@ func (h *QuizPackageHandler) GetQuizPackageStats(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz package ID"})
 		return
 	}
+	if !authorizeVia(c, access.CourseOfPackage, uint(id), access.View, "Quiz package not found") {
+		return
+	}
 
 	// Get all attempts for this quiz package
 	var attempts []models.Attempt
@@ -247,3 +309,98 @@ func (h *QuizPackageHandler) GetQuizPackageStats(c *gin.Context) {
 		"recent_attempts":    recentAttemptsData,
 	})
 }
+
+// GetQuizPackageItemAnalysis returns per-question statistics for a quiz package
+func (h *QuizPackageHandler) GetQuizPackageItemAnalysis(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz package ID"})
+		return
+	}
+
+	var quizPackage models.QuizPackage
+	if err := database.DB.First(&quizPackage, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, quizPackage.CourseID, access.View) {
+		return
+	}
+
+	report, err := analytics.ItemAnalysis(database.DB, quizPackage.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze questions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ClonePackageRequest chooses where a copied quiz package goes
+type ClonePackageRequest struct {
+	CourseID uint   `json:"course_id"` // Defaults to the source package's course
+	Title    string `json:"title"`     // Defaults to "<source title> (Copy)"
+}
+
+// CloneQuizPackage deep-copies a quiz package with its questions and images,
+// optionally into another course (staff who can see the source and edit the
+// target course)
+func (h *QuizPackageHandler) CloneQuizPackage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz package ID"})
+		return
+	}
+
+	var req ClonePackageRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var source models.QuizPackage
+	if err := database.DB.First(&source, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+	if !authorize(c, source.CourseID, access.View) {
+		return
+	}
+
+	if req.CourseID == 0 {
+		req.CourseID = source.CourseID
+	}
+	var course models.Course
+	if err := database.DB.First(&course, req.CourseID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Course not found"})
+		return
+	}
+	if !authorize(c, course.ID, access.Edit) {
+		return
+	}
+
+	var clone *models.QuizPackage
+	var cloner *cloning.Cloner
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		cloner = cloning.New(tx)
+		clone, err = cloner.ClonePackage(source.ID, course.ID, strings.TrimSpace(req.Title))
+		return err
+	}); err != nil {
+		// The transaction can fail before it gets to create the cloner
+		if cloner != nil {
+			cloner.Rollback()
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy quiz package"})
+		return
+	}
+
+	database.DB.Preload("Questions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("order_number ASC, id ASC")
+	}).First(clone, clone.ID)
+
+	audit.Note(c, audit.Change{Action: "quiz_package.clone", EntityType: "quiz_package", EntityID: clone.ID, Before: source, After: clone})
+
+	c.JSON(http.StatusCreated, clone)
+}
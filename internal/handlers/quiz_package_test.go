@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// A teacher cannot overwrite another course's quiz package by putting its id
+// in the body
+func TestUpdateQuizPackageIgnoresBodyID(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		course := newCourse(t, db, "N5 Grammar")
+		other := newCourse(t, db, "Kanji Basics")
+		pkg := &models.QuizPackage{CourseID: course.ID, Title: "Week 1", MaxRetakeCount: 1}
+		otherPkg := &models.QuizPackage{CourseID: other.ID, Title: "Week 1", MaxRetakeCount: 1}
+		create(t, db, pkg)
+		create(t, db, otherPkg)
+		otherQuestion := &models.Question{QuizPackageID: otherPkg.ID, QuestionText: "犬", QuestionType: models.TypeShortAnswer, CorrectAnswer: "いぬ", Points: 1}
+		create(t, db, otherQuestion)
+		teacher := newStaff(t, db, models.RoleTeacher, models.CourseTeacher, course)
+
+		h := NewQuizPackageHandler()
+		body := map[string]interface{}{
+			"id":               otherPkg.ID,
+			"course_id":        course.ID,
+			"title":            "Renamed",
+			"max_retake_count": 2,
+			"questions":        []map[string]interface{}{{"id": otherQuestion.ID, "question_text": "Taken"}},
+		}
+		var updated models.QuizPackage
+		w := serve(t, teacher, "PUT", "/quiz-packages/:id", "/quiz-packages/"+strconv.Itoa(int(pkg.ID)), body, h.UpdateQuizPackage)
+		decode(t, w, http.StatusOK, &updated)
+		if updated.ID != pkg.ID {
+			t.Errorf("response is package %d, want %d", updated.ID, pkg.ID)
+		}
+
+		var stored models.QuizPackage
+		db.First(&stored, pkg.ID)
+		if stored.Title != "Renamed" || stored.MaxRetakeCount != 2 {
+			t.Errorf("package = %q with %d retakes, want the update", stored.Title, stored.MaxRetakeCount)
+		}
+		var untouched models.QuizPackage
+		db.First(&untouched, otherPkg.ID)
+		if untouched.CourseID != other.ID || untouched.Title != "Week 1" {
+			t.Errorf("other package = course %d %q, want it untouched", untouched.CourseID, untouched.Title)
+		}
+		var question models.Question
+		db.First(&question, otherQuestion.ID)
+		if question.QuizPackageID != otherPkg.ID || question.QuestionText != "犬" {
+			t.Errorf("other question = package %d %q, want it untouched", question.QuizPackageID, question.QuestionText)
+		}
+	})
+}
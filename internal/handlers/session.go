@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/sessions"
+	"mitsuki-jpy-quiz/pkg/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"` // Optional if the access token is sent instead
+}
+
+// RefreshSession swaps a refresh token for a new access and refresh token
+func (h *AuthHandler) RefreshSession(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := sessions.Refresh(database.DB, h.Config, req.RefreshToken, sessionClient(c))
+	if errors.Is(err, sessions.ErrReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token was already used; the session has been signed out"})
+		return
+	}
+	if errors.Is(err, sessions.ErrInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionResponse(tokens, user))
+}
+
+// Logout ends the session of the refresh token, or of the access token in the
+// Authorization header. Its access tokens stop working immediately.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var userID uint
+	var sessionID string
+	if req.RefreshToken != "" {
+		if refresh, err := sessions.Find(database.DB, req.RefreshToken); err == nil {
+			userID, sessionID = refresh.UserID, refresh.SessionID
+		}
+	} else if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != "" {
+		if claims, err := utils.ValidateJWT(token, h.Config.JWTSecret); err == nil {
+			userID, sessionID = claims.UserID, claims.SessionID
+		}
+	}
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No session to log out of"})
+		return
+	}
+
+	if err := sessions.End(database.DB, h.Config, userID, sessionID, "logout"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// RevokeUserSessions signs a user out everywhere
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	revoked, err := sessions.EndAll(database.DB, h.Config, user.ID, "admin")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "user.revoke_sessions", EntityType: "user", EntityID: user.ID, After: gin.H{"sessions_revoked": revoked}})
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "All sessions revoked",
+		"user_id":          user.ID,
+		"sessions_revoked": revoked,
+	})
+}
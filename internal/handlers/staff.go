@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"mitsuki-jpy-quiz/config"
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/sessions"
+	"mitsuki-jpy-quiz/internal/throttle"
+	"mitsuki-jpy-quiz/internal/twofactor"
+	"mitsuki-jpy-quiz/pkg/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type StaffHandler struct {
+	Config *config.Config
+	limits
+}
+
+func NewStaffHandler(cfg *config.Config, limiter *throttle.Limiter) *StaffHandler {
+	return &StaffHandler{Config: cfg, limits: limits{Limiter: limiter}}
+}
+
+var staffRoles = []models.UserRole{models.RoleAdmin, models.RoleTeacher, models.RoleAssistant}
+
+type InviteStaffRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Name     string `json:"name" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=admin teacher assistant"`
+	Password string `json:"password"` // A temporary one is generated when empty
+}
+
+type UpdateStaffRequest struct {
+	Name     string `json:"name"`
+	Role     string `json:"role" binding:"omitempty,oneof=admin teacher assistant"`
+	Password string `json:"password"`
+}
+
+type CourseMemberRequest struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"` // Instead of user_id
+	Role   string `json:"role" binding:"required,oneof=owner teacher assistant"`
+}
+
+// StaffMember is a staff account with the courses it works in
+type StaffMember struct {
+	models.User
+	Courses []models.CourseMember `json:"courses"`
+}
+
+// Me returns the signed-in staff member with their role in each course, so
+// the dashboard can show only what they may do, and their two-factor status
+func (h *StaffHandler) Me(c *gin.Context) {
+	userID, _ := currentUser(c)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var members []models.CourseMember
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch courses"})
+		return
+	}
+
+	courseRoles := make(map[uint]models.CourseRole, len(members))
+	for _, member := range members {
+		courseRoles[member.CourseID] = member.Role
+	}
+
+	recoveryCodesLeft, _ := twofactor.RecoveryCodesLeft(database.DB, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":                user,
+		"course_roles":        courseRoles,
+		"two_factor_required": h.Config.RequireStaff2FA,
+		"recovery_codes_left": recoveryCodesLeft,
+	})
+}
+
+// ListStaff returns every admin, teacher and assistant (Admin only)
+func (h *StaffHandler) ListStaff(c *gin.Context) {
+	var users []models.User
+	if err := database.DB.Where("role IN ?", staffRoles).Order("role ASC, name ASC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch staff"})
+		return
+	}
+
+	var members []models.CourseMember
+	if err := database.DB.Preload("Course").Order("course_id ASC").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch staff"})
+		return
+	}
+	byUser := make(map[uint][]models.CourseMember)
+	for _, member := range members {
+		byUser[member.UserID] = append(byUser[member.UserID], member)
+	}
+
+	staff := make([]StaffMember, 0, len(users))
+	for _, user := range users {
+		courses := byUser[user.ID]
+		if courses == nil {
+			courses = []models.CourseMember{}
+		}
+		staff = append(staff, StaffMember{User: user, Courses: courses})
+	}
+
+	c.JSON(http.StatusOK, staff)
+}
+
+// InviteStaff creates a staff account (Admin only). Without a password a
+// temporary one is generated and returned once, to be passed on to them.
+func (h *StaffHandler) InviteStaff(c *gin.Context) {
+	var req InviteStaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Deleted accounts keep their email until they are purged
+	var existing int64
+	database.DB.Unscoped().Model(&models.User{}).Where("email = ?", req.Email).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+		return
+	}
+
+	temporary := req.Password == ""
+	password := req.Password
+	if temporary {
+		var err error
+		if password, err = utils.RandomToken(6); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create password"})
+			return
+		}
+	} else if len(password) < 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 6 characters"})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user := models.User{
+		Email:    req.Email,
+		Password: hashedPassword,
+		Name:     strings.TrimSpace(req.Name),
+		Role:     models.UserRole(req.Role),
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create staff account"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "staff.invite", EntityType: "user", EntityID: user.ID, After: user})
+
+	response := gin.H{"user": user}
+	if temporary {
+		response["temporary_password"] = password
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// findStaff loads the staff account in the :id parameter, or responds with 404
+func findStaff(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := database.DB.Where("id = ? AND role IN ?", c.Param("id"), staffRoles).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff member not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// UpdateStaff renames a staff account, changes its role or resets its
+// password (Admin only). Role and password changes sign it out everywhere.
+func (h *StaffHandler) UpdateStaff(c *gin.Context) {
+	user, ok := findStaff(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateStaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := *user
+	updates := map[string]interface{}{}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		updates["name"] = name
+	}
+
+	role := models.UserRole(req.Role)
+	if role != "" && role != user.Role {
+		if userID, _ := currentUser(c); userID == user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own role"})
+			return
+		}
+		// Assistants may only assist, so their other course roles go first
+		if role == models.RoleAssistant {
+			var higher int64
+			database.DB.Model(&models.CourseMember{}).
+				Where("user_id = ? AND role != ?", user.ID, models.CourseAssistant).
+				Count(&higher)
+			if higher > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "Make them an assistant in all of their courses first"})
+				return
+			}
+		}
+		updates["role"] = role
+	}
+
+	if req.Password != "" {
+		if len(req.Password) < 6 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 6 characters"})
+			return
+		}
+		hashedPassword, err := utils.HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		updates["password"] = hashedPassword
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, gin.H{"user": user})
+		return
+	}
+	if err := database.DB.Model(user).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update staff member"})
+		return
+	}
+	// The password is never serialized, so a reset is logged as its own field
+	after := gin.H{"user": user, "password_reset": updates["password"] != nil}
+	audit.Note(c, audit.Change{Action: "staff.update", EntityType: "user", EntityID: user.ID, Before: gin.H{"user": before, "password_reset": false}, After: after})
+
+	// Access tokens carry the role, so old ones must not outlive a change
+	_, roleChanged := updates["role"]
+	_, passwordChanged := updates["password"]
+	if roleChanged || passwordChanged {
+		if _, err := sessions.EndAll(database.DB, h.Config, user.ID, "admin"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// RemoveStaff deletes a staff account, its course memberships and sessions
+// (Admin only). Sole owners of a course have to hand it over first.
+func (h *StaffHandler) RemoveStaff(c *gin.Context) {
+	user, ok := findStaff(c)
+	if !ok {
+		return
+	}
+	if userID, _ := currentUser(c); userID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove your own account"})
+		return
+	}
+
+	var owned []uint
+	database.DB.Model(&models.CourseMember{}).
+		Where("user_id = ? AND role = ?", user.ID, models.CourseOwner).
+		Pluck("course_id", &owned)
+	for _, courseID := range owned {
+		if owners := countOwners(database.DB, courseID); owners <= 1 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "They are the only owner of a course. Make someone else its owner first.",
+				"course_id": courseID,
+			})
+			return
+		}
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.CourseMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove staff member"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "staff.remove", EntityType: "user", EntityID: user.ID, Before: user})
+
+	if _, err := sessions.EndAll(database.DB, h.Config, user.ID, "admin"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff member removed successfully"})
+}
+
+// countOwners returns how many owners a course has
+func countOwners(db *gorm.DB, courseID uint) int64 {
+	var owners int64
+	db.Model(&models.CourseMember{}).Where("course_id = ? AND role = ?", courseID, models.CourseOwner).Count(&owners)
+	return owners
+}
+
+// courseParam parses the :id parameter and checks the permission on that course
+func courseParam(c *gin.Context, permission access.Permission) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return 0, false
+	}
+	var course models.Course
+	if err := database.DB.First(&course, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return 0, false
+	}
+	return course.ID, authorize(c, course.ID, permission)
+}
+
+// checkCourseRole responds with 400 if the account cannot hold the course role
+func checkCourseRole(c *gin.Context, user *models.User, role models.CourseRole) bool {
+	if user.Role == models.RoleAssistant && role != models.CourseAssistant {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Assistant accounts can only be course assistants"})
+		return false
+	}
+	return true
+}
+
+// ListCourseMembers returns the staff of a course (course staff)
+func (h *StaffHandler) ListCourseMembers(c *gin.Context) {
+	courseID, ok := courseParam(c, access.View)
+	if !ok {
+		return
+	}
+
+	var members []models.CourseMember
+	if err := database.DB.Preload("User").
+		Where("course_id = ?", courseID).
+		Order("role ASC, id ASC").
+		Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch course staff"})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// AddCourseMember gives a teacher or assistant a role in a course (course owners)
+func (h *StaffHandler) AddCourseMember(c *gin.Context) {
+	courseID, ok := courseParam(c, access.Manage)
+	if !ok {
+		return
+	}
+
+	var req CourseMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Admins can already do everything, so only teachers and assistants join courses
+	var user models.User
+	query := database.DB.Where("role IN ?", []models.UserRole{models.RoleTeacher, models.RoleAssistant})
+	if req.UserID != 0 {
+		query = query.Where("id = ?", req.UserID)
+	} else {
+		query = query.Where("email = ?", strings.TrimSpace(req.Email))
+	}
+	if err := query.First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No teacher or assistant with that account"})
+		return
+	}
+
+	role := models.CourseRole(req.Role)
+	if !checkCourseRole(c, &user, role) {
+		return
+	}
+
+	var existing int64
+	database.DB.Model(&models.CourseMember{}).Where("course_id = ? AND user_id = ?", courseID, user.ID).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already a member of this course"})
+		return
+	}
+
+	member := models.CourseMember{CourseID: courseID, UserID: user.ID, Role: role}
+	if err := database.DB.Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add course staff"})
+		return
+	}
+	member.User = user
+	audit.Note(c, audit.Change{Action: "course_member.add", EntityType: "course_member", EntityID: member.ID, After: member})
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// findCourseMember loads the membership of :userId in the course, or responds with 404
+func findCourseMember(c *gin.Context, courseID uint) (*models.CourseMember, bool) {
+	var member models.CourseMember
+	if err := database.DB.Preload("User").
+		Where("course_id = ? AND user_id = ?", courseID, c.Param("userId")).
+		First(&member).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not a member of this course"})
+		return nil, false
+	}
+	return &member, true
+}
+
+// UpdateCourseMember changes a staff member's role in a course (course owners)
+func (h *StaffHandler) UpdateCourseMember(c *gin.Context) {
+	courseID, ok := courseParam(c, access.Manage)
+	if !ok {
+		return
+	}
+	member, ok := findCourseMember(c, courseID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required,oneof=owner teacher assistant"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.CourseRole(req.Role)
+	if !checkCourseRole(c, &member.User, role) {
+		return
+	}
+	if member.Role == models.CourseOwner && role != models.CourseOwner && countOwners(database.DB, courseID) <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A course needs at least one owner"})
+		return
+	}
+
+	before := *member
+	if err := database.DB.Model(member).Update("role", role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update course staff"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "course_member.update", EntityType: "course_member", EntityID: member.ID, Before: before, After: member})
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveCourseMember takes a staff member off a course (course owners)
+func (h *StaffHandler) RemoveCourseMember(c *gin.Context) {
+	courseID, ok := courseParam(c, access.Manage)
+	if !ok {
+		return
+	}
+	member, ok := findCourseMember(c, courseID)
+	if !ok {
+		return
+	}
+
+	if member.Role == models.CourseOwner && countOwners(database.DB, courseID) <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A course needs at least one owner"})
+		return
+	}
+
+	if err := database.DB.Delete(member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove course staff"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "course_member.remove", EntityType: "course_member", EntityID: member.ID, Before: member})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Removed from the course"})
+}
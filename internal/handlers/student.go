@@ -1,21 +1,38 @@
 package handlers
 
 import (
+	"errors"
 	"log"
+	"mitsuki-jpy-quiz/config"
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/attempts"
+	"mitsuki-jpy-quiz/internal/audit"
 	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/enrollments"
+	"mitsuki-jpy-quiz/internal/grading"
 	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/questionbank"
+	"mitsuki-jpy-quiz/internal/questionversions"
+	"mitsuki-jpy-quiz/pkg/utils"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-type StudentHandler struct{}
+type StudentHandler struct {
+	Config *config.Config
+}
+
+func NewStudentHandler(cfg *config.Config) *StudentHandler {
+	return &StudentHandler{Config: cfg}
+}
 
-func NewStudentHandler() *StudentHandler {
-	return &StudentHandler{}
+// gracePeriod is how long after the deadline answers are still accepted
+func (h *StudentHandler) gracePeriod() time.Duration {
+	return time.Duration(h.Config.ExamGraceSeconds) * time.Second
 }
 
 type StartQuizRequest struct {
@@ -27,6 +44,8 @@ type SubmitAnswerRequest struct {
 	AttemptID     uint   `json:"attempt_id" binding:"required"`
 	QuestionID    uint   `json:"question_id" binding:"required"`
 	StudentAnswer string `json:"student_answer" binding:"required"`
+
+	TimeSpentSeconds int `json:"time_spent_seconds" binding:"min=0"` // Time on the question since the last save
 }
 
 // Start Quiz Attempt
@@ -53,13 +72,20 @@ func (h *StudentHandler) StartQuiz(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
 		return
 	}
+	// The deadline comes from the course, so it must be the package's own
+	if quizPackage.CourseID != course.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quiz package does not belong to this course"})
+		return
+	}
 
-	// Count previous attempts
-	var attemptCount int64
+	// Count previous attempts. This quiz cannot resume an attempt, so running
+	// ones count as well; otherwise several could be open at once.
+	var running int64
 	database.DB.Model(&models.Attempt{}).Where(
-		"student_id = ? AND course_id = ? AND quiz_package_id = ?",
-		studentID, req.CourseID, req.QuizPackageID,
-	).Count(&attemptCount)
+		"student_id = ? AND quiz_package_id = ? AND status = ?",
+		studentID, req.QuizPackageID, models.StatusInProgress,
+	).Count(&running)
+	attemptCount := attempts.RetakesUsed(database.DB, studentID, req.QuizPackageID) + int(running)
 
 	// Check against quiz package's max retake count
 	maxRetakes := quizPackage.MaxRetakeCount
@@ -67,48 +93,54 @@ func (h *StudentHandler) StartQuiz(c *gin.Context) {
 		maxRetakes = 1 // Default fallback
 	}
 
-	if int(attemptCount) >= maxRetakes {
+	if attemptCount >= maxRetakes {
 		c.JSON(http.StatusForbidden, gin.H{
 			"error":            "Maximum retake limit reached for this quiz package",
 			"max_retakes":      maxRetakes,
-			"current_attempts": int(attemptCount),
+			"current_attempts": attemptCount,
 		})
 		return
 	}
 
-	// Get total points for this quiz
-	var totalPoints int64
-	database.DB.Model(&models.Question{}).
-		Where("quiz_package_id = ?", req.QuizPackageID).
-		Select("COALESCE(SUM(points), 0)").
-		Scan(&totalPoints)
+	// Pick the questions for this attempt (a random draw in question bank mode)
+	questions, err := questionbank.Draw(database.DB, &quizPackage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load questions"})
+		return
+	}
 
-	// Create new attempt
+	// Create new attempt with a server-side deadline
+	startTime := time.Now()
+	deadline := attempts.Deadline(startTime, course.ExamTime)
 	attempt := models.Attempt{
 		StudentID:     studentID,
 		CourseID:      req.CourseID,
 		QuizPackageID: req.QuizPackageID,
 		Status:        models.StatusInProgress,
-		StartTime:     time.Now(),
-		AttemptCount:  int(attemptCount) + 1,
-		TotalPoints:   int(totalPoints),
+		StartTime:     startTime,
+		Deadline:      &deadline,
+		AttemptCount:  attemptCount + 1,
+		TotalPoints:   questionbank.TotalPoints(questions),
 	}
 
-	if err := database.DB.Create(&attempt).Error; err != nil {
+	var served []questionbank.ServedQuestion
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		served, err = questionbank.Record(tx, attempt.ID, questions, quizPackage.ShuffleOptions)
+		return err
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start quiz"})
 		return
 	}
 
-	// Get questions for this quiz
-	var questions []models.Question
-	database.DB.Where("quiz_package_id = ? AND is_active = ?", req.QuizPackageID, true).
-		Order("order_number ASC").
-		Find(&questions)
-
 	c.JSON(http.StatusCreated, gin.H{
-		"attempt":   attempt,
-		"questions": questions,
-		"exam_time": course.ExamTime,
+		"attempt":        attempt,
+		"questions":      NewServedQuestions(served),
+		"exam_time":      course.ExamTime,
+		"deadline":       deadline,
+		"time_remaining": int(time.Until(deadline).Seconds()),
 	})
 }
 
@@ -131,48 +163,76 @@ func (h *StudentHandler) SubmitAnswer(c *gin.Context) {
 		return
 	}
 
-	// Get question
-	var question models.Question
-	if err := database.DB.First(&question, req.QuestionID).Error; err != nil {
+	// Refuse answers once the deadline and grace period have passed
+	if attempts.IsExpired(&attempt, time.Now(), h.gracePeriod()) {
+		if err := attempts.Finalize(database.DB, &attempt, *attempt.Deadline); err != nil {
+			log.Printf("Failed to auto-complete expired attempt %d: %v", attempt.ID, err)
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    "Time is up for this attempt",
+			"status":   attempt.Status,
+			"deadline": attempt.Deadline,
+		})
+		return
+	}
+
+	// Get question (must be one served to this attempt)
+	served, err := questionbank.ForAttempt(database.DB, &attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load questions"})
+		return
+	}
+	var question *questionbank.ServedQuestion
+	for i := range served {
+		if served[i].ID == req.QuestionID {
+			question = &served[i]
+			break
+		}
+	}
+	if question == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
 		return
 	}
 
+	// Letters refer to the options this attempt was shown; store the option itself
+	shown := question.Shown()
+	studentAnswer := grading.Resolve(&shown, req.StudentAnswer, question.OptionOrder)
+
 	// Check if answer already exists (update) or create new
 	var answer models.Answer
-	isCorrect := strings.TrimSpace(strings.ToLower(req.StudentAnswer)) ==
-		strings.TrimSpace(strings.ToLower(question.CorrectAnswer))
+	isCorrect, pointsEarned := question.Grade(studentAnswer)
 
-	pointsEarned := 0
-	if isCorrect {
-		pointsEarned = question.Points
-	}
-
-	err := database.DB.Where("attempt_id = ? AND question_id = ?", req.AttemptID, req.QuestionID).
+	err = database.DB.Where("attempt_id = ? AND question_id = ?", req.AttemptID, req.QuestionID).
 		First(&answer).Error
 
 	if err != nil {
 		// Create new answer
 		answer = models.Answer{
-			AttemptID:     req.AttemptID,
-			QuestionID:    req.QuestionID,
-			StudentAnswer: req.StudentAnswer,
-			IsCorrect:     isCorrect,
-			PointsEarned:  pointsEarned,
+			AttemptID:         req.AttemptID,
+			QuestionID:        req.QuestionID,
+			StudentAnswer:     studentAnswer,
+			IsCorrect:         isCorrect,
+			PointsEarned:      pointsEarned,
+			TimeSpentSeconds:  req.TimeSpentSeconds,
+			QuestionVersionID: question.VersionID(),
 		}
 		database.DB.Create(&answer)
 	} else {
 		// Update existing answer
-		answer.StudentAnswer = req.StudentAnswer
+		answer.StudentAnswer = studentAnswer
+		answer.QuestionVersionID = question.VersionID()
 		answer.IsCorrect = isCorrect
 		answer.PointsEarned = pointsEarned
+		answer.TimeSpentSeconds += req.TimeSpentSeconds
 		database.DB.Save(&answer)
 	}
 
+	// Grading stays hidden until the attempt is completed
 	c.JSON(http.StatusOK, gin.H{
-		"answer":        answer,
-		"is_correct":    isCorrect,
-		"points_earned": pointsEarned,
+		"message":        "Answer saved",
+		"attempt_id":     answer.AttemptID,
+		"question_id":    answer.QuestionID,
+		"student_answer": answer.StudentAnswer,
 	})
 }
 
@@ -190,29 +250,37 @@ func (h *StudentHandler) CompleteQuiz(c *gin.Context) {
 		return
 	}
 
-	// Calculate total score
-	var totalScore int64
-	database.DB.Model(&models.Answer{}).
-		Where("attempt_id = ?", attemptID).
-		Select("COALESCE(SUM(points_earned), 0)").
-		Scan(&totalScore)
+	if attempt.Status == models.StatusAbandoned {
+		c.JSON(http.StatusConflict, gin.H{"error": "This attempt was closed because time ran out"})
+		return
+	}
 
-	// Update attempt
-	now := time.Now()
-	attempt.Status = models.StatusCompleted
-	attempt.EndTime = &now
-	attempt.Score = int(totalScore)
+	// A late completion is closed at the deadline
+	autoClosed := false
+	if attempt.Status == models.StatusInProgress {
+		endTime := time.Now()
+		if attempts.IsExpired(&attempt, endTime, h.gracePeriod()) {
+			endTime = *attempt.Deadline
+			autoClosed = true
+		}
 
-	if err := database.DB.Save(&attempt).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete quiz"})
-		return
+		if err := attempts.Finalize(database.DB, &attempt, endTime); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete quiz"})
+			return
+		}
+	}
+
+	percentage := 0.0
+	if attempt.TotalPoints > 0 {
+		percentage = float64(attempt.Score) / float64(attempt.TotalPoints) * 100
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"attempt":      attempt,
 		"score":        attempt.Score,
 		"total_points": attempt.TotalPoints,
-		"percentage":   float64(attempt.Score) / float64(attempt.TotalPoints) * 100,
+		"percentage":   percentage,
+		"auto_closed":  autoClosed,
 	})
 }
 
@@ -243,9 +311,111 @@ func (h *StudentHandler) GetAttemptDetail(c *gin.Context) {
 		return
 	}
 
+	// Don't reveal grading while the attempt is still running
+	if attempt.Status != models.StatusCompleted {
+		for i := range attempt.Answers {
+			attempt.Answers[i].IsCorrect = false
+			attempt.Answers[i].PointsEarned = 0
+		}
+	}
+
 	c.JSON(http.StatusOK, attempt)
 }
 
+// Review Completed Attempt - reveals the answer key for the student's own attempt
+func (h *StudentHandler) ReviewAttempt(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	studentID := userID.(uint)
+	attemptID, _ := strconv.Atoi(c.Param("attemptId"))
+
+	var attempt models.Attempt
+	if err := database.DB.Preload("Answers").
+		Where("id = ? AND student_id = ?", attemptID, studentID).
+		First(&attempt).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	}
+
+	if attempt.Status != models.StatusCompleted {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Answers are only available after the attempt is completed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempt":   attempt,
+		"questions": buildAttemptReview(&attempt),
+	})
+}
+
+// buildAttemptReview pairs each question served to the attempt with the
+// student's answer and the answer key.
+func buildAttemptReview(attempt *models.Attempt) []gin.H {
+	questions, _ := questionbank.ForAttempt(database.DB, attempt)
+
+	answerLookup := make(map[uint]models.Answer, len(attempt.Answers))
+	for _, answer := range attempt.Answers {
+		answerLookup[answer.QuestionID] = answer
+	}
+
+	// Include questions that were answered but have since been removed
+	listed := make(map[uint]bool, len(questions))
+	for _, question := range questions {
+		listed[question.ID] = true
+	}
+	var missingIDs []uint
+	for questionID := range answerLookup {
+		if !listed[questionID] {
+			missingIDs = append(missingIDs, questionID)
+		}
+	}
+	if len(missingIDs) > 0 {
+		var removed []models.Question
+		database.DB.Unscoped().Where("id IN ?", missingIDs).Find(&removed)
+		for _, question := range removed {
+			questions = append(questions, questionbank.ServedQuestion{Question: question})
+		}
+	}
+
+	// Show each question as the version the student answered
+	var versionIDs []uint
+	for _, answer := range answerLookup {
+		if answer.QuestionVersionID != nil {
+			versionIDs = append(versionIDs, *answer.QuestionVersionID)
+		}
+	}
+	versions, _ := questionversions.Find(database.DB, versionIDs)
+	for i := range questions {
+		answer := answerLookup[questions[i].ID]
+		if answer.QuestionVersionID == nil {
+			continue
+		}
+		if version, ok := versions[*answer.QuestionVersionID]; ok {
+			questions[i].Version = &version
+		}
+	}
+
+	review := make([]gin.H, 0, len(questions))
+	for _, question := range questions {
+		answer := answerLookup[question.ID]
+		shown := question.Shown()
+		review = append(review, gin.H{
+			"question_id":    question.ID,
+			"question_text":  shown.QuestionText,
+			"question_type":  shown.QuestionType,
+			"image_url":      shown.ImageURL,
+			"options":        question.ShownOptions(),
+			"version":        shown.Version,
+			"points":         question.Points,
+			"student_answer": answer.StudentAnswer,
+			"correct_answer": grading.CorrectAnswer(&question.Question),
+			"is_correct":     answer.IsCorrect,
+			"points_earned":  answer.PointsEarned,
+			"review_comment": answer.ReviewComment,
+		})
+	}
+	return review
+}
+
 // Public Quiz Submission (No Authentication Required)
 type PublicQuizSubmission struct {
 	StudentName   string `json:"student_name" binding:"required"`
@@ -294,21 +464,46 @@ func (h *StudentHandler) GetTotalStudentCount(c *gin.Context) {
 	})
 }
 
-// Get Courses with Enrollment Stats (Admin only)
+// staffStudents limits a query on users to the students who enrolled in or
+// took a quiz in the signed-in staff member's courses
+func staffStudents(c *gin.Context, db *gorm.DB) (*gorm.DB, bool) {
+	userID, role := currentUser(c)
+	courseIDs, all, err := access.Courses(database.DB, userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return nil, false
+	}
+	if all {
+		return db, true
+	}
+	courseIDs = append(courseIDs, 0)
+	return db.Where("users.id IN (?) OR users.id IN (?)",
+		database.DB.Model(&models.Enrollment{}).Select("student_id").Where("course_id IN ?", courseIDs),
+		database.DB.Model(&models.Attempt{}).Select("student_id").Where("course_id IN ?", courseIDs),
+	), true
+}
+
+// Get the staff member's courses with Enrollment Stats
 func (h *StudentHandler) GetCoursesWithStudentCount(c *gin.Context) {
 	var courses []models.Course
 
-	// Get all courses
-	if err := database.DB.Find(&courses).Error; err != nil {
+	// Get the courses this staff member works in
+	query, ok := staffCourses(c, database.DB, "id")
+	if !ok {
+		return
+	}
+	if err := query.Find(&courses).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch courses"})
 		return
 	}
 
 	// Get total unique student count
+	students, ok := staffStudents(c, database.DB.Model(&models.User{}))
+	if !ok {
+		return
+	}
 	var totalStudentCount int64
-	database.DB.Model(&models.User{}).
-		Where("role = ?", models.RoleStudent).
-		Count(&totalStudentCount)
+	students.Where("role = ?", models.RoleStudent).Count(&totalStudentCount)
 
 	type CourseWithStudentCount struct {
 		ID                uint      `json:"id"`
@@ -365,7 +560,7 @@ func (h *StudentHandler) GetCoursesWithStudentCount(c *gin.Context) {
 	})
 }
 
-// Get Students by Course (Admin only)
+// Get Students by Course (course staff)
 func (h *StudentHandler) GetStudentsByCourse(c *gin.Context) {
 	courseID := c.Param("courseId")
 
@@ -375,6 +570,9 @@ func (h *StudentHandler) GetStudentsByCourse(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
 		return
 	}
+	if !authorize(c, course.ID, access.View) {
+		return
+	}
 
 	// Get all attempts for this course
 	var attempts []models.Attempt
@@ -471,7 +669,7 @@ func (h *StudentHandler) GetStudentsByCourse(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// List All Students (Admin only) - Keep for backward compatibility
+// List Students (all for admins, those of their courses for other staff) - Keep for backward compatibility
 func (h *StudentHandler) ListStudents(c *gin.Context) {
 	type StudentWithCourse struct {
 		ID          uint      `json:"id"`
@@ -485,24 +683,27 @@ func (h *StudentHandler) ListStudents(c *gin.Context) {
 	var results []StudentWithCourse
 
 	// Get ALL students (both registered with enrollments and guest quiz takers)
-	// Uses GROUP_CONCAT to show multiple course enrollments in one row per student
-	query := `
-		SELECT 
-			u.id,
-			u.name,
-			u.email,
-			u.phone_number,
-			COALESCE(GROUP_CONCAT(c.title, ', '), 'No Course') as course_name,
-			u.created_at
-		FROM users u
-		LEFT JOIN enrollments e ON u.id = e.student_id AND e.status IN ('pending', 'approved')
-		LEFT JOIN courses c ON e.course_id = c.id
-		WHERE u.role = 'student'
-		GROUP BY u.id, u.name, u.email, u.phone_number, u.created_at
-		ORDER BY u.created_at DESC
-	`
-
-	if err := database.DB.Raw(query).Scan(&results).Error; err != nil {
+	// Uses GROUP_CONCAT (STRING_AGG on PostgreSQL) to show multiple course enrollments in one row per student
+	query := database.DB.Table("users").
+		Select(`users.id,
+			users.name,
+			users.email,
+			users.phone_number,
+			COALESCE(` + database.GroupConcat("c.title", ", ") + `, 'No Course') as course_name,
+			users.created_at`).
+		Joins("LEFT JOIN enrollments e ON users.id = e.student_id AND e.status IN ('pending', 'approved')").
+		Joins("LEFT JOIN courses c ON e.course_id = c.id").
+		Where("users.role = 'student'").
+		Group("users.id, users.name, users.email, users.phone_number, users.created_at").
+		Order("users.created_at DESC")
+
+	// Teachers and assistants only see the students of their own courses
+	query, ok := staffStudents(c, query)
+	if !ok {
+		return
+	}
+
+	if err := query.Scan(&results).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
 		return
 	}
@@ -521,21 +722,64 @@ func (h *StudentHandler) DeleteStudent(c *gin.Context) {
 		return
 	}
 
-	// Delete all student's attempts and answers first
-	database.DB.Where("student_id = ?", studentID).Delete(&models.Attempt{})
+	// Remember which full courses lose an approved seat
+	var seatCourseIDs []uint
+	database.DB.Model(&models.Enrollment{}).
+		Where("student_id = ? AND status = ?", studentID, models.EnrollmentApproved).
+		Pluck("course_id", &seatCourseIDs)
+
+	var fullCourseIDs []uint
+	for _, courseID := range seatCourseIDs {
+		var course models.Course
+		if err := database.DB.First(&course, courseID).Error; err == nil && enrollments.IsFull(database.DB, &course) {
+			fullCourseIDs = append(fullCourseIDs, courseID)
+		}
+	}
 
-	// Delete the student
-	if err := database.DB.Delete(&student).Error; err != nil {
+	// Delete the student with their answers, attempts and enrollments, all or nothing
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		attemptIDs := tx.Model(&models.Attempt{}).Select("id").Where("student_id = ?", student.ID)
+		if err := tx.Where("attempt_id IN (?)", attemptIDs).Delete(&models.Answer{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("student_id = ?", student.ID).Delete(&models.Attempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("student_id = ?", student.ID).Delete(&models.Enrollment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&student).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete student"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "student.delete", EntityType: "user", EntityID: student.ID, Before: student})
+
+	// Hand the freed seats to the next students in line
+	promotedCount := 0
+	for _, courseID := range fullCourseIDs {
+		promoted, err := enrollments.PromoteWaiting(database.DB, courseID, 1)
+		if err != nil {
+			log.Printf("Failed to promote waitlisted students for course %d: %v", courseID, err)
+			continue
+		}
+		promotedCount += len(promoted)
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Student deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Student deleted successfully",
+		"promoted": promotedCount,
+	})
 }
 
-// Get Enrollments by Course (Admin only)
+// Get Enrollments by Course (course staff)
 func (h *StudentHandler) GetEnrollmentsByCourse(c *gin.Context) {
 	courseID := c.Param("courseId")
+	id, _ := strconv.Atoi(courseID)
+	if !authorize(c, uint(id), access.View) {
+		return
+	}
 
 	type EnrollmentDetail struct {
 		ID          uint      `json:"id"`
@@ -600,12 +844,12 @@ func (h *StudentHandler) GetEnrollmentsByCourse(c *gin.Context) {
 	c.JSON(http.StatusOK, details)
 }
 
-// Update Enrollment Status (Admin only)
+// Update Enrollment Status (course assistants and up)
 func (h *StudentHandler) UpdateEnrollmentStatus(c *gin.Context) {
 	enrollmentID := c.Param("enrollmentId")
 
 	var req struct {
-		Status string `json:"status" binding:"required,oneof=approved declined pending"`
+		Status string `json:"status" binding:"required,oneof=approved declined pending waitlisted"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -618,35 +862,351 @@ func (h *StudentHandler) UpdateEnrollmentStatus(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Enrollment not found"})
 		return
 	}
+	if !authorize(c, enrollment.CourseID, access.Grade) {
+		return
+	}
 
-	enrollment.Status = models.EnrollmentStatus(req.Status)
-	if err := database.DB.Save(&enrollment).Error; err != nil {
+	previousStatus := enrollment.Status
+	before := enrollment
+	newStatus := models.EnrollmentStatus(req.Status)
+
+	var course models.Course
+	if err := database.DB.First(&course, enrollment.CourseID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
+	wasFull := enrollments.IsFull(database.DB, &course)
+
+	// Approval has to fit under the course's student limit
+	if newStatus == models.EnrollmentApproved {
+		if err := enrollments.Approve(database.DB, &enrollment); err != nil {
+			if errors.Is(err, enrollments.ErrCourseFull) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":     "Course is full. Decline an approved student or raise the student limit first.",
+					"course_id": enrollment.CourseID,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update enrollment status"})
+			return
+		}
+		audit.Note(c, audit.Change{Action: "enrollment.approve", EntityType: "enrollment", EntityID: enrollment.ID, Before: before, After: enrollment})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Enrollment status updated successfully",
+			"status":  req.Status,
+		})
+		return
+	}
+
+	enrollment.Status = newStatus
+	if err := database.DB.Model(&enrollment).Update("status", newStatus).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update enrollment status"})
 		return
 	}
+	audit.Note(c, audit.Change{Action: "enrollment." + req.Status, EntityType: "enrollment", EntityID: enrollment.ID, Before: before, After: enrollment})
+
+	// A seat opened up in a full course, promote the next student in line
+	var promoted []models.Enrollment
+	if previousStatus == models.EnrollmentApproved && wasFull {
+		var err error
+		promoted, err = enrollments.PromoteWaiting(database.DB, enrollment.CourseID, 1)
+		if err != nil {
+			log.Printf("Failed to promote waitlisted students for course %d: %v", enrollment.CourseID, err)
+		}
+	}
+
+	promotedIDs := make([]uint, 0, len(promoted))
+	for _, p := range promoted {
+		promotedIDs = append(promotedIDs, p.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Enrollment status updated successfully",
+		"status":   req.Status,
+		"promoted": promotedIDs,
+	})
+}
+
+// checkQuizToken verifies the token issued by the phone check against the
+// student, course and quiz package of a request, and that it has not already
+// completed an attempt. It responds with the error and returns nil when the
+// token is refused.
+func (h *StudentHandler) checkQuizToken(c *gin.Context, token string, studentID, courseID, quizPackageID uint) *utils.QuizClaims {
+	claims, err := utils.ValidateQuizToken(token, h.Config.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired quiz token, please verify your phone number again"})
+		return nil
+	}
+	if claims.StudentID != studentID || claims.CourseID != courseID || claims.QuizPackageID != quizPackageID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Quiz token was not issued for this student and quiz"})
+		return nil
+	}
+
+	var used int64
+	database.DB.Unscoped().Model(&models.Attempt{}).Where("quiz_token_id = ?", claims.ID).Count(&used)
+	if used > 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Quiz token has already been used, please verify your phone number again"})
+		return nil
+	}
+	return claims
+}
+
+// DrawQuizRequest identifies the registered student starting the public quiz
+type DrawQuizRequest struct {
+	StudentID     uint   `json:"student_id" binding:"required"`
+	CourseID      uint   `json:"course_id" binding:"required"`
+	QuizPackageID uint   `json:"quiz_package_id" binding:"required"`
+	QuizToken     string `json:"quiz_token" binding:"required"` // From /api/quiz/check-phone
+}
+
+// DrawRegisteredStudentQuiz starts a server-side attempt for the public quiz
+// page and returns the questions drawn for it. An unfinished attempt is
+// resumed instead, so reloading the page does not re-roll the questions.
+func (h *StudentHandler) DrawRegisteredStudentQuiz(c *gin.Context) {
+	var req DrawQuizRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if h.checkQuizToken(c, req.QuizToken, req.StudentID, req.CourseID, req.QuizPackageID) == nil {
+		return
+	}
+
+	var student models.User
+	if err := database.DB.First(&student, req.StudentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	var course models.Course
+	if err := database.DB.First(&course, req.CourseID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
+
+	var quizPackage models.QuizPackage
+	if err := database.DB.Where("id = ? AND course_id = ?", req.QuizPackageID, req.CourseID).
+		First(&quizPackage).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
+		return
+	}
+
+	// Attempts that ran out while the student was away are closed first, so
+	// their autosaved answers are scored and count towards the retake limit
+	cutoff := time.Now().Add(-h.gracePeriod())
+	var expired []models.Attempt
+	database.DB.Where("student_id = ? AND quiz_package_id = ? AND status = ? AND deadline <= ?",
+		req.StudentID, req.QuizPackageID, models.StatusInProgress, cutoff).
+		Find(&expired)
+	for i := range expired {
+		if err := attempts.Close(database.DB, &expired[i]); err != nil {
+			log.Printf("Failed to close expired attempt %d: %v", expired[i].ID, err)
+		}
+	}
+
+	// Resume the student's running attempt if there is one, with the answers
+	// saved so far
+	var attempt models.Attempt
+	err := database.DB.Where("student_id = ? AND quiz_package_id = ? AND status = ? AND deadline > ?",
+		req.StudentID, req.QuizPackageID, models.StatusInProgress, cutoff).
+		Order("id DESC").
+		First(&attempt).Error
+	if err == nil {
+		questions, err := questionbank.ForAttempt(database.DB, &attempt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load questions"})
+			return
+		}
+		saved := []models.Answer{}
+		if err := database.DB.Where("attempt_id = ?", attempt.ID).Find(&saved).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load saved answers"})
+			return
+		}
+		c.JSON(http.StatusOK, drawResponse(&attempt, questions, saved))
+		return
+	}
+
+	// Same retake rule as check-phone and the submission
+	attemptCount := attempts.RetakesUsed(database.DB, req.StudentID, req.QuizPackageID)
+
+	maxRetakes := quizPackage.MaxRetakeCount
+	if maxRetakes == 0 {
+		maxRetakes = 1 // Default fallback
+	}
+
+	if attemptCount >= maxRetakes {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Maximum retry limit reached",
+			"message":          "You have already taken this quiz the maximum number of times allowed.",
+			"max_retakes":      maxRetakes,
+			"current_attempts": attemptCount,
+		})
+		return
+	}
+
+	questions, err := questionbank.Draw(database.DB, &quizPackage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load questions"})
+		return
+	}
+
+	startTime := time.Now()
+	deadline := attempts.Deadline(startTime, course.ExamTime)
+	attempt = models.Attempt{
+		StudentID:     req.StudentID,
+		CourseID:      req.CourseID,
+		QuizPackageID: req.QuizPackageID,
+		Status:        models.StatusInProgress,
+		StartTime:     startTime,
+		Deadline:      &deadline,
+		AttemptCount:  attemptCount + 1,
+		TotalPoints:   questionbank.TotalPoints(questions),
+	}
+
+	var served []questionbank.ServedQuestion
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		served, err = questionbank.Record(tx, attempt.ID, questions, quizPackage.ShuffleOptions)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start quiz"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, drawResponse(&attempt, served, nil))
+}
+
+// drawResponse describes a drawn attempt. saved is nil for a new attempt; when
+// resuming it holds the answers saved so far (without grading) to restore.
+func drawResponse(attempt *models.Attempt, served []questionbank.ServedQuestion, saved []models.Answer) gin.H {
+	answers := make([]gin.H, 0, len(saved))
+	for _, answer := range saved {
+		answers = append(answers, gin.H{
+			"question_id":        answer.QuestionID,
+			"student_answer":     answer.StudentAnswer,
+			"time_spent_seconds": answer.TimeSpentSeconds,
+		})
+	}
+	return gin.H{
+		"attempt_id":     attempt.ID,
+		"questions":      NewServedQuestions(served),
+		"answers":        answers,
+		"total_points":   attempt.TotalPoints,
+		"deadline":       attempt.Deadline,
+		"time_remaining": int(time.Until(*attempt.Deadline).Seconds()),
+		"resumed":        saved != nil,
+	}
+}
+
+// RegisteredStudentAnswer autosaves one answer of a drawn public quiz attempt
+type RegisteredStudentAnswer struct {
+	StudentID        uint   `json:"student_id" binding:"required"`
+	AttemptID        uint   `json:"attempt_id" binding:"required"`
+	QuestionID       uint   `json:"question_id" binding:"required"`
+	UserAnswer       string `json:"user_answer"`
+	TimeSpentSeconds int    `json:"time_spent_seconds" binding:"min=0"` // Total so far on this question
+	QuizToken        string `json:"quiz_token" binding:"required"`
+}
+
+// SaveRegisteredStudentAnswer stores the answer to one question of a running
+// attempt, replacing any earlier one, so the attempt survives a reload or a
+// dropped connection. Grading stays hidden until the attempt is submitted.
+func (h *StudentHandler) SaveRegisteredStudentAnswer(c *gin.Context) {
+	var req RegisteredStudentAnswer
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var attempt models.Attempt
+	if err := database.DB.Where("id = ? AND student_id = ? AND status = ?",
+		req.AttemptID, req.StudentID, models.StatusInProgress).
+		First(&attempt).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt"})
+		return
+	}
+	if h.checkQuizToken(c, req.QuizToken, req.StudentID, attempt.CourseID, attempt.QuizPackageID) == nil {
+		return
+	}
+	if attempts.IsExpired(&attempt, time.Now(), h.gracePeriod()) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    "Time is up for this attempt",
+			"deadline": attempt.Deadline,
+		})
+		return
+	}
+
+	served, err := questionbank.ForAttempt(database.DB, &attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load questions"})
+		return
+	}
+	var question *questionbank.ServedQuestion
+	for i := range served {
+		if served[i].ID == req.QuestionID {
+			question = &served[i]
+			break
+		}
+	}
+	if question == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":       "Question was not served in this quiz",
+			"question_id": req.QuestionID,
+		})
+		return
+	}
+
+	shown := question.Shown()
+	studentAnswer := grading.Resolve(&shown, req.UserAnswer, question.OptionOrder)
+	isCorrect, pointsEarned := question.Grade(studentAnswer)
+
+	var answer models.Answer
+	err = database.DB.Where("attempt_id = ? AND question_id = ?", attempt.ID, question.ID).First(&answer).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answer"})
+		return
+	}
+	answer.AttemptID = attempt.ID
+	answer.QuestionID = question.ID
+	answer.StudentAnswer = studentAnswer
+	answer.IsCorrect = isCorrect
+	answer.PointsEarned = pointsEarned
+	answer.TimeSpentSeconds = req.TimeSpentSeconds
+	answer.QuestionVersionID = question.VersionID()
+	if err := database.DB.Save(&answer).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answer"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Enrollment status updated successfully",
-		"status":  req.Status,
+		"message":        "Answer saved",
+		"attempt_id":     attempt.ID,
+		"question_id":    answer.QuestionID,
+		"time_remaining": int(time.Until(*attempt.Deadline).Seconds()),
 	})
 }
 
-// RegisteredStudentQuizSubmission for phone-verified students
+// RegisteredStudentQuizSubmission for phone-verified students.
+// Only raw answers are accepted; scoring happens on the server.
 type RegisteredStudentQuizSubmission struct {
-	StudentID     uint `json:"student_id" binding:"required"`
-	CourseID      uint `json:"course_id" binding:"required"`
-	QuizPackageID uint `json:"quiz_package_id" binding:"required"`
-	Score         int  `json:"score" binding:"min=0"` // Allow 0 scores
-	TotalPoints   int  `json:"total_points" binding:"required"`
-	TimeTaken     int  `json:"time_taken"` // in seconds
+	StudentID     uint   `json:"student_id" binding:"required"`
+	CourseID      uint   `json:"course_id" binding:"required"`
+	QuizPackageID uint   `json:"quiz_package_id" binding:"required"`
+	QuizToken     string `json:"quiz_token" binding:"required"` // From /api/quiz/check-phone; accepted for one attempt
+	AttemptID     uint   `json:"attempt_id" binding:"required"` // From /quiz/draw, which starts the clock
 	Answers       []struct {
-		QuestionID   uint   `json:"question_id"`
-		UserAnswer   string `json:"user_answer"`
-		IsCorrect    bool   `json:"is_correct"`
-		PointsEarned int    `json:"points_earned"`
-	} `json:"answers"`
+		QuestionID       uint   `json:"question_id" binding:"required"`
+		UserAnswer       string `json:"user_answer"`
+		TimeSpentSeconds int    `json:"time_spent_seconds" binding:"min=0"`
+	} `json:"answers" binding:"dive"`
 }
 
+// errAttemptClosed is returned when an attempt was finished by another request
+var errAttemptClosed = errors.New("attempt is no longer in progress")
+
 func (h *StudentHandler) SubmitRegisteredStudentQuiz(c *gin.Context) {
 	var req RegisteredStudentQuizSubmission
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -655,8 +1215,13 @@ func (h *StudentHandler) SubmitRegisteredStudentQuiz(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Received registered student quiz submission: StudentID=%d, CourseID=%d, QuizPackageID=%d, Score=%d, Answers=%d",
-		req.StudentID, req.CourseID, req.QuizPackageID, req.Score, len(req.Answers))
+	log.Printf("Received registered student quiz submission: StudentID=%d, CourseID=%d, QuizPackageID=%d, Answers=%d",
+		req.StudentID, req.CourseID, req.QuizPackageID, len(req.Answers))
+
+	token := h.checkQuizToken(c, req.QuizToken, req.StudentID, req.CourseID, req.QuizPackageID)
+	if token == nil {
+		return
+	}
 
 	// Verify student exists
 	var student models.User
@@ -673,83 +1238,212 @@ func (h *StudentHandler) SubmitRegisteredStudentQuiz(c *gin.Context) {
 	}
 
 	var quizPackage models.QuizPackage
-	if err := database.DB.First(&quizPackage, req.QuizPackageID).Error; err != nil {
+	if err := database.DB.Where("id = ? AND course_id = ?", req.QuizPackageID, req.CourseID).
+		First(&quizPackage).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz package not found"})
 		return
 	}
 
 	// Check retry limit using quiz package's max retake count per student
-	var attemptCount int64
-	database.DB.Model(&models.Attempt{}).Where(
-		"student_id = ? AND quiz_package_id = ? AND status = ?",
-		req.StudentID, req.QuizPackageID, models.StatusCompleted,
-	).Count(&attemptCount)
+	attemptCount := attempts.RetakesUsed(database.DB, req.StudentID, req.QuizPackageID)
 
 	maxRetakes := quizPackage.MaxRetakeCount
 	if maxRetakes == 0 {
 		maxRetakes = 1 // Default fallback
 	}
 
-	if int(attemptCount) >= maxRetakes {
+	if attemptCount >= maxRetakes {
 		c.JSON(http.StatusForbidden, gin.H{
 			"error":            "Maximum retry limit reached",
 			"message":          "You have already taken this quiz the maximum number of times allowed.",
 			"max_retakes":      maxRetakes,
-			"current_attempts": int(attemptCount),
+			"current_attempts": attemptCount,
 		})
 		return
 	}
 
-	// Create attempt record (no device ID)
-	now := time.Now()
-	endTime := now.Add(time.Duration(req.TimeTaken) * time.Second)
-
-	attempt := models.Attempt{
-		StudentID:     req.StudentID,
-		CourseID:      req.CourseID,
-		QuizPackageID: req.QuizPackageID,
-		DeviceID:      "", // No device ID for registered students
-		Status:        models.StatusCompleted,
-		StartTime:     now,
-		EndTime:       &endTime,
-		Score:         req.Score,
-		TotalPoints:   req.TotalPoints,
-		AttemptCount:  int(attemptCount) + 1,
+	// Load the attempt started by /quiz/draw. Its start time and deadline
+	// were set by the server, so the client's clock is never trusted.
+	var drawn models.Attempt
+	if err := database.DB.Where("id = ? AND student_id = ? AND quiz_package_id = ? AND status = ?",
+		req.AttemptID, req.StudentID, req.QuizPackageID, models.StatusInProgress).
+		First(&drawn).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt; request the questions from /api/student/quiz/draw first"})
+		return
+	}
+	if attempts.IsExpired(&drawn, time.Now(), h.gracePeriod()) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    "Time is up for this attempt",
+			"deadline": drawn.Deadline,
+		})
+		return
 	}
 
-	if err := database.DB.Create(&attempt).Error; err != nil {
-		log.Printf("Error creating attempt: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attempt record"})
+	questions, err := questionbank.ForAttempt(database.DB, &drawn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load questions"})
 		return
 	}
 
-	log.Printf("Created attempt with ID: %d", attempt.ID)
+	questionLookup := make(map[uint]*questionbank.ServedQuestion, len(questions))
+	totalPoints := 0
+	for i := range questions {
+		questionLookup[questions[i].ID] = &questions[i]
+		totalPoints += questions[i].Points
+	}
+
+	// Answers autosaved during the attempt count unless resubmitted
+	autosaved := make(map[uint]models.Answer)
+	var existing []models.Answer
+	if err := database.DB.Where("attempt_id = ?", drawn.ID).Find(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load saved answers"})
+		return
+	}
+	for _, answer := range existing {
+		autosaved[answer.QuestionID] = answer
+	}
 
-	// Save individual answers
+	// Grade every submitted answer against the stored question
+	var answers []models.Answer
+	seen := make(map[uint]bool)
+	score := 0
 	for _, answerData := range req.Answers {
+		question, exists := questionLookup[answerData.QuestionID]
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":       "Question was not served in this quiz",
+				"question_id": answerData.QuestionID,
+			})
+			return
+		}
+		if seen[answerData.QuestionID] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":       "Duplicate answer for question",
+				"question_id": answerData.QuestionID,
+			})
+			return
+		}
+		seen[answerData.QuestionID] = true
+
+		shown := question.Shown()
+		studentAnswer := grading.Resolve(&shown, answerData.UserAnswer, question.OptionOrder)
+		isCorrect, pointsEarned := question.Grade(studentAnswer)
+		score += pointsEarned
+
 		answer := models.Answer{
-			AttemptID:     attempt.ID,
-			QuestionID:    answerData.QuestionID,
-			StudentAnswer: answerData.UserAnswer,
-			IsCorrect:     answerData.IsCorrect,
-			PointsEarned:  answerData.PointsEarned,
+			QuestionID:        question.ID,
+			StudentAnswer:     studentAnswer,
+			IsCorrect:         isCorrect,
+			PointsEarned:      pointsEarned,
+			TimeSpentSeconds:  answerData.TimeSpentSeconds,
+			QuestionVersionID: question.VersionID(),
+		}
+		if saved, ok := autosaved[question.ID]; ok {
+			// Replace the autosaved row rather than adding a second answer
+			answer.ID = saved.ID
+			answer.CreatedAt = saved.CreatedAt
+			delete(autosaved, question.ID)
+		}
+		answers = append(answers, answer)
+	}
+	for _, saved := range autosaved {
+		if _, served := questionLookup[saved.QuestionID]; served {
+			score += saved.PointsEarned
+		}
+	}
+
+	// The drawn attempt keeps its server-side start time and deadline
+	endTime := time.Now()
+	attempt := drawn
+	attempt.Status = models.StatusCompleted
+	attempt.EndTime = &endTime
+	attempt.Score = score
+	attempt.TotalPoints = totalPoints
+	attempt.QuizTokenID = &token.ID
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the first of two submissions arriving together finishes the
+		// attempt; the other finds it no longer in progress
+		result := tx.Model(&models.Attempt{}).
+			Where("id = ? AND status = ?", attempt.ID, models.StatusInProgress).
+			Updates(map[string]interface{}{
+				"status":        attempt.Status,
+				"end_time":      attempt.EndTime,
+				"score":         attempt.Score,
+				"total_points":  attempt.TotalPoints,
+				"quiz_token_id": attempt.QuizTokenID,
+			})
+		if result.Error != nil {
+			return result.Error
 		}
-		if err := database.DB.Create(&answer).Error; err != nil {
-			log.Printf("Warning: Failed to save answer for question %d: %v", answerData.QuestionID, err)
+		if result.RowsAffected == 0 {
+			return errAttemptClosed
 		}
+		for i := range answers {
+			answers[i].AttemptID = attempt.ID
+			if err := tx.Save(&answers[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errAttemptClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This attempt has already been submitted"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attempt record"})
+		return
 	}
 
-	log.Printf("Quiz submission completed successfully for student %d", req.StudentID)
+	log.Printf("Quiz submission completed successfully for student %d (attempt %d, score %d/%d)",
+		req.StudentID, attempt.ID, score, totalPoints)
+
+	// Per-question results so the client can render its review screen
+	answerLookup := make(map[uint]models.Answer, len(answers)+len(autosaved))
+	for _, answer := range autosaved {
+		answerLookup[answer.QuestionID] = answer
+	}
+	for _, answer := range answers {
+		answerLookup[answer.QuestionID] = answer
+	}
+
+	correctCount := 0
+	var details []gin.H
+	for _, question := range questions {
+		answer := answerLookup[question.ID]
+		if answer.IsCorrect {
+			correctCount++
+		}
+		details = append(details, gin.H{
+			"question_id":    question.ID,
+			"user_answer":    answer.StudentAnswer,
+			"correct_answer": grading.CorrectAnswer(&question.Question),
+			"is_correct":     answer.IsCorrect,
+			"points_earned":  answer.PointsEarned,
+			"points":         question.Points,
+		})
+	}
+
+	percentage := 0.0
+	if totalPoints > 0 {
+		percentage = float64(score) / float64(totalPoints) * 100
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Quiz submitted successfully",
-		"attempt_id": attempt.ID,
-		"score":      req.Score,
-		"percentage": float64(req.Score) / float64(req.TotalPoints) * 100,
+		"message":      "Quiz submitted successfully",
+		"attempt_id":   attempt.ID,
+		"score":        score,
+		"total_points": totalPoints,
+		"percentage":   percentage,
+		"correct":      correctCount,
+		"incorrect":    len(questions) - correctCount,
+		"details":      details,
 		"retake_info": gin.H{
-			"current_attempts":   int(attemptCount) + 1,
+			"current_attempts":   attemptCount + 1,
 			"max_retakes":        maxRetakes,
-			"attempts_remaining": maxRetakes - int(attemptCount) - 1,
+			"attempts_remaining": maxRetakes - attemptCount - 1,
 		},
 	})
 }
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestListStudents(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		grammar := newCourse(t, db, "N5 Grammar")
+		kanji := newCourse(t, db, "Kanji Basics")
+		pkg := &models.QuizPackage{CourseID: kanji.ID, Title: "Week 1"}
+		create(t, db, pkg)
+
+		admin := newUser(t, db, "Admin", models.RoleAdmin)
+		teacher := newStaff(t, db, models.RoleTeacher, models.CourseTeacher, grammar)
+
+		both := newUser(t, db, "Aiko", models.RoleStudent)
+		enroll(t, db, both, grammar, models.EnrollmentApproved)
+		enroll(t, db, both, kanji, models.EnrollmentPending)
+		declined := newUser(t, db, "Ben", models.RoleStudent)
+		enroll(t, db, declined, grammar, models.EnrollmentDeclined)
+		guest := newUser(t, db, "Chika", models.RoleStudent)
+		create(t, db, &models.Attempt{StudentID: guest.ID, CourseID: kanji.ID, QuizPackageID: pkg.ID, DeviceID: "dev-c"})
+		idle := newUser(t, db, "Daichi", models.RoleStudent)
+
+		list := func(user *models.User) map[uint]string {
+			h := NewStudentHandler(nil)
+			var students []struct {
+				ID         uint   `json:"id"`
+				CourseName string `json:"course_name"`
+			}
+			decode(t, serve(t, user, "GET", "/students", "/students", nil, h.ListStudents), http.StatusOK, &students)
+
+			courses := make(map[uint]string)
+			for _, s := range students {
+				if _, dup := courses[s.ID]; dup {
+					t.Errorf("student %d listed twice", s.ID)
+				}
+				// The order within the list is up to the database
+				names := strings.Split(s.CourseName, ", ")
+				sort.Strings(names)
+				courses[s.ID] = strings.Join(names, ", ")
+			}
+			return courses
+		}
+
+		got := list(admin)
+		want := map[uint]string{
+			both.ID:     "Kanji Basics, N5 Grammar",
+			declined.ID: "No Course",
+			guest.ID:    "No Course",
+			idle.ID:     "No Course",
+		}
+		if len(got) != len(want) {
+			t.Errorf("admin sees %v, want %v", got, want)
+		}
+		for id, courses := range want {
+			if got[id] != courses {
+				t.Errorf("student %d: course_name = %q, want %q", id, got[id], courses)
+			}
+		}
+
+		// Teachers see who enrolled in their course, whatever became of it
+		got = list(teacher)
+		if len(got) != 2 || got[both.ID] == "" || got[declined.ID] != "No Course" {
+			t.Errorf("teacher sees %v, want students %d and %d", got, both.ID, declined.ID)
+		}
+	})
+}
+
+func TestGetEnrollmentsByCourse(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		course := newCourse(t, db, "N5 Grammar")
+		other := newCourse(t, db, "Kanji Basics")
+		assistant := newStaff(t, db, models.RoleAssistant, models.CourseAssistant, course)
+		outsider := newStaff(t, db, models.RoleTeacher, models.CourseOwner, other)
+
+		approved := newUser(t, db, "Aiko", models.RoleStudent)
+		db.Model(approved).Updates(map[string]interface{}{"address": "1-2-3 Shibuya", "city": "Tokyo", "postal_code": "150-0002"})
+		first := enroll(t, db, approved, course, models.EnrollmentApproved)
+		waiting := newUser(t, db, "Ben", models.RoleStudent)
+		second := enroll(t, db, waiting, course, models.EnrollmentWaitlisted)
+		declined := newUser(t, db, "Chika", models.RoleStudent)
+		enroll(t, db, declined, course, models.EnrollmentDeclined)
+		deleted := newUser(t, db, "Daichi", models.RoleStudent)
+		enroll(t, db, deleted, course, models.EnrollmentPending)
+		db.Delete(deleted)
+		enroll(t, db, newUser(t, db, "Emi", models.RoleStudent), other, models.EnrollmentApproved)
+
+		// Newest first
+		db.Model(first).UpdateColumn("created_at", first.CreatedAt.Add(-time.Hour))
+
+		h := NewStudentHandler(nil)
+		path := "/enrollments/course/" + strconv.Itoa(int(course.ID))
+		var enrollments []struct {
+			ID      uint   `json:"id"`
+			Name    string `json:"name"`
+			Address string `json:"address"`
+			Status  string `json:"status"`
+		}
+		decode(t, serve(t, assistant, "GET", "/enrollments/course/:courseId", path, nil, h.GetEnrollmentsByCourse), http.StatusOK, &enrollments)
+
+		if len(enrollments) != 2 {
+			t.Fatalf("got %d enrollments, want 2: %+v", len(enrollments), enrollments)
+		}
+		if enrollments[0].ID != second.ID || enrollments[1].ID != first.ID {
+			t.Errorf("got enrollments %d, %d; want %d, %d", enrollments[0].ID, enrollments[1].ID, second.ID, first.ID)
+		}
+		if got := enrollments[1]; got.Name != "Aiko" || got.Status != "approved" || got.Address != "1-2-3 Shibuya, Tokyo, 150-0002" {
+			t.Errorf("approved enrollment = %+v", got)
+		}
+
+		w := serve(t, outsider, "GET", "/enrollments/course/:courseId", path, nil, h.GetEnrollmentsByCourse)
+		decode(t, w, http.StatusForbidden, nil)
+	})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"errors"
+	"mitsuki-jpy-quiz/config"
+	"mitsuki-jpy-quiz/internal/access"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/trash"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrashHandler struct {
+	Config *config.Config
+}
+
+func NewTrashHandler(cfg *config.Config) *TrashHandler {
+	return &TrashHandler{Config: cfg}
+}
+
+// Names used in messages, and what has to be restored before each kind
+var (
+	trashNames = map[*trash.Kind]string{
+		trash.Courses:      "Course",
+		trash.QuizPackages: "Quiz package",
+		trash.Questions:    "Question",
+		trash.Pools:        "Pool",
+	}
+	trashParentErrors = map[*trash.Kind]string{
+		trash.QuizPackages: "Its course is in the trash; restore the course first",
+		trash.Questions:    "Its quiz package is in the trash; restore the quiz package first",
+		trash.Pools:        "Its quiz package is in the trash; restore the quiz package first",
+	}
+)
+
+func (h *TrashHandler) retention() time.Duration {
+	return time.Duration(h.Config.TrashRetentionDays) * 24 * time.Hour
+}
+
+// trashKind reads the :kind URL parameter
+func trashKind(c *gin.Context) (*trash.Kind, bool) {
+	kind, ok := trash.KindByName(c.Param("kind"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown trash type; use courses, quiz-packages, questions or question-pools"})
+	}
+	return kind, ok
+}
+
+// findTrashItem loads a record in the trash and checks the permission on its course
+func findTrashItem(c *gin.Context, kind *trash.Kind, permission access.Permission) (*trash.Item, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var items []trash.Item
+	if err := trash.Query(database.DB, kind).Where(kind.Table+".id = ?", id).Limit(1).Scan(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trash"})
+		return nil, false
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": trashNames[kind] + " not found in the trash"})
+		return nil, false
+	}
+	if !authorize(c, items[0].CourseID, permission) {
+		return nil, false
+	}
+	return &items[0], true
+}
+
+// ListTrash returns the deleted records of one kind in the staff member's
+// courses, newest first. Optional filter: course_id.
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	kind, ok := trashKind(c)
+	if !ok {
+		return
+	}
+
+	query, ok := staffCourses(c, trash.Query(database.DB, kind), trash.CourseColumn(kind))
+	if !ok {
+		return
+	}
+	if courseID := c.Query("course_id"); courseID != "" {
+		query = query.Where(trash.CourseColumn(kind)+" = ?", courseID)
+	}
+
+	items, err := trash.List(query, h.retention())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trash"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// RestoreTrashItem brings a record back with the children deleted along with
+// it. Courses need the owner role, everything else the teacher role.
+func (h *TrashHandler) RestoreTrashItem(c *gin.Context) {
+	kind, ok := trashKind(c)
+	if !ok {
+		return
+	}
+	permission := access.Edit
+	if kind == trash.Courses {
+		permission = access.Manage
+	}
+	item, ok := findTrashItem(c, kind, permission)
+	if !ok {
+		return
+	}
+
+	restored, err := trash.Restore(database.DB, kind, item.ID)
+	if errors.Is(err, trash.ErrParentDeleted) {
+		c.JSON(http.StatusConflict, gin.H{"error": trashParentErrors[kind]})
+		return
+	}
+	if errors.Is(err, trash.ErrNotInTrash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": trashNames[kind] + " not found in the trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore " + kind.Entity})
+		return
+	}
+	audit.Note(c, audit.Change{
+		Action:     kind.Entity + ".restore",
+		EntityType: kind.Entity,
+		EntityID:   item.ID,
+		Before:     item,
+		After:      gin.H{"restored": restored},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  trashNames[kind] + " restored successfully",
+		"restored": restored,
+	})
+}
+
+// PurgeTrashItem permanently deletes a record in the trash with its children
+// and the student results recorded against them (course owners)
+func (h *TrashHandler) PurgeTrashItem(c *gin.Context) {
+	kind, ok := trashKind(c)
+	if !ok {
+		return
+	}
+	item, ok := findTrashItem(c, kind, access.Manage)
+	if !ok {
+		return
+	}
+
+	err := trash.Purge(database.DB, kind, item.ID)
+	if errors.Is(err, trash.ErrNotInTrash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": trashNames[kind] + " not found in the trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge " + kind.Entity})
+		return
+	}
+	audit.Note(c, audit.Change{Action: kind.Entity + ".purge", EntityType: kind.Entity, EntityID: item.ID, Before: item})
+
+	c.JSON(http.StatusOK, gin.H{"message": trashNames[kind] + " permanently deleted"})
+}
+
+// PurgeExpiredTrash permanently deletes everything that has been in the trash
+// longer than the retention period, or than ?days= when given (Admin only)
+func (h *TrashHandler) PurgeExpiredTrash(c *gin.Context) {
+	days := h.Config.TrashRetentionDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+			return
+		}
+		days = parsed
+	} else if days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The trash is kept forever; pass days to choose what to purge"})
+		return
+	}
+
+	before := time.Now().AddDate(0, 0, -days)
+	purged, err := trash.PurgeExpired(database.DB, before)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge trash"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "trash.purge", EntityType: "trash", After: gin.H{"before": before, "purged": purged}})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Trash purged",
+		"purged":  purged,
+		"before":  before,
+	})
+}
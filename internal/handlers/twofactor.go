@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/sessions"
+	"mitsuki-jpy-quiz/internal/throttle"
+	"mitsuki-jpy-quiz/internal/twofactor"
+	"mitsuki-jpy-quiz/pkg/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a staff member has after their password to give a code, or to
+// set up an authenticator app when that is required
+const twoFactorTokenLifetime = 10 * time.Minute
+
+type TwoFactorLoginRequest struct {
+	PendingToken string `json:"pending_token" binding:"required"`
+	Code         string `json:"code"` // Authenticator or recovery code
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // Authenticator or recovery code
+}
+
+// secondFactor responds instead of starting a session when the staff member
+// still has to give a code, or has to set up an authenticator app first
+func (h *AuthHandler) secondFactor(c *gin.Context, user *models.User) bool {
+	var key string
+	switch {
+	case user.TwoFactorEnabled():
+		key = "two_factor_required"
+	case h.Config.RequireStaff2FA:
+		key = "two_factor_setup_required"
+	default:
+		return false
+	}
+
+	token, err := utils.GenerateTwoFactorToken(user.ID, h.Config.JWTSecret, twoFactorTokenLifetime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		key:             true,
+		"pending_token": token,
+		"expires_at":    time.Now().Add(twoFactorTokenLifetime),
+	})
+	return true
+}
+
+// pendingUser loads the staff member a pending sign-in token was given to,
+// or responds with 401
+func (h *AuthHandler) pendingUser(c *gin.Context, token string) (*models.User, bool) {
+	claims, err := utils.ValidateTwoFactorToken(token, h.Config.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in expired, please enter your password again"})
+		return nil, false
+	}
+	var user models.User
+	if err := database.DB.Where("id = ? AND role IN ?", claims.UserID, staffRoles).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in expired, please enter your password again"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// VerifyTwoFactorLogin finishes a staff sign-in with an authenticator or
+// recovery code
+func (h *AuthHandler) VerifyTwoFactorLogin(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.pendingUser(c, req.PendingToken)
+	if !ok {
+		return
+	}
+
+	policy := loginPolicy(h.Config)
+	if h.throttled(c, policy, throttle.ScopeTwoFactor, user.Email) {
+		return
+	}
+
+	recovery, err := twofactor.Verify(database.DB, user, req.Code)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			h.failed(c, policy, throttle.ScopeTwoFactor, user.Email)
+		}
+		twoFactorError(c, err)
+		return
+	}
+	h.succeeded(throttle.ScopeTwoFactor, user.Email)
+
+	tokens, err := sessions.Start(database.DB, h.Config, user, sessionClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	response := sessionResponse(tokens, user)
+	if recovery {
+		// Warn when the last codes are running out
+		left, _ := twofactor.RecoveryCodesLeft(database.DB, user.ID)
+		response["recovery_codes_left"] = left
+		log.Printf("User %d signed in with a recovery code, %d left", user.ID, left)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SetupTwoFactorLogin starts setting up an authenticator app during sign-in,
+// for staff who have to use one but have not set it up yet
+func (h *AuthHandler) SetupTwoFactorLogin(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.pendingUser(c, req.PendingToken)
+	if !ok {
+		return
+	}
+
+	secret, err := twofactor.Setup(database.DB, user)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, setupResponse(user, secret, h.Config.TwoFactorIssuer))
+}
+
+// EnableTwoFactorLogin turns on the authenticator app set up during sign-in
+// and finishes the sign-in. The recovery codes are only shown this once.
+func (h *AuthHandler) EnableTwoFactorLogin(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.pendingUser(c, req.PendingToken)
+	if !ok {
+		return
+	}
+
+	policy := loginPolicy(h.Config)
+	if h.throttled(c, policy, throttle.ScopeTwoFactor, user.Email) {
+		return
+	}
+
+	codes, err := twofactor.Enable(database.DB, user, req.Code)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			h.failed(c, policy, throttle.ScopeTwoFactor, user.Email)
+		}
+		twoFactorError(c, err)
+		return
+	}
+	h.succeeded(throttle.ScopeTwoFactor, user.Email)
+
+	tokens, err := sessions.Start(database.DB, h.Config, user, sessionClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	response := sessionResponse(tokens, user)
+	response["recovery_codes"] = codes
+	c.JSON(http.StatusOK, response)
+}
+
+// setupResponse carries what an authenticator app needs: the secret to type
+// in, or the otpauth:// URI to show as a QR code
+func setupResponse(user *models.User, secret, issuer string) gin.H {
+	return gin.H{
+		"secret":           secret,
+		"provisioning_uri": twofactor.ProvisioningURI(secret, issuer, user.Email),
+	}
+}
+
+// twoFactorError responds with the error from the twofactor package
+func twoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, twofactor.ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+	case errors.Is(err, twofactor.ErrAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already on"})
+	case errors.Is(err, twofactor.ErrNotSetUp):
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not set up"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update two-factor authentication"})
+	}
+}
+
+// signedInUser loads the signed-in staff member, or responds with 404
+func signedInUser(c *gin.Context) (*models.User, bool) {
+	userID, _ := currentUser(c)
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// accountKey is what a signed-in staff member's wrong codes are counted
+// against; unlike the email address, it cannot be changed to start afresh
+func accountKey(user *models.User) string {
+	return fmt.Sprintf("user:%d", user.ID)
+}
+
+// SetupTwoFactor starts setting up an authenticator app for the signed-in
+// staff member. It returns the secret and the otpauth:// URI to show as a QR code.
+func (h *StaffHandler) SetupTwoFactor(c *gin.Context) {
+	user, ok := signedInUser(c)
+	if !ok {
+		return
+	}
+
+	secret, err := twofactor.Setup(database.DB, user)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	audit.Note(c, audit.Change{Action: "two_factor.setup", EntityType: "user", EntityID: user.ID})
+
+	c.JSON(http.StatusOK, setupResponse(user, secret, h.Config.TwoFactorIssuer))
+}
+
+// EnableTwoFactor turns on the authenticator app once it shows the right code.
+// The recovery codes are only shown this once.
+func (h *StaffHandler) EnableTwoFactor(c *gin.Context) {
+	user, ok := signedInUser(c)
+	if !ok {
+		return
+	}
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, key := loginPolicy(h.Config), accountKey(user)
+	if h.throttled(c, policy, throttle.ScopeTwoFactor, key) {
+		return
+	}
+
+	codes, err := twofactor.Enable(database.DB, user, req.Code)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			h.failed(c, policy, throttle.ScopeTwoFactor, key)
+		}
+		twoFactorError(c, err)
+		return
+	}
+	h.succeeded(throttle.ScopeTwoFactor, key)
+	audit.Note(c, audit.Change{Action: "two_factor.enable", EntityType: "user", EntityID: user.ID, After: gin.H{"totp_enabled_at": user.TOTPEnabledAt}})
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns off the signed-in staff member's authenticator app.
+// It needs their password and a code, and is refused when staff must use one.
+func (h *StaffHandler) DisableTwoFactor(c *gin.Context) {
+	if h.Config.RequireStaff2FA {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for all staff"})
+		return
+	}
+	user, ok := signedInUser(c)
+	if !ok {
+		return
+	}
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, key := loginPolicy(h.Config), accountKey(user)
+	if h.throttled(c, policy, throttle.ScopeTwoFactor, key) {
+		return
+	}
+	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		h.failed(c, policy, throttle.ScopeTwoFactor, key)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect password"})
+		return
+	}
+	if _, err := twofactor.Verify(database.DB, user, req.Code); err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			h.failed(c, policy, throttle.ScopeTwoFactor, key)
+		}
+		twoFactorError(c, err)
+		return
+	}
+	h.succeeded(throttle.ScopeTwoFactor, key)
+
+	if err := twofactor.Disable(database.DB, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to turn off two-factor authentication"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "two_factor.disable", EntityType: "user", EntityID: user.ID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication turned off"})
+}
+
+// RegenerateRecoveryCodes replaces the signed-in staff member's recovery codes
+// after checking a code. The new ones are only shown this once.
+func (h *StaffHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := signedInUser(c)
+	if !ok {
+		return
+	}
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy, key := loginPolicy(h.Config), accountKey(user)
+	if h.throttled(c, policy, throttle.ScopeTwoFactor, key) {
+		return
+	}
+	if _, err := twofactor.Verify(database.DB, user, req.Code); err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			h.failed(c, policy, throttle.ScopeTwoFactor, key)
+		}
+		twoFactorError(c, err)
+		return
+	}
+	h.succeeded(throttle.ScopeTwoFactor, key)
+
+	codes, err := twofactor.NewRecoveryCodes(database.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "two_factor.recovery_codes", EntityType: "user", EntityID: user.ID})
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetTwoFactor turns off a staff member's authenticator app, for when they
+// lost it and their recovery codes, and signs them out everywhere (Admin only).
+// When staff must use one, they set up a new one at their next sign-in.
+func (h *StaffHandler) ResetTwoFactor(c *gin.Context) {
+	user, ok := findStaff(c)
+	if !ok {
+		return
+	}
+	if userID, _ := currentUser(c); userID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use your own two-factor settings instead"})
+		return
+	}
+	if !user.TwoFactorEnabled() && user.TOTPSecret == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not on for this account"})
+		return
+	}
+
+	if err := twofactor.Disable(database.DB, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+	audit.Note(c, audit.Change{Action: "staff.reset_two_factor", EntityType: "user", EntityID: user.ID})
+
+	if _, err := sessions.EndAll(database.DB, h.Config, user.ID, "admin"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
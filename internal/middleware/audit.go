@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"log"
+	"mitsuki-jpy-quiz/internal/audit"
+	"mitsuki-jpy-quiz/internal/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit logs every write to the routes it guards once the handler is done,
+// whether it succeeded or was refused. Reads are not logged.
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		c.Next()
+		if audit.Skipped(c) {
+			return
+		}
+
+		entry := audit.FromRequest(c)
+		if err := audit.Record(database.DB, &entry); err != nil {
+			log.Printf("Failed to write audit log for %s %s: %v", entry.Method, entry.Path, err)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package middleware
 
 import (
 	"mitsuki-jpy-quiz/config"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/sessions"
 	"mitsuki-jpy-quiz/pkg/utils"
 	"net/http"
 	"strings"
@@ -35,10 +38,24 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		// Tokens of a session that was logged out or revoked
+		revoked, err := sessions.IsRevoked(database.DB, claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 		c.Set("user_role", claims.Role)
+		c.Set("session_id", claims.SessionID)
 
 		c.Next()
 	}
@@ -57,3 +74,19 @@ func AdminOnly() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// StaffOnly admits admins, teachers and assistants. What they may do in each
+// course is checked by the handlers.
+func StaffOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("user_role")
+
+		if !models.UserRole(role).IsStaff() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Staff access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,169 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Snapshot of the schema that AutoMigrate produced before versioned
+// migrations. Running it on an existing database only adds what is missing.
+
+type user0001 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Email       string `gorm:"unique;not null"`
+	Password    string `gorm:"not null"`
+	Name        string `gorm:"not null"`
+	PhoneNumber string `gorm:"type:varchar(20)"`
+	Address     string `gorm:"type:text"`
+	City        string `gorm:"type:varchar(100)"`
+	PostalCode  string `gorm:"type:varchar(20)"`
+	FacebookURL string `gorm:"type:varchar(255)"`
+	Role        string `gorm:"type:varchar(20);not null"`
+
+	Attempts []attempt0001 `gorm:"foreignKey:StudentID"`
+}
+
+func (user0001) TableName() string { return "users" }
+
+type course0001 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Title        string `gorm:"not null"`
+	Description  string `gorm:"type:text"`
+	StudentLimit int    `gorm:"not null;default:50"`
+	RetryCount   int    `gorm:"not null;default:3"`
+	ExamTime     int    `gorm:"not null;default:60"`
+	IsActive     bool   `gorm:"default:true"`
+
+	QuizPackages []quizPackage0001 `gorm:"foreignKey:CourseID"`
+	Enrollments  []enrollment0001  `gorm:"foreignKey:CourseID"`
+}
+
+func (course0001) TableName() string { return "courses" }
+
+type quizPackage0001 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	CourseID       uint   `gorm:"not null"`
+	Title          string `gorm:"not null"`
+	Description    string `gorm:"type:text"`
+	IsActive       bool   `gorm:"default:true"`
+	MaxRetakeCount int    `gorm:"default:1"`
+
+	Questions []question0001 `gorm:"foreignKey:QuizPackageID"`
+}
+
+func (quizPackage0001) TableName() string { return "quiz_packages" }
+
+type question0001 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	QuizPackageID uint   `gorm:"not null"`
+	QuestionText  string `gorm:"type:text;not null"`
+	QuestionType  string `gorm:"type:varchar(50);not null"`
+	ImageURL      string `gorm:"type:varchar(500)"`
+	Options       string `gorm:"type:text"`
+	CorrectAnswer string `gorm:"not null"`
+	Points        int    `gorm:"not null"`
+	OrderNumber   int    `gorm:"default:0"`
+	IsActive      bool   `gorm:"default:true"`
+}
+
+func (question0001) TableName() string { return "questions" }
+
+type attempt0001 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	StudentID     uint   `gorm:"not null"`
+	CourseID      uint   `gorm:"not null"`
+	QuizPackageID uint   `gorm:"not null"`
+	DeviceID      string `gorm:"type:varchar(255);index"`
+	Status        string `gorm:"type:varchar(20);default:'in_progress'"`
+
+	StartTime    time.Time
+	Deadline     *time.Time `gorm:"index"`
+	EndTime      *time.Time
+	Score        int `gorm:"default:0"`
+	TotalPoints  int `gorm:"default:0"`
+	AttemptCount int `gorm:"default:1"`
+
+	Answers []answer0001 `gorm:"foreignKey:AttemptID"`
+}
+
+func (attempt0001) TableName() string { return "attempts" }
+
+type answer0001 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	AttemptID     uint   `gorm:"not null"`
+	QuestionID    uint   `gorm:"not null"`
+	StudentAnswer string `gorm:"type:text"`
+	IsCorrect     bool   `gorm:"default:false"`
+	PointsEarned  int    `gorm:"default:0"`
+}
+
+func (answer0001) TableName() string { return "answers" }
+
+type enrollment0001 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	StudentID uint   `gorm:"not null;index"`
+	CourseID  uint   `gorm:"not null;index"`
+	Status    string `gorm:"type:varchar(20);default:'pending'"`
+
+	Student user0001 `gorm:"foreignKey:StudentID"`
+}
+
+func (enrollment0001) TableName() string { return "enrollments" }
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(
+				&user0001{},
+				&course0001{},
+				&quizPackage0001{},
+				&question0001{},
+				&attempt0001{},
+				&answer0001{},
+				&enrollment0001{},
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(
+				&enrollment0001{},
+				&answer0001{},
+				&attempt0001{},
+				&question0001{},
+				&quizPackage0001{},
+				&course0001{},
+				&user0001{},
+			)
+		},
+	})
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Replaces the hand-run fix_phone_migration.sql: users created before
+// phone_number existed get a placeholder so phone lookups keep working.
+// Admins get 000000000, students the local part of their email.
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "backfill_phone_numbers",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Table("users").
+				Where("role = ? AND phone_number IS NULL", "admin").
+				Update("phone_number", "000000000").Error; err != nil {
+				return err
+			}
+
+			// Done in Go because string functions differ between drivers
+			var students []struct {
+				ID    uint
+				Email string
+			}
+			if err := tx.Table("users").
+				Select("id, email").
+				Where("role = ? AND phone_number IS NULL", "student").
+				Find(&students).Error; err != nil {
+				return err
+			}
+
+			for _, student := range students {
+				phone, _, _ := strings.Cut(student.Email, "@")
+				if len(phone) > 20 {
+					phone = phone[:20]
+				}
+				if err := tx.Table("users").Where("id = ?", student.ID).
+					Update("phone_number", phone).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			// Placeholders cannot be told apart from real numbers; nothing to undo
+			return nil
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Per-question time reported by the quiz page, used by item analysis
+
+type answer0003 struct {
+	TimeSpentSeconds int `gorm:"default:0"`
+}
+
+func (answer0003) TableName() string { return "answers" }
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "add_answer_time_spent",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&answer0003{}, "TimeSpentSeconds") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&answer0003{}, "TimeSpentSeconds")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&answer0003{}, "TimeSpentSeconds")
+		},
+	})
+}
@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Question bank mode: pools that draw random questions per attempt, the tags
+// and difficulty pools filter on, and the record of what each attempt was served
+
+type quizPackage0004 struct {
+	QuestionBank bool `gorm:"default:false"`
+}
+
+func (quizPackage0004) TableName() string { return "quiz_packages" }
+
+type question0004 struct {
+	Tags       string `gorm:"type:varchar(255)"`
+	Difficulty string `gorm:"type:varchar(20)"`
+}
+
+func (question0004) TableName() string { return "questions" }
+
+type questionPool0004 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	QuizPackageID uint   `gorm:"not null;index"`
+	Name          string `gorm:"not null"`
+	Tag           string `gorm:"type:varchar(100)"`
+	Difficulty    string `gorm:"type:varchar(20)"`
+	DrawCount     int    `gorm:"not null;default:1"`
+	OrderNumber   int    `gorm:"default:0"`
+}
+
+func (questionPool0004) TableName() string { return "question_pools" }
+
+type attemptQuestion0004 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	AttemptID  uint `gorm:"not null;uniqueIndex:idx_attempt_question"`
+	QuestionID uint `gorm:"not null;uniqueIndex:idx_attempt_question"`
+	Position   int  `gorm:"not null;default:0"`
+}
+
+func (attemptQuestion0004) TableName() string { return "attempt_questions" }
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "add_question_bank",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if !m.HasColumn(&quizPackage0004{}, "QuestionBank") {
+				if err := m.AddColumn(&quizPackage0004{}, "QuestionBank"); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"Tags", "Difficulty"} {
+				if !m.HasColumn(&question0004{}, column) {
+					if err := m.AddColumn(&question0004{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return tx.AutoMigrate(&questionPool0004{}, &attemptQuestion0004{})
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropTable(&attemptQuestion0004{}, &questionPool0004{}); err != nil {
+				return err
+			}
+			for _, column := range []string{"Tags", "Difficulty"} {
+				if err := m.DropColumn(&question0004{}, column); err != nil {
+					return err
+				}
+			}
+			return m.DropColumn(&quizPackage0004{}, "QuestionBank")
+		},
+	})
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Per-attempt option shuffling: the package switch and the permutation each
+// attempt was shown
+
+type quizPackage0005 struct {
+	ShuffleOptions bool `gorm:"default:false"`
+}
+
+func (quizPackage0005) TableName() string { return "quiz_packages" }
+
+type attemptQuestion0005 struct {
+	OptionOrder string `gorm:"type:varchar(255)"`
+}
+
+func (attemptQuestion0005) TableName() string { return "attempt_questions" }
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "add_option_shuffling",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if !m.HasColumn(&quizPackage0005{}, "ShuffleOptions") {
+				if err := m.AddColumn(&quizPackage0005{}, "ShuffleOptions"); err != nil {
+					return err
+				}
+			}
+			if !m.HasColumn(&attemptQuestion0005{}, "OptionOrder") {
+				return m.AddColumn(&attemptQuestion0005{}, "OptionOrder")
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropColumn(&attemptQuestion0005{}, "OptionOrder"); err != nil {
+				return err
+			}
+			return m.DropColumn(&quizPackage0005{}, "ShuffleOptions")
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Per-question normalization rules for typed answers
+
+type question0006 struct {
+	AnswerRules string `gorm:"type:varchar(255)"`
+}
+
+func (question0006) TableName() string { return "questions" }
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "add_answer_rules",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if m.HasColumn(&question0006{}, "AnswerRules") {
+				return nil
+			}
+			return m.AddColumn(&question0006{}, "AnswerRules")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&question0006{}, "AnswerRules")
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Manual grading: who last overrode an answer's grade, and the audit trail
+// of every override
+
+type answer0007 struct {
+	ReviewedAt    *time.Time
+	ReviewedBy    *uint
+	ReviewComment string `gorm:"type:text"`
+}
+
+func (answer0007) TableName() string { return "answers" }
+
+type answerReview0007 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	AnswerID   uint `gorm:"not null;index"`
+	AttemptID  uint `gorm:"not null;index"`
+	ReviewerID uint `gorm:"not null"`
+
+	PreviousIsCorrect    bool
+	PreviousPointsEarned int
+	IsCorrect            bool
+	PointsEarned         int
+	Comment              string `gorm:"type:text"`
+}
+
+func (answerReview0007) TableName() string { return "answer_reviews" }
+
+var answerReviewColumns0007 = []string{"ReviewedAt", "ReviewedBy", "ReviewComment"}
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "add_manual_grading",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, column := range answerReviewColumns0007 {
+				if !m.HasColumn(&answer0007{}, column) {
+					if err := m.AddColumn(&answer0007{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return tx.AutoMigrate(&answerReview0007{})
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropTable(&answerReview0007{}); err != nil {
+				return err
+			}
+			for _, column := range answerReviewColumns0007 {
+				if err := m.DropColumn(&answer0007{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,109 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Immutable question versions. Every existing question gets version 1 from
+// its current content, and existing answers and served questions are pointed
+// at it, as that is the best record there is of what students saw.
+
+type question0008 struct {
+	Version int `gorm:"not null;default:1"`
+}
+
+func (question0008) TableName() string { return "questions" }
+
+type questionVersion0008 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	QuestionID uint `gorm:"not null;uniqueIndex:idx_question_version"`
+	Version    int  `gorm:"not null;uniqueIndex:idx_question_version"`
+
+	QuestionText  string `gorm:"type:text;not null"`
+	QuestionType  string `gorm:"type:varchar(50);not null"`
+	ImageURL      string `gorm:"type:varchar(500)"`
+	Options       string `gorm:"type:text"`
+	CorrectAnswer string `gorm:"type:text"`
+	AnswerRules   string `gorm:"type:varchar(255)"`
+	Points        int    `gorm:"not null"`
+}
+
+func (questionVersion0008) TableName() string { return "question_versions" }
+
+type answer0008 struct {
+	QuestionVersionID *uint
+}
+
+func (answer0008) TableName() string { return "answers" }
+
+type attemptQuestion0008 struct {
+	QuestionVersionID *uint
+}
+
+func (attemptQuestion0008) TableName() string { return "attempt_questions" }
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "add_question_versions",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if !m.HasColumn(&question0008{}, "Version") {
+				if err := m.AddColumn(&question0008{}, "Version"); err != nil {
+					return err
+				}
+			}
+			if !m.HasColumn(&answer0008{}, "QuestionVersionID") {
+				if err := m.AddColumn(&answer0008{}, "QuestionVersionID"); err != nil {
+					return err
+				}
+			}
+			if !m.HasColumn(&attemptQuestion0008{}, "QuestionVersionID") {
+				if err := m.AddColumn(&attemptQuestion0008{}, "QuestionVersionID"); err != nil {
+					return err
+				}
+			}
+			if err := tx.AutoMigrate(&questionVersion0008{}); err != nil {
+				return err
+			}
+
+			// Deleted questions too, since old answers may still refer to them
+			if err := tx.Exec(`INSERT INTO question_versions
+				(created_at, question_id, version, question_text, question_type, image_url, options, correct_answer, answer_rules, points)
+				SELECT updated_at, id, 1, question_text, question_type, image_url, options, correct_answer, answer_rules, points
+				FROM questions
+				WHERE id NOT IN (SELECT question_id FROM question_versions)`).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE questions SET version = 1").Error; err != nil {
+				return err
+			}
+			for _, table := range []string{"answers", "attempt_questions"} {
+				if err := tx.Exec(`UPDATE ` + table + ` SET question_version_id =
+					(SELECT question_versions.id FROM question_versions
+					 WHERE question_versions.question_id = ` + table + `.question_id AND question_versions.version = 1)
+					WHERE question_version_id IS NULL`).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropColumn(&attemptQuestion0008{}, "QuestionVersionID"); err != nil {
+				return err
+			}
+			if err := m.DropColumn(&answer0008{}, "QuestionVersionID"); err != nil {
+				return err
+			}
+			if err := m.DropTable(&questionVersion0008{}); err != nil {
+				return err
+			}
+			return m.DropColumn(&question0008{}, "Version")
+		},
+	})
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// The quiz token that submitted each public quiz attempt, unique so a token
+// from the phone check can complete only one attempt
+
+type attempt0009 struct {
+	QuizTokenID *string `gorm:"type:varchar(64);uniqueIndex"`
+}
+
+func (attempt0009) TableName() string { return "attempts" }
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "add_attempt_quiz_tokens",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if !m.HasColumn(&attempt0009{}, "QuizTokenID") {
+				if err := m.AddColumn(&attempt0009{}, "QuizTokenID"); err != nil {
+					return err
+				}
+			}
+			if !m.HasIndex(&attempt0009{}, "QuizTokenID") {
+				return m.CreateIndex(&attempt0009{}, "QuizTokenID")
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if m.HasIndex(&attempt0009{}, "QuizTokenID") {
+				if err := m.DropIndex(&attempt0009{}, "QuizTokenID"); err != nil {
+					return err
+				}
+			}
+			return m.DropColumn(&attempt0009{}, "QuizTokenID")
+		},
+	})
+}
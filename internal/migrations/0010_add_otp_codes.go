@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// One-time passcodes for quiz verification, and the Telegram chat students
+// can receive them in
+
+type user0010 struct {
+	TelegramChatID string `gorm:"type:varchar(64)"`
+}
+
+func (user0010) TableName() string { return "users" }
+
+type otpCode0010 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID      uint      `gorm:"not null;index"`
+	Channel     string    `gorm:"type:varchar(20);not null"`
+	Destination string    `gorm:"type:varchar(255);not null"`
+	CodeHash    string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	Attempts    int       `gorm:"default:0"`
+	UsedAt      *time.Time
+}
+
+func (otpCode0010) TableName() string { return "otp_codes" }
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "add_otp_codes",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if !m.HasColumn(&user0010{}, "TelegramChatID") {
+				if err := m.AddColumn(&user0010{}, "TelegramChatID"); err != nil {
+					return err
+				}
+			}
+			return tx.AutoMigrate(&otpCode0010{})
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropTable(&otpCode0010{}); err != nil {
+				return err
+			}
+			return m.DropColumn(&user0010{}, "TelegramChatID")
+		},
+	})
+}
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Login sessions: rotating refresh tokens and the revocation list checked
+// for every access token
+
+type refreshToken0011 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID       uint      `gorm:"not null;index"`
+	SessionID    string    `gorm:"type:varchar(64);not null;index"`
+	TokenHash    string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	RevokedAt    *time.Time
+	ReplacedByID *uint
+	UserAgent    string `gorm:"type:varchar(255)"`
+	IPAddress    string `gorm:"type:varchar(64)"`
+}
+
+func (refreshToken0011) TableName() string { return "refresh_tokens" }
+
+type tokenRevocation0011 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID    uint      `gorm:"not null;index"`
+	SessionID string    `gorm:"type:varchar(64)"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	Reason    string    `gorm:"type:varchar(50)"`
+}
+
+func (tokenRevocation0011) TableName() string { return "token_revocations" }
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "add_sessions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&refreshToken0011{}, &tokenRevocation0011{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&tokenRevocation0011{}, &refreshToken0011{})
+		},
+	})
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Staff roles per course. Existing courses start without members and stay
+// with the admins until owners are assigned.
+
+type courseMember0012 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	CourseID uint   `gorm:"not null;uniqueIndex:idx_course_member"`
+	UserID   uint   `gorm:"not null;uniqueIndex:idx_course_member;index"`
+	Role     string `gorm:"type:varchar(20);not null"`
+}
+
+func (courseMember0012) TableName() string { return "course_members" }
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "add_course_members",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&courseMember0012{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&courseMember0012{})
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit trail of admin API writes
+
+type auditLog0013 struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+
+	ActorID    *uint  `gorm:"index"`
+	ActorEmail string `gorm:"type:varchar(255)"`
+	ActorRole  string `gorm:"type:varchar(20)"`
+
+	Action     string `gorm:"type:varchar(100);not null;index"`
+	EntityType string `gorm:"type:varchar(50);index:idx_audit_entity"`
+	EntityID   string `gorm:"type:varchar(64);index:idx_audit_entity"`
+
+	Before  string `gorm:"type:text"`
+	After   string `gorm:"type:text"`
+	Changes string `gorm:"type:text"`
+
+	Method    string `gorm:"type:varchar(10)"`
+	Path      string `gorm:"type:varchar(255)"`
+	Status    int
+	IPAddress string `gorm:"type:varchar(64)"`
+	UserAgent string `gorm:"type:varchar(255)"`
+}
+
+func (auditLog0013) TableName() string { return "audit_logs" }
+
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "add_audit_logs",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&auditLog0013{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&auditLog0013{})
+		},
+	})
+}
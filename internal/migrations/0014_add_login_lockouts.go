@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Accounts and IP addresses locked out after repeated failed sign-ins
+
+type loginLockout0014 struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+
+	Scope       string `gorm:"type:varchar(20);not null;index"`
+	Identifier  string `gorm:"type:varchar(255);index"`
+	IPAddress   string `gorm:"type:varchar(64);index"`
+	Failures    int
+	LockedUntil time.Time
+
+	UnlockedAt *time.Time
+	UnlockedBy *uint
+}
+
+func (loginLockout0014) TableName() string { return "login_lockouts" }
+
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "add_login_lockouts",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&loginLockout0014{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&loginLockout0014{})
+		},
+	})
+}
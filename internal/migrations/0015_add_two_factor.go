@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Authenticator app (TOTP) sign-in for staff, with single-use recovery codes
+
+type user0015 struct {
+	TOTPSecret    string `gorm:"type:varchar(64)"`
+	TOTPEnabledAt *time.Time
+	TOTPLastStep  int64 `gorm:"default:0"`
+}
+
+func (user0015) TableName() string { return "users" }
+
+type recoveryCode0015 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID   uint   `gorm:"not null;index"`
+	CodeHash string `gorm:"type:varchar(64);not null"`
+	UsedAt   *time.Time
+}
+
+func (recoveryCode0015) TableName() string { return "recovery_codes" }
+
+var user0015Columns = []string{"TOTPSecret", "TOTPEnabledAt", "TOTPLastStep"}
+
+func init() {
+	register(Migration{
+		Version: 15,
+		Name:    "add_two_factor",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, column := range user0015Columns {
+				if m.HasColumn(&user0015{}, column) {
+					continue
+				}
+				if err := m.AddColumn(&user0015{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.AutoMigrate(&recoveryCode0015{})
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropTable(&recoveryCode0015{}); err != nil {
+				return err
+			}
+			for _, column := range user0015Columns {
+				if err := m.DropColumn(&user0015{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,183 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one numbered, reversible schema change.
+// Each migration registers itself from an init func in its own NNNN_name.go file.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName specifies the table name for SchemaMigration model
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status describes a known migration and whether it has been applied
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+var registry []Migration
+
+// register adds a migration to the registry; called from init funcs
+func register(m Migration) {
+	for _, existing := range registry {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("migrations: duplicate version %d (%s and %s)", m.Version, existing.Name, m.Name))
+		}
+	}
+
+	registry = append(registry, m)
+	sort.Slice(registry, func(i, j int) bool { return registry[i].Version < registry[j].Version })
+}
+
+// All returns every registered migration ordered by version
+func All() []Migration {
+	return append([]Migration(nil), registry...)
+}
+
+// Latest returns the highest registered version, or 0 when there are none
+func Latest() int {
+	if len(registry) == 0 {
+		return 0
+	}
+	return registry[len(registry)-1].Version
+}
+
+func ensureTable(db *gorm.DB) error {
+	return db.AutoMigrate(&SchemaMigration{})
+}
+
+func applied(db *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]SchemaMigration, len(rows))
+	for _, row := range rows {
+		byVersion[row.Version] = row
+	}
+	return byVersion, nil
+}
+
+// StatusOf lists every registered migration with the time it was applied, if any
+func StatusOf(db *gorm.DB) ([]Status, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(registry))
+	for _, m := range registry {
+		status := Status{Migration: m}
+		if row, ok := done[m.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the registered migrations that have not been applied yet
+func Pending(db *gorm.DB) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range registry {
+		if _, ok := done[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in version order, each in its own transaction
+func Up(db *gorm.DB) ([]Migration, error) {
+	pending, err := Pending(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range pending {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for i := len(registry) - 1; i >= 0 && len(ran) < steps; i-- {
+		m := registry[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// CheckCurrent returns an error when the database is missing registered migrations
+func CheckCurrent(db *gorm.DB) error {
+	pending, err := Pending(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind by %d migration(s), starting with %04d_%s; run `go run ./cmd/migrate up`",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
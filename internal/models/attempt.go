@@ -27,11 +27,16 @@ type Attempt struct {
 	Status        AttemptStatus `gorm:"type:varchar(20);default:'in_progress'" json:"status"`
 
 	StartTime    time.Time  `json:"start_time"`
+	Deadline     *time.Time `gorm:"index" json:"deadline,omitempty"` // StartTime + course exam time
 	EndTime      *time.Time `json:"end_time,omitempty"`
 	Score        int        `gorm:"default:0" json:"score"`
 	TotalPoints  int        `gorm:"default:0" json:"total_points"`
 	AttemptCount int        `gorm:"default:1" json:"attempt_count"` // Which attempt number (1, 2, 3...)
 
+	// ID of the phone-check quiz token that submitted the attempt; a token
+	// completes at most one attempt
+	QuizTokenID *string `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+
 	Answers []Answer `gorm:"foreignKey:AttemptID" json:"answers,omitempty"`
 }
 
@@ -51,9 +56,65 @@ type Answer struct {
 	StudentAnswer string `gorm:"type:text" json:"student_answer"`
 	IsCorrect     bool   `gorm:"default:false" json:"is_correct"`
 	PointsEarned  int    `gorm:"default:0" json:"points_earned"`
+
+	TimeSpentSeconds int `gorm:"default:0" json:"time_spent_seconds"` // Reported by the quiz page, 0 if unknown
+
+	// The question version the student answered; nil for answers saved
+	// before questions were versioned
+	QuestionVersionID *uint `json:"question_version_id,omitempty"`
+
+	// Set when a teacher overrides the automatic grade
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	ReviewedBy    *uint      `json:"reviewed_by,omitempty"`
+	ReviewComment string     `gorm:"type:text" json:"review_comment,omitempty"`
 }
 
 // TableName specifies the table name for Answer model
 func (Answer) TableName() string {
 	return "answers"
 }
+
+// AnswerReview is one manual grading change to an answer, kept as an audit trail
+type AnswerReview struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	AnswerID   uint `gorm:"not null;index" json:"answer_id"`
+	AttemptID  uint `gorm:"not null;index" json:"attempt_id"`
+	ReviewerID uint `gorm:"not null" json:"reviewer_id"`
+
+	PreviousIsCorrect    bool   `json:"previous_is_correct"`
+	PreviousPointsEarned int    `json:"previous_points_earned"`
+	IsCorrect            bool   `json:"is_correct"`
+	PointsEarned         int    `json:"points_earned"`
+	Comment              string `gorm:"type:text" json:"comment"`
+
+	Reviewer *User `gorm:"foreignKey:ReviewerID" json:"reviewer,omitempty"`
+}
+
+// TableName specifies the table name for AnswerReview model
+func (AnswerReview) TableName() string {
+	return "answer_reviews"
+}
+
+// AttemptQuestion records a question served to an attempt, in the order shown.
+// Grading and review use this set rather than the package's current questions.
+type AttemptQuestion struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	AttemptID  uint `gorm:"not null;uniqueIndex:idx_attempt_question" json:"attempt_id"`
+	QuestionID uint `gorm:"not null;uniqueIndex:idx_attempt_question" json:"question_id"`
+	Position   int  `gorm:"not null;default:0" json:"position"`
+
+	// JSON array mapping each displayed option position to its index in
+	// Question.Options; empty when options were shown in their stored order
+	OptionOrder string `gorm:"type:varchar(255)" json:"option_order,omitempty"`
+
+	QuestionVersionID *uint `json:"question_version_id,omitempty"` // The version served
+}
+
+// TableName specifies the table name for AttemptQuestion model
+func (AttemptQuestion) TableName() string {
+	return "attempt_questions"
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// AuditLog records one write made through the admin API: who made it, to
+// what, and how the record looked before and after
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	ActorID    *uint  `gorm:"index" json:"actor_id"`
+	ActorEmail string `gorm:"type:varchar(255)" json:"actor_email"`
+	ActorRole  string `gorm:"type:varchar(20)" json:"actor_role"`
+
+	Action     string `gorm:"type:varchar(100);not null;index" json:"action"` // e.g. course.delete
+	EntityType string `gorm:"type:varchar(50);index:idx_audit_entity" json:"entity_type"`
+	EntityID   string `gorm:"type:varchar(64);index:idx_audit_entity" json:"entity_id"`
+
+	Before  string `gorm:"type:text" json:"before,omitempty"`  // JSON of the record before the write
+	After   string `gorm:"type:text" json:"after,omitempty"`   // JSON of the record after the write
+	Changes string `gorm:"type:text" json:"changes,omitempty"` // JSON of the fields that differ: {"field": {"from": x, "to": y}}
+
+	Method    string `gorm:"type:varchar(10)" json:"method"`
+	Path      string `gorm:"type:varchar(255)" json:"path"`
+	Status    int    `json:"status"`
+	IPAddress string `gorm:"type:varchar(64)" json:"ip_address"`
+	UserAgent string `gorm:"type:varchar(255)" json:"user_agent"`
+}
+
+// TableName specifies the table name for AuditLog model
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -19,6 +19,9 @@ type Course struct {
 	ExamTime     int    `gorm:"not null;default:60" json:"exam_time"`     // Exam time in minutes
 	IsActive     bool   `gorm:"default:true" json:"is_active"`
 
+	// Open seats left under StudentLimit (-1 when unlimited); filled in by handlers
+	SeatsRemaining *int `gorm:"-" json:"seats_remaining,omitempty"`
+
 	QuizPackages []QuizPackage `gorm:"foreignKey:CourseID" json:"quiz_packages,omitempty"`
 	Enrollments  []Enrollment  `gorm:"foreignKey:CourseID" json:"enrollments,omitempty"`
 }
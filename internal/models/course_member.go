@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type CourseRole string
+
+const (
+	CourseOwner     CourseRole = "owner"     // Everything, including the course settings and its staff
+	CourseTeacher   CourseRole = "teacher"   // Quiz packages, questions, grading and enrollments
+	CourseAssistant CourseRole = "assistant" // Grading and enrollments; read-only otherwise
+)
+
+// Valid reports whether r is a known course role
+func (r CourseRole) Valid() bool {
+	return r == CourseOwner || r == CourseTeacher || r == CourseAssistant
+}
+
+// CourseMember gives a staff account a role in one course
+type CourseMember struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	CourseID uint       `gorm:"not null;uniqueIndex:idx_course_member" json:"course_id"`
+	UserID   uint       `gorm:"not null;uniqueIndex:idx_course_member;index" json:"user_id"`
+	Role     CourseRole `gorm:"type:varchar(20);not null" json:"role"`
+
+	User   User   `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Course Course `gorm:"foreignKey:CourseID" json:"course,omitempty"`
+}
+
+// TableName specifies the table name for CourseMember model
+func (CourseMember) TableName() string {
+	return "course_members"
+}
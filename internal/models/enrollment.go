@@ -9,9 +9,10 @@ import (
 type EnrollmentStatus string
 
 const (
-	EnrollmentPending  EnrollmentStatus = "pending"
-	EnrollmentApproved EnrollmentStatus = "approved"
-	EnrollmentDeclined EnrollmentStatus = "declined"
+	EnrollmentPending    EnrollmentStatus = "pending"
+	EnrollmentApproved   EnrollmentStatus = "approved"
+	EnrollmentDeclined   EnrollmentStatus = "declined"
+	EnrollmentWaitlisted EnrollmentStatus = "waitlisted" // Course was full when the student registered
 )
 
 // Enrollment represents a student's registration in a course
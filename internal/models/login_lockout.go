@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// LoginLockout records an account or IP address that was locked out after too
+// many failed sign-ins or quiz lookups, for admins to review and lift
+type LoginLockout struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	Scope       string    `gorm:"type:varchar(20);not null;index" json:"scope"` // admin, student or quiz
+	Identifier  string    `gorm:"type:varchar(255);index" json:"identifier"`    // Email or phone number; empty when the IP address was locked
+	IPAddress   string    `gorm:"type:varchar(64);index" json:"ip_address"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+
+	// Set when an admin lifted the lockout early
+	UnlockedAt *time.Time `json:"unlocked_at,omitempty"`
+	UnlockedBy *uint      `json:"unlocked_by,omitempty"`
+}
+
+// TableName specifies the table name for LoginLockout model
+func (LoginLockout) TableName() string {
+	return "login_lockouts"
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// OTPCode is a one-time passcode sent to a student to prove they own the
+// phone number, email address or Telegram chat it was sent to. Only a hash of
+// the code is stored.
+type OTPCode struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Channel     string     `gorm:"type:varchar(20);not null" json:"channel"` // sms, email or telegram
+	Destination string     `gorm:"type:varchar(255);not null" json:"destination"`
+	CodeHash    string     `gorm:"type:varchar(255);not null" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	Attempts    int        `gorm:"default:0" json:"attempts"` // Codes entered
+	UsedAt      *time.Time `json:"used_at,omitempty"`
+}
+
+// TableName specifies the table name for OTPCode model
+func (OTPCode) TableName() string {
+	return "otp_codes"
+}
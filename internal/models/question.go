@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,8 +14,75 @@ const (
 	TypeMultipleChoice QuestionType = "multiple_choice"
 	TypeTrueFalse      QuestionType = "true_false"
 	TypeShortAnswer    QuestionType = "short_answer"
+	TypeMultipleSelect QuestionType = "multiple_select" // Several options are correct
+	TypeOrdering       QuestionType = "ordering"        // Put the options in the right order (narabikae)
+	TypeMatching       QuestionType = "matching"        // Pair each prompt with a choice, e.g. kanji with readings
+	TypeFillBlank      QuestionType = "fill_blank"      // Cloze text with one or more ___ gaps
 )
 
+// QuestionTypes lists every supported question type
+var QuestionTypes = []QuestionType{
+	TypeMultipleChoice, TypeTrueFalse, TypeShortAnswer,
+	TypeMultipleSelect, TypeOrdering, TypeMatching, TypeFillBlank,
+}
+
+// IsValid reports whether t is one of the supported question types
+func (t QuestionType) IsValid() bool {
+	for _, known := range QuestionTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// HasOptionList reports whether questions of this type store a JSON array of
+// options that students pick from, which can be referred to by letter
+func (t QuestionType) HasOptionList() bool {
+	return t == TypeMultipleChoice || t == TypeMultipleSelect || t == TypeOrdering
+}
+
+// MatchingOptions is the Options JSON of a matching question
+type MatchingOptions struct {
+	Prompts []string `json:"prompts"`
+	Choices []string `json:"choices"` // May include distractors
+}
+
+// AnswerRules is the normalization applied to typed answers and their key
+// before comparing. Accepted answers may be listed as a JSON array or
+// separated by "|" (except in regex mode, where "|" belongs to the pattern).
+type AnswerRules struct {
+	NFKC      bool `json:"nfkc,omitempty"`       // Unicode NFKC normalization
+	FoldWidth bool `json:"fold_width,omitempty"` // Full-width and half-width forms are equal
+	FoldKana  bool `json:"fold_kana,omitempty"`  // Hiragana and katakana are equal
+	Romaji    bool `json:"romaji,omitempty"`     // Romaji is read as hiragana, so "taberu" matches たべる
+	Regex     bool `json:"regex,omitempty"`      // Accepted answers are regular expressions matching the whole answer
+}
+
+type Difficulty string
+
+const (
+	DifficultyEasy   Difficulty = "easy"
+	DifficultyMedium Difficulty = "medium"
+	DifficultyHard   Difficulty = "hard"
+)
+
+// Difficulties lists every difficulty a question can be tagged with
+var Difficulties = []Difficulty{DifficultyEasy, DifficultyMedium, DifficultyHard}
+
+// IsValid reports whether d is empty (unset) or one of the known difficulties
+func (d Difficulty) IsValid() bool {
+	if d == "" {
+		return true
+	}
+	for _, known := range Difficulties {
+		if d == known {
+			return true
+		}
+	}
+	return false
+}
+
 type Question struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -25,16 +94,103 @@ type Question struct {
 	QuestionType  QuestionType `gorm:"type:varchar(50);not null" json:"question_type"`
 	ImageURL      string       `gorm:"type:varchar(500)" json:"image_url"` // Optional image for the question
 
-	// For multiple choice questions (stored as JSON)
-	Options       string `gorm:"type:json" json:"options"`       // JSON array: ["Option A", "Option B", "Option C", "Option D"]
-	CorrectAnswer string `gorm:"not null" json:"correct_answer"` // For multiple choice: "A", "B", etc. For true/false: "true"/"false"
+	// For multiple choice, multiple select and ordering questions (stored as
+	// JSON); matching questions store MatchingOptions instead
+	Options       string `gorm:"type:text" json:"options"`       // JSON array: ["Option A", "Option B", "Option C", "Option D"]
+	CorrectAnswer string `gorm:"not null" json:"correct_answer"` // For multiple choice: option text, or "A", "B", etc. in stored order. For true/false: "true"/"false"
+
+	// How typed answers (short answer, fill in the blank) are compared with the
+	// key, as AnswerRules JSON; empty compares case-insensitively only
+	AnswerRules string `gorm:"type:varchar(255)" json:"answer_rules"`
 
 	Points      int  `gorm:"not null" json:"points"`        // Manual points per question (no default)
 	OrderNumber int  `gorm:"default:0" json:"order_number"` // For ordering questions in quiz
 	IsActive    bool `gorm:"default:true" json:"is_active"`
+
+	// Used by question bank pools to pick questions
+	Tags       string     `gorm:"type:varchar(255)" json:"tags"`      // Comma-separated, e.g. "vocab,n5"
+	Difficulty Difficulty `gorm:"type:varchar(20)" json:"difficulty"` // Optional: easy, medium or hard
+
+	// Number of the latest QuestionVersion; bumped whenever the content changes
+	Version int `gorm:"not null;default:1" json:"version"`
 }
 
 // TableName specifies the table name for Question model
 func (Question) TableName() string {
 	return "questions"
 }
+
+// QuestionVersion is an immutable copy of a question's content as it was
+// between two edits. Attempts and answers refer to the version they were
+// served, so reviews show what the student actually saw.
+type QuestionVersion struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	QuestionID uint `gorm:"not null;uniqueIndex:idx_question_version" json:"question_id"`
+	Version    int  `gorm:"not null;uniqueIndex:idx_question_version" json:"version"`
+
+	QuestionText  string       `gorm:"type:text;not null" json:"question_text"`
+	QuestionType  QuestionType `gorm:"type:varchar(50);not null" json:"question_type"`
+	ImageURL      string       `gorm:"type:varchar(500)" json:"image_url"`
+	Options       string       `gorm:"type:text" json:"options"`
+	CorrectAnswer string       `gorm:"type:text" json:"correct_answer"`
+	AnswerRules   string       `gorm:"type:varchar(255)" json:"answer_rules"`
+	Points        int          `gorm:"not null" json:"points"`
+}
+
+// TableName specifies the table name for QuestionVersion model
+func (QuestionVersion) TableName() string {
+	return "question_versions"
+}
+
+// OptionList decodes the question's options; it is empty if none are stored
+func (q *Question) OptionList() []string {
+	var options []string
+	if q.Options != "" {
+		json.Unmarshal([]byte(q.Options), &options)
+	}
+	return options
+}
+
+// MatchingOptions decodes a matching question's prompts and choices
+func (q *Question) MatchingOptions() MatchingOptions {
+	var options MatchingOptions
+	if q.Options != "" {
+		json.Unmarshal([]byte(q.Options), &options)
+	}
+	return options
+}
+
+// Rules decodes the question's answer rules; invalid or empty JSON means none
+func (q *Question) Rules() AnswerRules {
+	var rules AnswerRules
+	if q.AnswerRules != "" {
+		json.Unmarshal([]byte(q.AnswerRules), &rules)
+	}
+	return rules
+}
+
+// TagList returns the question's tags, trimmed, lowercased and without duplicates
+func (q *Question) TagList() []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(q.Tags, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// HasTag reports whether the question carries tag (case-insensitive)
+func (q *Question) HasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	for _, t := range q.TagList() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
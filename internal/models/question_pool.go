@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QuestionPool is one "draw N" rule of a question bank package. Each attempt
+// gets DrawCount random active questions matching the pool's filters.
+type QuestionPool struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	QuizPackageID uint       `gorm:"not null;index" json:"quiz_package_id"`
+	Name          string     `gorm:"not null" json:"name"`
+	Tag           string     `gorm:"type:varchar(100)" json:"tag"`       // Empty matches any tag
+	Difficulty    Difficulty `gorm:"type:varchar(20)" json:"difficulty"` // Empty matches any difficulty
+	DrawCount     int        `gorm:"not null;default:1" json:"draw_count"`
+	OrderNumber   int        `gorm:"default:0" json:"order_number"` // Pools are served in this order
+
+	// Active questions currently matching the pool; filled in by handlers
+	Available *int `gorm:"-" json:"available,omitempty"`
+}
+
+// TableName specifies the table name for QuestionPool model
+func (QuestionPool) TableName() string {
+	return "question_pools"
+}
+
+// Matches reports whether the question passes the pool's tag and difficulty filters
+func (p *QuestionPool) Matches(q *Question) bool {
+	if p.Tag != "" && !q.HasTag(p.Tag) {
+		return false
+	}
+	if p.Difficulty != "" && q.Difficulty != p.Difficulty {
+		return false
+	}
+	return true
+}
@@ -20,8 +20,21 @@ type QuizPackage struct {
 	// Maximum number of retakes allowed per student for this package
 	MaxRetakeCount int `gorm:"default:1" json:"max_retake_count"`
 
-	Course    Course     `gorm:"foreignKey:CourseID" json:"course,omitempty"`
-	Questions []Question `gorm:"foreignKey:QuizPackageID" json:"questions,omitempty"`
+	// In question bank mode each attempt gets a random draw from the package's pools
+	QuestionBank bool `gorm:"default:false" json:"question_bank"`
+
+	// Shuffle multiple-choice options into a different order for every attempt
+	ShuffleOptions bool `gorm:"default:false" json:"shuffle_options"`
+
+	Course    Course         `gorm:"foreignKey:CourseID" json:"course,omitempty"`
+	Questions []Question     `gorm:"foreignKey:QuizPackageID" json:"questions,omitempty"`
+	Pools     []QuestionPool `gorm:"foreignKey:QuizPackageID" json:"pools,omitempty"`
+}
+
+// DrawsPerAttempt reports whether students must start an attempt to get the
+// questions, because the set or the option order differs per attempt
+func (p *QuizPackage) DrawsPerAttempt() bool {
+	return p.QuestionBank || p.ShuffleOptions
 }
 
 // TableName specifies the table name for QuizPackage model
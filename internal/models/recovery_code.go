@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RecoveryCode is a single-use code a staff member can sign in with instead of
+// an authenticator code. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID   uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash string     `gorm:"type:varchar(64);not null" json:"-"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
+
+// TableName specifies the table name for RecoveryCode model
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// RefreshToken is one link in a login session's chain of refresh tokens.
+// Each use replaces it with a new one; only a hash of the token is stored.
+type RefreshToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	SessionID    string     `gorm:"type:varchar(64);not null;index" json:"session_id"`
+	TokenHash    string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID *uint      `json:"replaced_by_id,omitempty"` // Set when the token was used to refresh
+	UserAgent    string     `gorm:"type:varchar(255)" json:"user_agent"`
+	IPAddress    string     `gorm:"type:varchar(64)" json:"ip_address"`
+}
+
+// TableName specifies the table name for RefreshToken model
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// TokenRevocation rejects a user's access tokens issued up to CreatedAt: those
+// of one session, or of every session when SessionID is empty. It can be
+// dropped once ExpiresAt has passed, as the tokens it covers have expired too.
+type TokenRevocation struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	SessionID string    `gorm:"type:varchar(64)" json:"session_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	Reason    string    `gorm:"type:varchar(50)" json:"reason"` // logout, reuse or admin
+}
+
+// TableName specifies the table name for TokenRevocation model
+func (TokenRevocation) TableName() string {
+	return "token_revocations"
+}
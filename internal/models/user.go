@@ -9,10 +9,17 @@ import (
 type UserRole string
 
 const (
-	RoleAdmin   UserRole = "admin"
-	RoleStudent UserRole = "student"
+	RoleAdmin     UserRole = "admin"     // Runs the whole site: every course and all staff
+	RoleTeacher   UserRole = "teacher"   // Staff who can create courses and work in those they are members of
+	RoleAssistant UserRole = "assistant" // Staff who help in courses they are members of
+	RoleStudent   UserRole = "student"
 )
 
+// IsStaff reports whether the role signs in to the admin dashboard
+func (r UserRole) IsStaff() bool {
+	return r == RoleAdmin || r == RoleTeacher || r == RoleAssistant
+}
+
 type User struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -29,10 +36,24 @@ type User struct {
 	FacebookURL string   `gorm:"type:varchar(255)" json:"facebook_url"`
 	Role        UserRole `gorm:"type:varchar(20);not null" json:"role"`
 
+	// Chat with the quiz bot, for one-time passcodes sent over Telegram
+	TelegramChatID string `gorm:"type:varchar(64)" json:"telegram_chat_id,omitempty"`
+
+	// Two-factor sign-in for staff. The secret is set when setup starts and
+	// TOTPEnabledAt once the first code from the authenticator app checks out.
+	TOTPSecret    string     `gorm:"type:varchar(64)" json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`
+	TOTPLastStep  int64      `gorm:"default:0" json:"-"` // Time step of the last accepted code, so each code works once
+
 	// For students
 	Attempts []Attempt `gorm:"foreignKey:StudentID" json:"attempts,omitempty"`
 }
 
+// TwoFactorEnabled reports whether the user signs in with an authenticator code
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
 // TableName specifies the table name for User model
 func (User) TableName() string {
 	return "users"
@@ -0,0 +1,185 @@
+// Package otp issues and checks the one-time passcodes students enter to
+// prove they own the phone number or email address they identify with.
+package otp
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/pkg/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Channel is how a code is delivered
+type Channel string
+
+const (
+	ChannelSMS      Channel = "sms"
+	ChannelEmail    Channel = "email"
+	ChannelTelegram Channel = "telegram"
+)
+
+// codeDigits is the length of a passcode
+const codeDigits = 6
+
+var (
+	ErrNoCode          = errors.New("no passcode has been requested")
+	ErrExpired         = errors.New("passcode has expired")
+	ErrTooManyAttempts = errors.New("too many wrong passcodes")
+	ErrInvalidCode     = errors.New("passcode is incorrect")
+)
+
+// RateLimitError is returned when a student asks for codes too often
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("too many passcode requests, try again in %d seconds", int(e.RetryAfter.Seconds()+0.5))
+}
+
+// Policy limits how codes are issued and checked
+type Policy struct {
+	TTL         time.Duration // How long a code stays valid
+	MaxAttempts int           // Wrong entries allowed per code
+	ResendAfter time.Duration // Minimum wait between two codes
+	MaxPerHour  int           // Codes per student per hour
+}
+
+// Issue creates a code for the user, delivers it through the sender and
+// returns the stored record. Requests over the policy's limits get a
+// *RateLimitError. A code that could not be delivered is discarded.
+func Issue(db *gorm.DB, sender Sender, policy Policy, user *models.User, channel Channel, destination string) (*models.OTPCode, error) {
+	now := time.Now()
+
+	code, err := generate()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.HashPassword(code)
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.OTPCode{
+		UserID:      user.ID,
+		Channel:     string(channel),
+		Destination: destination,
+		CodeHash:    hash,
+		ExpiresAt:   now.Add(policy.TTL),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	// The code is stored before the limits are checked so that two requests
+	// arriving together see each other and cannot both slip under them
+	if err := checkLimits(db, policy, &record); err != nil {
+		db.Delete(&record)
+		return nil, err
+	}
+
+	message := Message{Channel: channel, To: destination, Name: user.Name, Code: code, ExpiresAt: record.ExpiresAt}
+	if err := sender.Send(message); err != nil {
+		db.Delete(&record)
+		return nil, err
+	}
+	return &record, nil
+}
+
+// checkLimits returns a *RateLimitError if the user's other codes from the
+// last hour leave no room for record
+func checkLimits(db *gorm.DB, policy Policy, record *models.OTPCode) error {
+	now := record.CreatedAt
+	var recent []models.OTPCode
+	if err := db.Where("user_id = ? AND id <> ? AND created_at > ?", record.UserID, record.ID, now.Add(-time.Hour)).
+		Order("created_at ASC").Find(&recent).Error; err != nil {
+		return err
+	}
+	n := len(recent)
+	if n == 0 {
+		return nil
+	}
+	if wait := recent[n-1].CreatedAt.Add(policy.ResendAfter).Sub(now); wait > 0 {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	if policy.MaxPerHour > 0 && n >= policy.MaxPerHour {
+		return &RateLimitError{RetryAfter: recent[n-policy.MaxPerHour].CreatedAt.Add(time.Hour).Sub(now)}
+	}
+	return nil
+}
+
+// Verify checks code against the user's latest unused passcode and marks it
+// used when it matches. Each code entered counts against the policy's limit.
+func Verify(db *gorm.DB, policy Policy, userID uint, code string) error {
+	var record models.OTPCode
+	err := db.Where("user_id = ? AND used_at IS NULL", userID).Order("id DESC").First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoCode
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if now.After(record.ExpiresAt) {
+		return ErrExpired
+	}
+
+	// Take the try before comparing, so concurrent guesses cannot all pass
+	// the limit check before any of them is counted
+	try := db.Model(&models.OTPCode{}).Where("id = ?", record.ID)
+	if policy.MaxAttempts > 0 {
+		try = try.Where("attempts < ?", policy.MaxAttempts)
+	}
+	result := try.UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTooManyAttempts
+	}
+
+	if !utils.CheckPasswordHash(strings.TrimSpace(code), record.CodeHash) {
+		return ErrInvalidCode
+	}
+
+	// Only one request can use the code, even if two arrive together
+	result = db.Model(&models.OTPCode{}).Where("id = ? AND used_at IS NULL", record.ID).Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoCode
+	}
+	return nil
+}
+
+// Mask hides most of a destination for display, e.g. "*******4567" or "t***@example.com"
+func Mask(destination string) string {
+	if at := strings.Index(destination, "@"); at > 0 {
+		return destination[:1] + strings.Repeat("*", at-1) + destination[at:]
+	}
+	runes := []rune(destination)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+}
+
+func generate() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < codeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", codeDigits, n), nil
+}
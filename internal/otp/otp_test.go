@@ -0,0 +1,92 @@
+package otp
+
+import (
+	"errors"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// keepSender remembers the last code it was asked to send
+type keepSender struct{ code string }
+
+func (s *keepSender) Send(message Message) error {
+	s.code = message.Code
+	return nil
+}
+
+func newStudent(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+	user := &models.User{Name: "Aiko", Email: "aiko@example.com", Password: "x", Role: models.RoleStudent}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestVerifyCountsEveryTry(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		user := newStudent(t, db)
+		policy := Policy{TTL: time.Minute, MaxAttempts: 3}
+		sender := &keepSender{}
+		record, err := Issue(db, sender, policy, user, ChannelEmail, user.Email)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wrong := "000000"
+		if sender.code == wrong {
+			wrong = "111111"
+		}
+		for i := 0; i < policy.MaxAttempts; i++ {
+			if err := Verify(db, policy, user.ID, wrong); !errors.Is(err, ErrInvalidCode) {
+				t.Fatalf("try %d: err = %v, want ErrInvalidCode", i+1, err)
+			}
+		}
+		// Out of tries, the right code is refused too
+		if err := Verify(db, policy, user.ID, sender.code); !errors.Is(err, ErrTooManyAttempts) {
+			t.Errorf("err = %v, want ErrTooManyAttempts", err)
+		}
+
+		var stored models.OTPCode
+		db.First(&stored, record.ID)
+		if stored.Attempts != policy.MaxAttempts || stored.UsedAt != nil {
+			t.Errorf("code has %d attempts, used at %v; want %d and unused", stored.Attempts, stored.UsedAt, policy.MaxAttempts)
+		}
+	})
+}
+
+func TestIssueDiscardsCodesOverTheLimit(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		user := newStudent(t, db)
+		policy := Policy{TTL: time.Minute, ResendAfter: time.Minute, MaxPerHour: 5}
+		sender := &keepSender{}
+		if _, err := Issue(db, sender, policy, user, ChannelEmail, user.Email); err != nil {
+			t.Fatal(err)
+		}
+		first := sender.code
+
+		var limited *RateLimitError
+		if _, err := Issue(db, sender, policy, user, ChannelEmail, user.Email); !errors.As(err, &limited) {
+			t.Fatalf("err = %v, want a RateLimitError", err)
+		}
+		if limited.RetryAfter <= 0 || limited.RetryAfter > policy.ResendAfter {
+			t.Errorf("retry after %v, want up to %v", limited.RetryAfter, policy.ResendAfter)
+		}
+		if sender.code != first {
+			t.Error("a code over the limit was sent")
+		}
+
+		var count int64
+		db.Model(&models.OTPCode{}).Where("user_id = ?", user.ID).Count(&count)
+		if count != 1 {
+			t.Errorf("%d codes stored, want 1", count)
+		}
+		if err := Verify(db, Policy{MaxAttempts: 3}, user.ID, first); err != nil {
+			t.Errorf("first code: %v", err)
+		}
+	})
+}
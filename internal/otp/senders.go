@@ -0,0 +1,178 @@
+package otp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mitsuki-jpy-quiz/config"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is one passcode to deliver
+type Message struct {
+	Channel   Channel
+	To        string // Phone number, email address or Telegram chat ID
+	Name      string
+	Code      string
+	ExpiresAt time.Time
+}
+
+// Text is the message body students receive
+func (m Message) Text() string {
+	minutes := int(time.Until(m.ExpiresAt).Round(time.Minute).Minutes())
+	return fmt.Sprintf("Your Mitsuki JPY quiz code is %s. It expires in %d minutes. Do not share it with anyone.", m.Code, minutes)
+}
+
+// Sender delivers passcodes over one channel
+type Sender interface {
+	Send(message Message) error
+}
+
+// LogSender writes codes to the server log, for local testing
+type LogSender struct{}
+
+func (LogSender) Send(message Message) error {
+	log.Printf("OTP via %s to %s: %s", message.Channel, message.To, message.Code)
+	return nil
+}
+
+// FileSender appends codes to a file, for local testing
+type FileSender struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (s *FileSender) Send(message Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), message.Channel, message.To, message.Code)
+	return err
+}
+
+// SMTPSender emails codes through an SMTP server
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(message Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	body := strings.Join([]string{
+		"From: " + s.From,
+		"To: " + message.To,
+		"Subject: Your quiz verification code",
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		message.Text(),
+	}, "\r\n")
+	return smtp.SendMail(s.Host+":"+strconv.Itoa(s.Port), auth, s.From, []string{message.To}, []byte(body))
+}
+
+// TwilioSender texts codes through the Twilio Messages API
+type TwilioSender struct {
+	AccountSID string
+	AuthToken  string
+	From       string
+	Client     *http.Client
+}
+
+func (s *TwilioSender) Send(message Message) error {
+	form := url.Values{"From": {s.From}, "To": {message.To}, "Body": {message.Text()}}
+	req, err := http.NewRequest(http.MethodPost,
+		"https://api.twilio.com/2010-04-01/Accounts/"+url.PathEscape(s.AccountSID)+"/Messages.json",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.AccountSID, s.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return do(s.Client, req, "twilio")
+}
+
+// TelegramSender messages codes to a student's chat through a Telegram bot
+type TelegramSender struct {
+	BotToken string
+	Client   *http.Client
+}
+
+func (s *TelegramSender) Send(message Message) error {
+	payload, err := json.Marshal(map[string]string{"chat_id": message.To, "text": message.Text()})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost,
+		"https://api.telegram.org/bot"+s.BotToken+"/sendMessage", strings.NewReader(string(payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(s.Client, req, "telegram")
+}
+
+func do(client *http.Client, req *http.Request, provider string) error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", provider, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// NewSenders builds the sender configured for each channel. Channels
+// configured with an empty sender are left out and cannot be used.
+func NewSenders(cfg *config.Config) (map[Channel]Sender, error) {
+	senders := make(map[Channel]Sender)
+	file := &FileSender{Path: cfg.OTPFile}
+	for channel, kind := range map[Channel]string{
+		ChannelSMS:      cfg.OTPSMSSender,
+		ChannelEmail:    cfg.OTPEmailSender,
+		ChannelTelegram: cfg.OTPTelegramSender,
+	} {
+		switch kind {
+		case "":
+			continue
+		case "log":
+			senders[channel] = LogSender{}
+		case "file":
+			senders[channel] = file
+		case "twilio":
+			senders[channel] = &TwilioSender{AccountSID: cfg.TwilioAccountSID, AuthToken: cfg.TwilioAuthToken, From: cfg.TwilioFrom}
+		case "smtp":
+			senders[channel] = &SMTPSender{Host: cfg.SMTPHost, Port: cfg.SMTPPort, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.SMTPFrom}
+		case "telegram":
+			senders[channel] = &TelegramSender{BotToken: cfg.TelegramBotToken}
+		default:
+			return nil, fmt.Errorf("unknown OTP sender %q for %s", kind, channel)
+		}
+	}
+	return senders, nil
+}
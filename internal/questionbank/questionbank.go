@@ -0,0 +1,302 @@
+// Package questionbank decides which questions an attempt is served and
+// remembers that choice, so grading and review use the same set.
+package questionbank
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"mitsuki-jpy-quiz/internal/grading"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/questionversions"
+
+	"gorm.io/gorm"
+)
+
+// activeQuestions returns the package's active questions in display order
+func activeQuestions(db *gorm.DB, packageID uint) ([]models.Question, error) {
+	var questions []models.Question
+	err := db.Where("quiz_package_id = ? AND is_active = ?", packageID, true).
+		Order("order_number ASC, id ASC").
+		Find(&questions).Error
+	return questions, err
+}
+
+// Pools returns the package's pools in the order they are drawn
+func Pools(db *gorm.DB, packageID uint) ([]models.QuestionPool, error) {
+	var pools []models.QuestionPool
+	err := db.Where("quiz_package_id = ?", packageID).
+		Order("order_number ASC, id ASC").
+		Find(&pools).Error
+	return pools, err
+}
+
+// Draw picks the questions for a new attempt. Fixed packages serve every
+// active question in order. Question bank packages draw DrawCount random
+// questions from each pool in pool order; a question is never drawn twice,
+// and a pool with too few matching questions serves all it has. A bank
+// without pools serves every active question shuffled.
+func Draw(db *gorm.DB, quizPackage *models.QuizPackage) ([]models.Question, error) {
+	questions, err := activeQuestions(db, quizPackage.ID)
+	if err != nil || !quizPackage.QuestionBank {
+		return questions, err
+	}
+
+	pools, err := Pools(db, quizPackage.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pools) == 0 {
+		rand.Shuffle(len(questions), func(i, j int) {
+			questions[i], questions[j] = questions[j], questions[i]
+		})
+		return questions, nil
+	}
+
+	drawn := make(map[uint]bool)
+	var served []models.Question
+	for i := range pools {
+		var candidates []models.Question
+		for j := range questions {
+			if !drawn[questions[j].ID] && pools[i].Matches(&questions[j]) {
+				candidates = append(candidates, questions[j])
+			}
+		}
+
+		rand.Shuffle(len(candidates), func(a, b int) {
+			candidates[a], candidates[b] = candidates[b], candidates[a]
+		})
+		if len(candidates) > pools[i].DrawCount {
+			candidates = candidates[:pools[i].DrawCount]
+		}
+
+		for _, question := range candidates {
+			drawn[question.ID] = true
+		}
+		served = append(served, candidates...)
+	}
+
+	return served, nil
+}
+
+// Available counts the active questions each pool can currently draw from,
+// ignoring overlap with earlier pools
+func Available(db *gorm.DB, packageID uint, pools []models.QuestionPool) (map[uint]int, error) {
+	questions, err := activeQuestions(db, packageID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int, len(pools))
+	for i := range pools {
+		for j := range questions {
+			if pools[i].Matches(&questions[j]) {
+				counts[pools[i].ID]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// ServedQuestion is a question as an attempt was shown it. The embedded
+// Question is the current one, which grading uses.
+type ServedQuestion struct {
+	models.Question
+
+	// OptionOrder maps each displayed option position to its index in
+	// Question.Options; nil when the options are shown in stored order
+	OptionOrder []int
+
+	// Version is the revision served; nil for attempts made before
+	// questions were versioned
+	Version *models.QuestionVersion
+}
+
+// Shown returns the question with the content of the served version
+func (s *ServedQuestion) Shown() models.Question {
+	return questionversions.Show(s.Question, s.Version)
+}
+
+// Grade grades an answer resolved against the shown options with the
+// current answer key
+func (s *ServedQuestion) Grade(studentAnswer string) (bool, int) {
+	shown := s.Shown()
+	return grading.Grade(&s.Question, grading.Translate(&s.Question, shown.OptionList(), studentAnswer))
+}
+
+// VersionID returns the ID of the served version, for storing with an answer
+func (s *ServedQuestion) VersionID() *uint {
+	if s.Version == nil {
+		return nil
+	}
+	id := s.Version.ID
+	return &id
+}
+
+// ShownOptions returns the served options JSON in the order the attempt shows them
+func (s *ServedQuestion) ShownOptions() string {
+	question := s.Shown()
+	if s.OptionOrder == nil {
+		return question.Options
+	}
+	options := question.OptionList()
+	shown := make([]string, 0, len(options))
+	for _, i := range s.OptionOrder {
+		if i >= 0 && i < len(options) {
+			shown = append(shown, options[i])
+		}
+	}
+	encoded, err := json.Marshal(shown)
+	if err != nil {
+		return question.Options
+	}
+	return string(encoded)
+}
+
+// Questions strips the served order information
+func Questions(served []ServedQuestion) []models.Question {
+	questions := make([]models.Question, len(served))
+	for i := range served {
+		questions[i] = served[i].Question
+	}
+	return questions
+}
+
+// Serve pairs questions with their current versions, for answering without
+// a recorded attempt
+func Serve(db *gorm.DB, questions []models.Question) ([]ServedQuestion, error) {
+	latest, err := questionversions.Latest(db, questions)
+	if err != nil {
+		return nil, err
+	}
+	served := make([]ServedQuestion, len(questions))
+	for i := range questions {
+		served[i] = ServedQuestion{Question: questions[i]}
+		if version, ok := latest[questions[i].ID]; ok {
+			served[i].Version = &version
+		}
+	}
+	return served, nil
+}
+
+// Record saves the questions served to an attempt, in order. With
+// shuffleOptions each question that lists options (multiple choice, multiple
+// select, ordering) gets its own random option order, which is stored so
+// letters can be mapped back when grading.
+func Record(db *gorm.DB, attemptID uint, questions []models.Question, shuffleOptions bool) ([]ServedQuestion, error) {
+	if len(questions) == 0 {
+		return nil, nil
+	}
+
+	served, err := Serve(db, questions)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]models.AttemptQuestion, len(questions))
+	for i, question := range questions {
+		records[i] = models.AttemptQuestion{
+			AttemptID:         attemptID,
+			QuestionID:        question.ID,
+			Position:          i + 1,
+			QuestionVersionID: served[i].VersionID(),
+		}
+
+		if !shuffleOptions || !question.QuestionType.HasOptionList() {
+			continue
+		}
+		if count := len(question.OptionList()); count > 1 {
+			order := rand.Perm(count)
+			encoded, err := json.Marshal(order)
+			if err != nil {
+				return nil, err
+			}
+			served[i].OptionOrder = order
+			records[i].OptionOrder = string(encoded)
+		}
+	}
+	if err := db.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return served, nil
+}
+
+// Served returns the questions recorded for an attempt in the order they
+// were shown, including any deleted since. It returns nil for attempts made
+// before served questions were recorded.
+func Served(db *gorm.DB, attemptID uint) ([]ServedQuestion, error) {
+	var records []models.AttemptQuestion
+	if err := db.Where("attempt_id = ?", attemptID).Order("position ASC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(records))
+	for i, record := range records {
+		ids[i] = record.QuestionID
+	}
+	var found []models.Question
+	if err := db.Unscoped().Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]models.Question, len(found))
+	for _, question := range found {
+		byID[question.ID] = question
+	}
+	var versionIDs []uint
+	for _, record := range records {
+		if record.QuestionVersionID != nil {
+			versionIDs = append(versionIDs, *record.QuestionVersionID)
+		}
+	}
+	versions, err := questionversions.Find(db, versionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	served := make([]ServedQuestion, 0, len(records))
+	for _, record := range records {
+		question, ok := byID[record.QuestionID]
+		if !ok {
+			continue
+		}
+		s := ServedQuestion{Question: question}
+		if record.QuestionVersionID != nil {
+			if version, ok := versions[*record.QuestionVersionID]; ok {
+				s.Version = &version
+			}
+		}
+		if record.OptionOrder != "" {
+			// A malformed order falls back to the stored order
+			if err := json.Unmarshal([]byte(record.OptionOrder), &s.OptionOrder); err != nil {
+				s.OptionOrder = nil
+			}
+		}
+		served = append(served, s)
+	}
+	return served, nil
+}
+
+// ForAttempt returns the attempt's served questions, falling back to the
+// package's active questions for attempts without a recorded set
+func ForAttempt(db *gorm.DB, attempt *models.Attempt) ([]ServedQuestion, error) {
+	served, err := Served(db, attempt.ID)
+	if err != nil || served != nil {
+		return served, err
+	}
+	questions, err := activeQuestions(db, attempt.QuizPackageID)
+	if err != nil {
+		return nil, err
+	}
+	return Serve(db, questions)
+}
+
+// TotalPoints sums the points of the given questions
+func TotalPoints(questions []models.Question) int {
+	total := 0
+	for _, question := range questions {
+		total += question.Points
+	}
+	return total
+}
@@ -0,0 +1,46 @@
+package questionbank
+
+import (
+	"mitsuki-jpy-quiz/internal/grading"
+	"mitsuki-jpy-quiz/internal/models"
+	"testing"
+)
+
+// A letter answer picks from the options the attempt was shown and is
+// graded by the current key, even after the options were edited
+func TestServedQuestionGrade(t *testing.T) {
+	served := ServedQuestion{
+		Question: models.Question{
+			QuestionType:  models.TypeMultipleChoice,
+			Options:       `["え","い","う"]`,
+			CorrectAnswer: "え",
+			Points:        2,
+		},
+		OptionOrder: []int{2, 0, 1},
+		Version: &models.QuestionVersion{
+			QuestionType: models.TypeMultipleChoice,
+			Options:      `["あ","い","う"]`,
+		},
+	}
+
+	tests := []struct {
+		letter  string
+		stored  string
+		correct bool
+	}{
+		{"B", "あ", true}, // Shown as う, あ, い
+		{"A", "う", false},
+		{"C", "い", false},
+	}
+	for _, tt := range tests {
+		shown := served.Shown()
+		answer := grading.Resolve(&shown, tt.letter, served.OptionOrder)
+		if answer != tt.stored {
+			t.Errorf("%s resolves to %q, want %q", tt.letter, answer, tt.stored)
+		}
+		correct, points := served.Grade(answer)
+		if correct != tt.correct || (points == 2) != tt.correct {
+			t.Errorf("%s graded %v with %d points, want correct = %v", tt.letter, correct, points, tt.correct)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package questionio
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mitsuki-jpy-quiz/internal/models"
+	"strconv"
+	"strings"
+)
+
+// Columns every CSV import must have. Options go in any number of columns
+// whose header starts with "option" or "choice" (option_a, option_b, ...),
+// or in a single "options" column holding a JSON array or "a|b|c". Matching
+// questions put {"prompts": [...], "choices": [...]} in the "options" column.
+var requiredCSVColumns = []string{"question_text", "question_type", "correct_answer", "points"}
+
+func parseCSV(data []byte) ([]Row, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel adds a UTF-8 BOM
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := make(map[string]int)
+	var optionColumns []int
+	for i, name := range header {
+		name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		columns[name] = i
+		if name != "options" && (strings.HasPrefix(name, "option") || strings.HasPrefix(name, "choice")) {
+			optionColumns = append(optionColumns, i)
+		}
+	}
+	for _, name := range requiredCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", name)
+		}
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		if isBlankRecord(record) {
+			continue
+		}
+
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := Row{
+			Line:          line,
+			QuestionText:  cell("question_text"),
+			QuestionType:  cell("question_type"),
+			CorrectAnswer: cell("correct_answer"),
+			ImageURL:      cell("image_url"),
+			Tags:          cell("tags"),
+			Difficulty:    cell("difficulty"),
+			AnswerRules:   cell("answer_rules"),
+		}
+
+		row.Points = parseIntCell(&row, "points", cell("points"))
+		if value := cell("order_number"); value != "" {
+			row.OrderNumber = parseIntCell(&row, "order_number", value)
+		}
+		if value := cell("is_active"); value != "" {
+			active, err := strconv.ParseBool(strings.ToLower(value))
+			if err != nil {
+				row.Errors = append(row.Errors, fmt.Sprintf("is_active %q is not true or false", value))
+			}
+			row.IsActive = &active
+		}
+
+		for _, i := range optionColumns {
+			if i < len(record) {
+				row.Options = append(row.Options, record[i])
+			}
+		}
+		if value := cell("options"); value != "" {
+			row.Options = append(row.Options, splitOptionsCell(&row, value)...)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func parseIntCell(row *Row, name, value string) int {
+	if value == "" {
+		return 0 // Missing values are reported by Build
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("%s %q is not a whole number", name, value))
+	}
+	return n
+}
+
+func splitOptionsCell(row *Row, value string) []string {
+	if strings.HasPrefix(value, "{") {
+		// Matching prompts and choices
+		row.RawOptions = value
+		return nil
+	}
+	if strings.HasPrefix(value, "[") {
+		var options []string
+		if err := json.Unmarshal([]byte(value), &options); err != nil {
+			row.Errors = append(row.Errors, "options is not a valid JSON array of strings")
+			return nil
+		}
+		return options
+	}
+	return strings.Split(value, "|")
+}
+
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteCSV writes questions with one column per option, in the layout parseCSV reads
+func WriteCSV(w io.Writer, questions []models.Question) error {
+	optionCount := 4
+	for _, q := range questions {
+		if n := len(decodeOptions(q.Options)); n > optionCount {
+			optionCount = n
+		}
+	}
+
+	header := []string{"question_text", "question_type"}
+	for i := 0; i < optionCount; i++ {
+		header = append(header, "option_"+optionLabel(i))
+	}
+	header = append(header, "correct_answer", "points", "order_number", "image_url", "is_active", "tags", "difficulty", "answer_rules")
+	hasMatching := false
+	for _, q := range questions {
+		hasMatching = hasMatching || q.QuestionType == models.TypeMatching
+	}
+	if hasMatching {
+		header = append(header, "options")
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, q := range questions {
+		record := []string{q.QuestionText, string(q.QuestionType)}
+		options := decodeOptions(q.Options)
+		for i := 0; i < optionCount; i++ {
+			if i < len(options) {
+				record = append(record, options[i])
+			} else {
+				record = append(record, "")
+			}
+		}
+		record = append(record,
+			q.CorrectAnswer,
+			strconv.Itoa(q.Points),
+			strconv.Itoa(q.OrderNumber),
+			q.ImageURL,
+			strconv.FormatBool(q.IsActive),
+			q.Tags,
+			string(q.Difficulty),
+			q.AnswerRules,
+		)
+		if hasMatching {
+			matching := ""
+			if q.QuestionType == models.TypeMatching {
+				matching = q.Options
+			}
+			record = append(record, matching)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// optionLabel returns a, b, ..., z, aa, ab, ... for option columns
+func optionLabel(i int) string {
+	label := ""
+	for i >= 0 {
+		label = string(rune('a'+i%26)) + label
+		i = i/26 - 1
+	}
+	return label
+}
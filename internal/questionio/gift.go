@@ -0,0 +1,441 @@
+package questionio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mitsuki-jpy-quiz/internal/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GIFT has no notion of points, order, images or tags, so they travel in
+// comments directly above the question:
+//
+//	// points: 5
+//	// order: 3
+//	// image: /uploads/questions/cat.png
+//	// tags: animals, n5
+//	// difficulty: easy
+//	// answer_rules: {"fold_kana": true}
+//	// inactive
+//	::Q1:: 猫はどれですか？ {=ねこ ~いぬ ~とり}
+//
+// Supported question kinds are multiple choice ({=right ~wrong}),
+// true/false ({T} or {F}), short answer ({=answer =other accepted answer}),
+// multiple select ({~%50%right ~%50%right ~%-100%wrong}) and matching
+// ({=prompt -> choice}; "= -> choice" adds a distractor). Ordering and
+// fill-in-the-blank questions have no GIFT form and are exported as comments.
+
+var (
+	giftMeta     = regexp.MustCompile(`^//\s*(points|image|order|tags|difficulty|answer_rules)\s*:\s*(.*)$`)
+	giftInactive = regexp.MustCompile(`^//\s*inactive\s*$`)
+	giftFormat   = regexp.MustCompile(`^\[(html|moodle|plain|markdown)\]`)
+	giftWeight   = regexp.MustCompile(`^%(-?[0-9.]+)%`)
+)
+
+type giftBlock struct {
+	line int
+	text []string
+	meta map[string]string
+}
+
+func parseGIFT(data []byte) ([]Row, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var blocks []giftBlock
+	current := giftBlock{meta: map[string]string{}}
+	flush := func() {
+		if len(current.text) > 0 {
+			blocks = append(blocks, current)
+		}
+		current = giftBlock{meta: map[string]string{}}
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+			if len(current.text) == 0 {
+				if m := giftMeta.FindStringSubmatch(trimmed); m != nil {
+					current.meta[strings.ToLower(m[1])] = strings.TrimSpace(m[2])
+				} else if giftInactive.MatchString(trimmed) {
+					current.meta["inactive"] = ""
+				}
+			}
+		case strings.HasPrefix(trimmed, "$CATEGORY:"):
+			// Categories have no equivalent here
+		default:
+			if len(current.text) == 0 {
+				current.line = i + 1
+			}
+			current.text = append(current.text, line)
+		}
+	}
+	flush()
+
+	rows := make([]Row, 0, len(blocks))
+	for _, block := range blocks {
+		rows = append(rows, parseGIFTBlock(block))
+	}
+	return rows, nil
+}
+
+func parseGIFTBlock(block giftBlock) Row {
+	row := Row{Line: block.line, Points: 1}
+	source := strings.TrimSpace(strings.Join(block.text, "\n"))
+
+	if value, ok := block.meta["points"]; ok {
+		points, err := strconv.Atoi(value)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("points %q is not a whole number", value))
+		}
+		row.Points = points
+	}
+	if value, ok := block.meta["order"]; ok {
+		order, err := strconv.Atoi(value)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("order %q is not a whole number", value))
+		}
+		row.OrderNumber = order
+	}
+	row.ImageURL = block.meta["image"]
+	row.Tags = block.meta["tags"]
+	row.Difficulty = block.meta["difficulty"]
+	row.AnswerRules = block.meta["answer_rules"]
+	if _, ok := block.meta["inactive"]; ok {
+		inactive := false
+		row.IsActive = &inactive
+	}
+
+	// Drop the optional ::title::
+	if strings.HasPrefix(source, "::") {
+		if end := indexUnescaped(source[2:], "::"); end >= 0 {
+			source = source[2+end+2:]
+		}
+	}
+
+	open := indexUnescaped(source, "{")
+	if open < 0 {
+		row.Errors = append(row.Errors, "missing answer block {...}")
+		row.QuestionText = giftUnescape(strings.TrimSpace(source))
+		return row
+	}
+	closing := indexUnescaped(source[open:], "}")
+	if closing < 0 {
+		row.Errors = append(row.Errors, "answer block is not closed with }")
+		row.QuestionText = giftUnescape(strings.TrimSpace(source[:open]))
+		return row
+	}
+	closing += open
+
+	before := strings.TrimSpace(giftFormat.ReplaceAllString(strings.TrimSpace(source[:open]), ""))
+	after := strings.TrimSpace(source[closing+1:])
+	questionText := giftUnescape(before)
+	if after != "" {
+		// Answer block in the middle of the sentence: keep it as a blank
+		questionText += " _____ " + giftUnescape(after)
+	}
+	row.QuestionText = strings.TrimSpace(questionText)
+
+	body := strings.TrimSpace(source[open+1 : closing])
+	parseGIFTAnswers(&row, body)
+	return row
+}
+
+func parseGIFTAnswers(row *Row, body string) {
+	// Feedback after # on a true/false answer is ignored
+	head := strings.TrimSpace(body)
+	if i := indexUnescaped(head, "#"); i >= 0 && !strings.HasPrefix(head, "#") {
+		head = strings.TrimSpace(head[:i])
+	}
+	switch strings.ToUpper(head) {
+	case "T", "TRUE":
+		row.QuestionType, row.CorrectAnswer = string(models.TypeTrueFalse), "true"
+		return
+	case "F", "FALSE":
+		row.QuestionType, row.CorrectAnswer = string(models.TypeTrueFalse), "false"
+		return
+	}
+
+	if body == "" {
+		row.Errors = append(row.Errors, "essay questions ({}) are not supported")
+		return
+	}
+	if strings.HasPrefix(body, "#") {
+		row.Errors = append(row.Errors, "numerical questions ({#...}) are not supported")
+		return
+	}
+
+	answers := splitGIFTAnswers(body)
+	for _, answer := range answers {
+		if strings.Contains(answer, "->") {
+			parseGIFTMatching(row, answers)
+			return
+		}
+	}
+
+	var correct, wrong []string
+	var options []string
+	weighted := false
+	for _, answer := range answers {
+		marker, text := answer[0], strings.TrimSpace(answer[1:])
+		if i := indexUnescaped(text, "#"); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		isCorrect := marker == '='
+		if m := giftWeight.FindStringSubmatch(text); m != nil {
+			// ~%50%answer is one of several right answers
+			weight, _ := strconv.ParseFloat(m[1], 64)
+			if marker == '~' && weight > 0 {
+				isCorrect, weighted = true, true
+			}
+			text = strings.TrimSpace(text[len(m[0]):])
+		}
+		text = giftUnescape(text)
+
+		options = append(options, text)
+		if isCorrect {
+			correct = append(correct, text)
+		} else {
+			wrong = append(wrong, text)
+		}
+	}
+
+	switch {
+	case weighted:
+		row.QuestionType = string(models.TypeMultipleSelect)
+		row.Options = options
+		row.CorrectAnswer = encodeList(correct)
+	case len(wrong) > 0:
+		row.QuestionType = string(models.TypeMultipleChoice)
+		row.Options = options
+		if len(correct) != 1 {
+			row.Errors = append(row.Errors, "multiple choice needs exactly one =correct answer")
+			return
+		}
+		row.CorrectAnswer = correct[0]
+	case len(correct) == 1:
+		row.QuestionType = string(models.TypeShortAnswer)
+		row.CorrectAnswer = correct[0]
+	case len(correct) > 1:
+		// Several accepted answers
+		row.QuestionType = string(models.TypeShortAnswer)
+		row.CorrectAnswer = encodeList(correct)
+	default:
+		row.Errors = append(row.Errors, "answers must start with = or ~")
+	}
+}
+
+// parseGIFTMatching reads {=prompt -> choice ...}; an empty prompt adds a
+// distractor choice
+func parseGIFTMatching(row *Row, answers []string) {
+	row.QuestionType = string(models.TypeMatching)
+
+	var options models.MatchingOptions
+	pairs := make(map[string]string)
+	for _, answer := range answers {
+		arrow := indexUnescaped(answer, "->")
+		if answer[0] != '=' || arrow < 0 {
+			row.Errors = append(row.Errors, "matching answers must all be =prompt -> choice")
+			return
+		}
+		prompt := giftUnescape(strings.TrimSpace(answer[1:arrow]))
+		choice := giftUnescape(strings.TrimSpace(answer[arrow+2:]))
+		options.Choices = append(options.Choices, choice)
+		if prompt != "" {
+			options.Prompts = append(options.Prompts, prompt)
+			pairs[prompt] = choice
+		}
+	}
+
+	encoded, _ := json.Marshal(options)
+	row.RawOptions = string(encoded)
+	key, _ := json.Marshal(pairs)
+	row.CorrectAnswer = string(key)
+}
+
+// splitGIFTAnswers splits "=a ~b ~c" into answers that keep their marker
+func splitGIFTAnswers(body string) []string {
+	var answers []string
+	start := -1
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '=', '~':
+			if start >= 0 {
+				answers = append(answers, body[start:i])
+			}
+			start = i
+		}
+	}
+	if start >= 0 {
+		answers = append(answers, body[start:])
+	}
+	return answers
+}
+
+// indexUnescaped finds sep in s, skipping characters escaped with a backslash
+func indexUnescaped(s, sep string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+var giftUnescaper = strings.NewReplacer(`\~`, "~", `\=`, "=", `\#`, "#", `\{`, "{", `\}`, "}", `\:`, ":", `\n`, "\n", `\\`, `\`)
+
+func giftUnescape(s string) string {
+	return giftUnescaper.Replace(s)
+}
+
+var giftEscaper = strings.NewReplacer(`\`, `\\`, "~", `\~`, "=", `\=`, "#", `\#`, "{", `\{`, "}", `\}`, ":", `\:`, "\n", `\n`)
+
+func giftEscape(s string) string {
+	return giftEscaper.Replace(s)
+}
+
+// WriteGIFT writes questions in GIFT with points and images in comments
+func WriteGIFT(w io.Writer, questions []models.Question) error {
+	var b strings.Builder
+	for i, q := range questions {
+		if q.QuestionType == models.TypeOrdering || q.QuestionType == models.TypeFillBlank {
+			fmt.Fprintf(&b, "// Q%d skipped: %s questions have no GIFT form; export as CSV or JSON instead\n\n", i+1, q.QuestionType)
+			continue
+		}
+		fmt.Fprintf(&b, "// points: %d\n", q.Points)
+		fmt.Fprintf(&b, "// order: %d\n", q.OrderNumber)
+		if q.ImageURL != "" {
+			fmt.Fprintf(&b, "// image: %s\n", q.ImageURL)
+		}
+		if q.Tags != "" {
+			fmt.Fprintf(&b, "// tags: %s\n", q.Tags)
+		}
+		if q.Difficulty != "" {
+			fmt.Fprintf(&b, "// difficulty: %s\n", q.Difficulty)
+		}
+		if q.AnswerRules != "" {
+			fmt.Fprintf(&b, "// answer_rules: %s\n", q.AnswerRules)
+		}
+		if !q.IsActive {
+			b.WriteString("// inactive\n")
+		}
+		fmt.Fprintf(&b, "::Q%d:: %s {", i+1, giftEscape(q.QuestionText))
+
+		switch q.QuestionType {
+		case models.TypeTrueFalse:
+			if strings.EqualFold(strings.TrimSpace(q.CorrectAnswer), "true") {
+				b.WriteString("TRUE}")
+			} else {
+				b.WriteString("FALSE}")
+			}
+		case models.TypeMultipleChoice:
+			b.WriteString("\n")
+			for _, option := range decodeOptions(q.Options) {
+				if strings.TrimSpace(option) == "" {
+					continue
+				}
+				marker := "~"
+				if strings.EqualFold(strings.TrimSpace(option), strings.TrimSpace(q.CorrectAnswer)) {
+					marker = "="
+				}
+				fmt.Fprintf(&b, "\t%s%s\n", marker, giftEscape(option))
+			}
+			b.WriteString("}")
+		case models.TypeMultipleSelect:
+			writeGIFTMultipleSelect(&b, q)
+		case models.TypeMatching:
+			writeGIFTMatching(&b, q)
+		case models.TypeShortAnswer:
+			answers := shortAnswers(q)
+			for i, answer := range answers {
+				answers[i] = "=" + giftEscape(answer)
+			}
+			fmt.Fprintf(&b, "%s}", strings.Join(answers, " "))
+		default:
+			fmt.Fprintf(&b, "=%s}", giftEscape(q.CorrectAnswer))
+		}
+		b.WriteString("\n\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeGIFTMultipleSelect splits 100% between the right options and gives
+// wrong ones -100%
+func writeGIFTMultipleSelect(b *strings.Builder, q models.Question) {
+	options := decodeOptions(q.Options)
+	correct := make(map[string]bool)
+	for _, answer := range decodeList(q.CorrectAnswer) {
+		if matched, ok := matchOption(options, answer); ok {
+			correct[matched] = true
+		}
+	}
+
+	weight := "100"
+	if len(correct) > 0 {
+		weight = strconv.FormatFloat(100/float64(len(correct)), 'f', -1, 64)
+		if len(weight) > 8 {
+			weight = weight[:8]
+		}
+	}
+
+	b.WriteString("\n")
+	for _, option := range options {
+		if strings.TrimSpace(option) == "" {
+			continue
+		}
+		if correct[option] {
+			fmt.Fprintf(b, "\t~%%%s%%%s\n", weight, giftEscape(option))
+		} else {
+			fmt.Fprintf(b, "\t~%%-100%%%s\n", giftEscape(option))
+		}
+	}
+	b.WriteString("}")
+}
+
+// writeGIFTMatching writes one =prompt -> choice per prompt, then any
+// distractor choices with an empty prompt
+func writeGIFTMatching(b *strings.Builder, q models.Question) {
+	options := q.MatchingOptions()
+	var pairs map[string]string
+	json.Unmarshal([]byte(q.CorrectAnswer), &pairs)
+
+	used := make(map[string]bool)
+	b.WriteString("\n")
+	for _, prompt := range options.Prompts {
+		choice := pairs[prompt]
+		used[choice] = true
+		fmt.Fprintf(b, "\t=%s -> %s\n", giftEscape(prompt), giftEscape(choice))
+	}
+	for _, choice := range options.Choices {
+		if !used[choice] {
+			fmt.Fprintf(b, "\t= -> %s\n", giftEscape(choice))
+		}
+	}
+	b.WriteString("}")
+}
+
+// shortAnswers lists a short answer key's accepted answers. Regex keys are
+// written as one answer so their "|" survives.
+func shortAnswers(q models.Question) []string {
+	key := strings.TrimSpace(q.CorrectAnswer)
+	if strings.HasPrefix(key, "[") {
+		if answers := decodeList(key); len(answers) > 0 {
+			return answers
+		}
+	}
+	return []string{key}
+}
@@ -0,0 +1,196 @@
+package questionio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mitsuki-jpy-quiz/internal/models"
+	"strconv"
+	"strings"
+)
+
+// jsonQuestion is the exported shape of a question. Options is a real array
+// (or, for matching, object) here rather than the JSON string stored on the model.
+type jsonQuestion struct {
+	QuestionText  string      `json:"question_text"`
+	QuestionType  string      `json:"question_type"`
+	Options       interface{} `json:"options"`
+	CorrectAnswer string      `json:"correct_answer"`
+	Points        int         `json:"points"`
+	OrderNumber   int         `json:"order_number"`
+	ImageURL      string      `json:"image_url,omitempty"`
+	IsActive      bool        `json:"is_active"`
+	Tags          string      `json:"tags,omitempty"`
+	Difficulty    string      `json:"difficulty,omitempty"`
+	AnswerRules   string      `json:"answer_rules,omitempty"`
+}
+
+// jsonImport accepts looser input than jsonQuestion: options may also be a
+// JSON string (as stored on the model) and numbers may be quoted.
+type jsonImport struct {
+	QuestionText  string          `json:"question_text"`
+	QuestionType  string          `json:"question_type"`
+	Options       json.RawMessage `json:"options"`
+	CorrectAnswer json.RawMessage `json:"correct_answer"`
+	Points        json.Number     `json:"points"`
+	OrderNumber   json.Number     `json:"order_number"`
+	ImageURL      string          `json:"image_url"`
+	IsActive      *bool           `json:"is_active"`
+	Tags          json.RawMessage `json:"tags"`
+	Difficulty    string          `json:"difficulty"`
+	AnswerRules   json.RawMessage `json:"answer_rules"`
+}
+
+func parseJSON(data []byte) ([]Row, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+
+	// Accept a bare array or {"questions": [...]}
+	var items []json.RawMessage
+	if bytes.HasPrefix(data, []byte("{")) {
+		var wrapper struct {
+			Questions []json.RawMessage `json:"questions"`
+		}
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		items = wrapper.Questions
+	} else if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON: expected an array of questions: %w", err)
+	}
+
+	rows := make([]Row, 0, len(items))
+	for i, raw := range items {
+		row := Row{Line: i + 1}
+
+		var item jsonImport
+		if err := json.Unmarshal(raw, &item); err != nil {
+			row.Errors = append(row.Errors, "invalid question object: "+err.Error())
+			rows = append(rows, row)
+			continue
+		}
+
+		row.QuestionText = item.QuestionText
+		row.QuestionType = item.QuestionType
+		row.ImageURL = item.ImageURL
+		row.IsActive = item.IsActive
+		row.Tags = jsonTags(&row, item.Tags)
+		row.Difficulty = item.Difficulty
+		row.AnswerRules = scalarString(item.AnswerRules) // An object or its JSON string
+		row.CorrectAnswer = scalarString(item.CorrectAnswer)
+		row.Points = jsonInt(&row, "points", item.Points)
+		if item.OrderNumber != "" {
+			row.OrderNumber = jsonInt(&row, "order_number", item.OrderNumber)
+		}
+		row.Options = jsonOptions(&row, item.Options)
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func jsonInt(row *Row, name string, value json.Number) int {
+	if value == "" {
+		return 0 // Missing values are reported by Build
+	}
+	n, err := strconv.Atoi(value.String())
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("%s %q is not a whole number", name, value))
+	}
+	return n
+}
+
+// jsonOptions reads options given as an array or as a JSON-encoded string.
+// A matching question's object is kept as is in RawOptions.
+func jsonOptions(row *Row, raw json.RawMessage) []string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		row.RawOptions = string(raw)
+		return nil
+	}
+
+	var options []string
+	if err := json.Unmarshal(raw, &options); err == nil {
+		return options
+	}
+
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		if strings.TrimSpace(encoded) == "" {
+			return nil
+		}
+		if strings.HasPrefix(strings.TrimSpace(encoded), "{") {
+			row.RawOptions = encoded
+			return nil
+		}
+		if err := json.Unmarshal([]byte(encoded), &options); err == nil {
+			return options
+		}
+	}
+
+	row.Errors = append(row.Errors, "options must be an array of strings")
+	return nil
+}
+
+// jsonTags reads tags given as "a,b" or ["a", "b"]
+func jsonTags(row *Row, raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var tags []string
+	if err := json.Unmarshal(raw, &tags); err == nil {
+		return strings.Join(tags, ",")
+	}
+	var joined string
+	if err := json.Unmarshal(raw, &joined); err == nil {
+		return joined
+	}
+	row.Errors = append(row.Errors, "tags must be a string or an array of strings")
+	return ""
+}
+
+// scalarString accepts "true", true or 3 for correct_answer
+func scalarString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// WriteJSON writes questions as an indented JSON array
+func WriteJSON(w io.Writer, questions []models.Question) error {
+	items := make([]jsonQuestion, 0, len(questions))
+	for _, q := range questions {
+		var options interface{} = decodeOptions(q.Options)
+		if q.QuestionType == models.TypeMatching {
+			options = q.MatchingOptions()
+		} else if options.([]string) == nil {
+			options = []string{}
+		}
+		items = append(items, jsonQuestion{
+			QuestionText:  q.QuestionText,
+			QuestionType:  string(q.QuestionType),
+			Options:       options,
+			CorrectAnswer: q.CorrectAnswer,
+			Points:        q.Points,
+			OrderNumber:   q.OrderNumber,
+			ImageURL:      q.ImageURL,
+			IsActive:      q.IsActive,
+			Tags:          q.Tags,
+			Difficulty:    string(q.Difficulty),
+			AnswerRules:   q.AnswerRules,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(items)
+}
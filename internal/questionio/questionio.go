@@ -0,0 +1,254 @@
+// Package questionio converts quiz questions to and from CSV, JSON and
+// Moodle GIFT so packages can be authored in spreadsheets and round-tripped.
+package questionio
+
+import (
+	"encoding/json"
+	"fmt"
+	"mitsuki-jpy-quiz/internal/grading"
+	"mitsuki-jpy-quiz/internal/models"
+	"path/filepath"
+	"strings"
+)
+
+// Supported formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatGIFT = "gift"
+)
+
+// Points range enforced by the question handlers
+const (
+	MinPoints = 1
+	MaxPoints = 100
+)
+
+// Row is one question as read from an import file, before validation
+type Row struct {
+	Line          int // CSV/GIFT source line, or position in a JSON array
+	QuestionText  string
+	QuestionType  string
+	Options       []string
+	RawOptions    string // Matching questions: the MatchingOptions JSON as stored on the model
+	CorrectAnswer string
+	Points        int
+	OrderNumber   int
+	ImageURL      string
+	IsActive      *bool
+	Tags          string
+	Difficulty    string
+	AnswerRules   string // models.AnswerRules JSON for typed answers
+
+	Errors []string // Problems found while parsing, e.g. a non-numeric points cell
+}
+
+// RowError lists everything wrong with one imported row
+type RowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// ParseFormat normalizes a format name; it returns "" for unknown formats
+func ParseFormat(name string) string {
+	switch strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), ".")) {
+	case "csv":
+		return FormatCSV
+	case "json":
+		return FormatJSON
+	case "gift", "txt":
+		return FormatGIFT
+	}
+	return ""
+}
+
+// FormatFromFilename guesses the format from a file extension
+func FormatFromFilename(filename string) string {
+	return ParseFormat(filepath.Ext(filename))
+}
+
+// Parse reads every row of data in the given format. An error means the
+// file as a whole could not be read; row-level problems are kept on the rows.
+func Parse(format string, data []byte) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(data)
+	case FormatJSON:
+		return parseJSON(data)
+	case FormatGIFT:
+		return parseGIFT(data)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// Build validates a row and turns it into a question for the package.
+// It returns every problem found so the whole row can be reported at once.
+func Build(row Row, quizPackageID uint) (models.Question, []string) {
+	errs := append([]string(nil), row.Errors...)
+
+	question := models.Question{
+		QuizPackageID: quizPackageID,
+		QuestionText:  strings.TrimSpace(row.QuestionText),
+		QuestionType:  models.QuestionType(strings.ToLower(strings.TrimSpace(row.QuestionType))),
+		ImageURL:      strings.TrimSpace(row.ImageURL),
+		Points:        row.Points,
+		OrderNumber:   row.OrderNumber,
+		IsActive:      true,
+		Tags:          row.Tags,
+		Difficulty:    models.Difficulty(strings.ToLower(strings.TrimSpace(row.Difficulty))),
+		AnswerRules:   strings.TrimSpace(row.AnswerRules),
+	}
+	question.Tags = strings.Join(question.TagList(), ",")
+	if row.IsActive != nil {
+		question.IsActive = *row.IsActive
+	}
+
+	// The parser could not make sense of the row; further checks would only add noise
+	if question.QuestionType == "" && len(row.Errors) > 0 {
+		return question, errs
+	}
+
+	if question.QuestionText == "" {
+		errs = append(errs, "question_text is required")
+	}
+	if question.Points < MinPoints || question.Points > MaxPoints {
+		errs = append(errs, fmt.Sprintf("points must be between %d and %d", MinPoints, MaxPoints))
+	}
+	if !question.Difficulty.IsValid() {
+		errs = append(errs, fmt.Sprintf("difficulty %q is not valid (use easy, medium or hard)", row.Difficulty))
+	}
+
+	if question.QuestionType == "" {
+		return question, append(errs, "question_type is required")
+	}
+
+	var options []string
+	for _, option := range row.Options {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	answer := strings.TrimSpace(row.CorrectAnswer)
+
+	switch question.QuestionType {
+	case models.TypeMultipleChoice:
+		if len(options) < 2 {
+			errs = append(errs, "multiple_choice needs at least 2 options")
+		}
+		if matched, ok := matchOption(options, answer); ok {
+			answer = matched
+		} else if answer != "" && len(options) >= 2 {
+			errs = append(errs, fmt.Sprintf("correct_answer %q does not match any option", answer))
+		}
+	case models.TypeTrueFalse:
+		switch strings.ToLower(answer) {
+		case "true", "t":
+			answer = "true"
+		case "false", "f":
+			answer = "false"
+		default:
+			if answer != "" {
+				errs = append(errs, "true_false correct_answer must be true or false")
+			}
+		}
+		options = nil
+	case models.TypeShortAnswer, models.TypeFillBlank:
+		options = nil
+	case models.TypeMultipleSelect, models.TypeOrdering:
+		if len(options) < 2 {
+			errs = append(errs, fmt.Sprintf("%s needs at least 2 options", question.QuestionType))
+		}
+	case models.TypeMatching:
+		if row.RawOptions == "" {
+			errs = append(errs, `matching needs options as {"prompts": [...], "choices": [...]}`)
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("question_type %q is not valid (use %s)", row.QuestionType, typeList()))
+	}
+
+	if answer == "" {
+		errs = append(errs, "correct_answer is required")
+	}
+	question.CorrectAnswer = answer
+
+	if options == nil {
+		options = []string{}
+	}
+	encoded, _ := json.Marshal(options)
+	question.Options = string(encoded)
+	if question.QuestionType == models.TypeMatching {
+		question.Options = row.RawOptions
+	}
+
+	// Structured keys and answer rules are checked the way the question API does
+	switch question.QuestionType {
+	case models.TypeShortAnswer, models.TypeMultipleSelect, models.TypeOrdering, models.TypeMatching, models.TypeFillBlank:
+		if answer != "" && len(errs) == 0 {
+			if err := grading.Validate(&question); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	return question, errs
+}
+
+// matchOption finds the option the answer refers to, either by its text
+// (case-insensitive) or by its letter, so "B" picks the second option.
+func matchOption(options []string, answer string) (string, bool) {
+	if answer == "" {
+		return "", false
+	}
+	for _, option := range options {
+		if strings.EqualFold(option, answer) {
+			return option, true
+		}
+	}
+	if len(answer) == 1 {
+		letter := strings.ToUpper(answer)[0]
+		if index := int(letter - 'A'); letter >= 'A' && letter <= 'Z' && index < len(options) {
+			return options[index], true
+		}
+	}
+	return "", false
+}
+
+func typeList() string {
+	names := make([]string, len(models.QuestionTypes))
+	for i, t := range models.QuestionTypes {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+// encodeList stores a list answer key as a JSON array
+func encodeList(items []string) string {
+	if items == nil {
+		items = []string{}
+	}
+	encoded, _ := json.Marshal(items)
+	return string(encoded)
+}
+
+// decodeList reads a list answer key given as a JSON array or "a,b"
+func decodeList(raw string) []string {
+	var items []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &items); err == nil {
+		return items
+	}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// decodeOptions reads the JSON array stored in Question.Options
+func decodeOptions(raw string) []string {
+	var options []string
+	if err := json.Unmarshal([]byte(raw), &options); err != nil {
+		return nil
+	}
+	return options
+}
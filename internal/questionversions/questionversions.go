@@ -0,0 +1,119 @@
+// Package questionversions keeps an immutable copy of each revision of a
+// question, so attempts can show exactly what a student was served even
+// after the question has been edited.
+package questionversions
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Record saves the question's content as a new version when it differs from
+// the latest one (or none exists yet) and sets question.Version to the
+// latest version number. Call it after creating or saving a question.
+func Record(db *gorm.DB, question *models.Question) error {
+	var latest models.QuestionVersion
+	err := db.Where("question_id = ?", question.ID).Order("version DESC").Limit(1).Find(&latest).Error
+	if err != nil {
+		return err
+	}
+
+	version := snapshot(question)
+	if latest.ID != 0 && sameContent(&latest, &version) {
+		version = latest
+	} else {
+		version.Version = latest.Version + 1
+		if err := db.Create(&version).Error; err != nil {
+			return err
+		}
+	}
+
+	if question.Version == version.Version {
+		return nil
+	}
+	question.Version = version.Version
+	return db.Model(&models.Question{}).Where("id = ?", question.ID).UpdateColumn("version", version.Version).Error
+}
+
+// Latest returns the current version of each question, keyed by question ID
+func Latest(db *gorm.DB, questions []models.Question) (map[uint]models.QuestionVersion, error) {
+	latest := make(map[uint]models.QuestionVersion, len(questions))
+	if len(questions) == 0 {
+		return latest, nil
+	}
+	ids := make([]uint, len(questions))
+	for i := range questions {
+		ids[i] = questions[i].ID
+	}
+
+	var versions []models.QuestionVersion
+	if err := db.Where("question_id IN ?", ids).Order("version ASC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		latest[version.QuestionID] = version
+	}
+	return latest, nil
+}
+
+// Find loads versions by ID
+func Find(db *gorm.DB, ids []uint) (map[uint]models.QuestionVersion, error) {
+	found := make(map[uint]models.QuestionVersion, len(ids))
+	if len(ids) == 0 {
+		return found, nil
+	}
+	var versions []models.QuestionVersion
+	if err := db.Where("id IN ?", ids).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		found[version.ID] = version
+	}
+	return found, nil
+}
+
+// List returns a question's versions, newest first
+func List(db *gorm.DB, questionID uint) ([]models.QuestionVersion, error) {
+	var versions []models.QuestionVersion
+	err := db.Where("question_id = ?", questionID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// Show returns the question with the number, text, type, options and image
+// of the given version. Grading fields are left as they are now, so a
+// corrected answer key applies to old attempts too.
+func Show(question models.Question, version *models.QuestionVersion) models.Question {
+	if version == nil {
+		return question
+	}
+	question.Version = version.Version
+	question.QuestionText = version.QuestionText
+	question.QuestionType = version.QuestionType
+	question.ImageURL = version.ImageURL
+	question.Options = version.Options
+	return question
+}
+
+func snapshot(question *models.Question) models.QuestionVersion {
+	return models.QuestionVersion{
+		QuestionID:    question.ID,
+		QuestionText:  question.QuestionText,
+		QuestionType:  question.QuestionType,
+		ImageURL:      question.ImageURL,
+		Options:       question.Options,
+		CorrectAnswer: question.CorrectAnswer,
+		AnswerRules:   question.AnswerRules,
+		Points:        question.Points,
+	}
+}
+
+func sameContent(a, b *models.QuestionVersion) bool {
+	return a.QuestionText == b.QuestionText &&
+		a.QuestionType == b.QuestionType &&
+		a.ImageURL == b.ImageURL &&
+		a.Options == b.Options &&
+		a.CorrectAnswer == b.CorrectAnswer &&
+		a.AnswerRules == b.AnswerRules &&
+		a.Points == b.Points
+}
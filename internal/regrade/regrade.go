@@ -0,0 +1,200 @@
+// Package regrade re-marks stored answers against their questions' current
+// answer keys, so fixing a wrong key also fixes the scores it produced.
+package regrade
+
+import (
+	"mitsuki-jpy-quiz/internal/attempts"
+	"mitsuki-jpy-quiz/internal/grading"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/questionversions"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Comment recorded in the grading history of every answer a regrade changes
+const reviewComment = "Regraded against the updated answer key"
+
+// AttemptChange is the effect of a regrade on one attempt's score
+type AttemptChange struct {
+	AttemptID      uint                 `json:"attempt_id"`
+	StudentID      uint                 `json:"student_id"`
+	StudentName    string               `json:"student_name"`
+	Status         models.AttemptStatus `json:"status"`
+	OldScore       int                  `json:"old_score"`
+	NewScore       int                  `json:"new_score"`
+	Delta          int                  `json:"delta"`
+	TotalPoints    int                  `json:"total_points"`
+	ChangedAnswers int                  `json:"changed_answers"`
+}
+
+// Plan lists what a regrade changes. Answers a teacher graded by hand are
+// left alone and only counted.
+type Plan struct {
+	QuestionIDs     []uint          `json:"question_ids"`
+	AnswersChecked  int             `json:"answers_checked"`
+	AnswersChanged  int             `json:"answers_changed"`
+	SkippedReviewed int             `json:"skipped_reviewed"`
+	Attempts        []AttemptChange `json:"attempts"`
+
+	changes []answerChange
+}
+
+type answerChange struct {
+	answer       models.Answer
+	isCorrect    bool
+	pointsEarned int
+}
+
+// Preview grades every stored answer to the questions again and reports the
+// answers and attempt scores that would change, without saving anything
+func Preview(db *gorm.DB, questions []models.Question) (*Plan, error) {
+	plan := &Plan{QuestionIDs: make([]uint, 0, len(questions)), Attempts: []AttemptChange{}}
+	byID := make(map[uint]*models.Question, len(questions))
+	for i := range questions {
+		byID[questions[i].ID] = &questions[i]
+		plan.QuestionIDs = append(plan.QuestionIDs, questions[i].ID)
+	}
+	if len(questions) == 0 {
+		return plan, nil
+	}
+
+	// Answers of deleted attempts no longer count anywhere
+	var answers []models.Answer
+	if err := db.Joins("JOIN attempts ON attempts.id = answers.attempt_id AND attempts.deleted_at IS NULL").
+		Where("answers.question_id IN ?", plan.QuestionIDs).
+		Order("answers.attempt_id, answers.id").
+		Find(&answers).Error; err != nil {
+		return nil, err
+	}
+
+	// Answers hold the text of the options they were shown
+	var versionIDs []uint
+	for _, answer := range answers {
+		if answer.QuestionVersionID != nil {
+			versionIDs = append(versionIDs, *answer.QuestionVersionID)
+		}
+	}
+	versions, err := questionversions.Find(db, versionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := make(map[uint]int)
+	changed := make(map[uint]int)
+	for _, answer := range answers {
+		plan.AnswersChecked++
+		question := byID[answer.QuestionID]
+		studentAnswer := answer.StudentAnswer
+		if answer.QuestionVersionID != nil {
+			if version, ok := versions[*answer.QuestionVersionID]; ok {
+				shown := questionversions.Show(*question, &version)
+				studentAnswer = grading.Translate(question, shown.OptionList(), studentAnswer)
+			}
+		}
+		isCorrect, pointsEarned := grading.Grade(question, studentAnswer)
+		if isCorrect == answer.IsCorrect && pointsEarned == answer.PointsEarned {
+			continue
+		}
+		if answer.ReviewedAt != nil {
+			plan.SkippedReviewed++
+			continue
+		}
+		plan.AnswersChanged++
+		plan.changes = append(plan.changes, answerChange{answer: answer, isCorrect: isCorrect, pointsEarned: pointsEarned})
+		deltas[answer.AttemptID] += pointsEarned - answer.PointsEarned
+		changed[answer.AttemptID]++
+	}
+	if len(changed) == 0 {
+		return plan, nil
+	}
+
+	attemptIDs := make([]uint, 0, len(changed))
+	for attemptID := range changed {
+		attemptIDs = append(attemptIDs, attemptID)
+	}
+	var affected []models.Attempt
+	if err := db.Where("id IN ?", attemptIDs).Find(&affected).Error; err != nil {
+		return nil, err
+	}
+
+	studentIDs := make([]uint, 0, len(affected))
+	for _, attempt := range affected {
+		studentIDs = append(studentIDs, attempt.StudentID)
+	}
+	var students []models.User
+	db.Unscoped().Where("id IN ?", studentIDs).Find(&students)
+	names := make(map[uint]string, len(students))
+	for _, student := range students {
+		names[student.ID] = student.Name
+	}
+
+	for _, attempt := range affected {
+		plan.Attempts = append(plan.Attempts, AttemptChange{
+			AttemptID:      attempt.ID,
+			StudentID:      attempt.StudentID,
+			StudentName:    names[attempt.StudentID],
+			Status:         attempt.Status,
+			OldScore:       attempt.Score,
+			NewScore:       attempt.Score + deltas[attempt.ID],
+			Delta:          deltas[attempt.ID],
+			TotalPoints:    attempt.TotalPoints,
+			ChangedAnswers: changed[attempt.ID],
+		})
+	}
+	sort.Slice(plan.Attempts, func(i, j int) bool {
+		return plan.Attempts[i].AttemptID < plan.Attempts[j].AttemptID
+	})
+	return plan, nil
+}
+
+// Apply regrades the questions' answers in one transaction: changed answers
+// are updated and logged as reviews by reviewerID, and the scores of completed
+// attempts are re-totalled. In-progress attempts are totalled when they finish.
+func Apply(db *gorm.DB, questions []models.Question, reviewerID uint) (*Plan, error) {
+	var plan *Plan
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if plan, err = Preview(tx, questions); err != nil {
+			return err
+		}
+
+		for _, change := range plan.changes {
+			review := models.AnswerReview{
+				AnswerID:             change.answer.ID,
+				AttemptID:            change.answer.AttemptID,
+				ReviewerID:           reviewerID,
+				PreviousIsCorrect:    change.answer.IsCorrect,
+				PreviousPointsEarned: change.answer.PointsEarned,
+				IsCorrect:            change.isCorrect,
+				PointsEarned:         change.pointsEarned,
+				Comment:              reviewComment,
+			}
+			if err := tx.Create(&review).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Answer{}).Where("id = ?", change.answer.ID).Updates(map[string]interface{}{
+				"is_correct":    change.isCorrect,
+				"points_earned": change.pointsEarned,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		for i := range plan.Attempts {
+			change := &plan.Attempts[i]
+			if change.Status != models.StatusCompleted {
+				continue
+			}
+			if change.NewScore, err = attempts.Rescore(tx, change.AttemptID); err != nil {
+				return err
+			}
+			change.Delta = change.NewScore - change.OldScore
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
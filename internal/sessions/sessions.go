@@ -0,0 +1,243 @@
+// Package sessions manages login sessions: short-lived access tokens, the
+// rotating refresh tokens that renew them, and revoking both.
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mitsuki-jpy-quiz/config"
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/pkg/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalid = errors.New("invalid or expired refresh token")
+	// ErrReused means a refresh token was presented after it had already been
+	// swapped for a new one, so it may have been stolen. Its session is ended.
+	ErrReused = errors.New("refresh token has already been used")
+)
+
+// Client describes where a session is used from
+type Client struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Tokens is what a login or refresh hands to the client
+type Tokens struct {
+	AccessToken      string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+func accessTTL(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.AccessTokenMinutes) * time.Minute
+}
+
+// refreshTTL is how long a session lasts without being used. Revocations are
+// kept as long, which also covers tokens from GenerateJWT.
+func refreshTTL(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.JWTExpireHours) * time.Hour
+}
+
+// Start opens a new session for the user and returns its first tokens
+func Start(db *gorm.DB, cfg *config.Config, user *models.User, client Client) (*Tokens, error) {
+	// Rows nobody can use any more are cleared out as sessions come and go
+	now := time.Now()
+	db.Where("expires_at < ?", now).Delete(&models.TokenRevocation{})
+	db.Where("expires_at < ?", now).Delete(&models.RefreshToken{})
+
+	sessionID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	refresh, raw, err := newRefreshToken(user.ID, sessionID, cfg, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Create(refresh).Error; err != nil {
+		return nil, err
+	}
+	return issue(cfg, user, refresh, raw)
+}
+
+// Refresh swaps a refresh token for a new access and refresh token. Each
+// refresh token works once; presenting one again ends its session.
+func Refresh(db *gorm.DB, cfg *config.Config, token string, client Client) (*Tokens, *models.User, error) {
+	var current models.RefreshToken
+	if err := db.Where("token_hash = ?", hash(token)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalid
+		}
+		return nil, nil, err
+	}
+	if current.ReplacedByID != nil {
+		if err := End(db, cfg, current.UserID, current.SessionID, "reuse"); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrReused
+	}
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return nil, nil, ErrInvalid
+	}
+
+	var user models.User
+	if err := db.First(&user, current.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalid
+		}
+		return nil, nil, err
+	}
+
+	next, raw, err := newRefreshToken(user.ID, current.SessionID, cfg, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		// Two requests racing with the same token: only one may win
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND replaced_by_id IS NULL AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"replaced_by_id": next.ID, "revoked_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrReused
+		}
+		return nil
+	})
+	if errors.Is(err, ErrReused) {
+		if err := End(db, cfg, current.UserID, current.SessionID, "reuse"); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrReused
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := issue(cfg, &user, next, raw)
+	return tokens, &user, err
+}
+
+// Find returns the session a refresh token belongs to
+func Find(db *gorm.DB, token string) (*models.RefreshToken, error) {
+	var refresh models.RefreshToken
+	if err := db.Where("token_hash = ?", hash(token)).First(&refresh).Error; err != nil {
+		return nil, err
+	}
+	return &refresh, nil
+}
+
+// End revokes a session: its refresh tokens stop working and its access
+// tokens are rejected from now on
+func End(db *gorm.DB, cfg *config.Config, userID uint, sessionID, reason string) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("session_id = ? AND revoked_at IS NULL", sessionID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TokenRevocation{
+			UserID:    userID,
+			SessionID: sessionID,
+			ExpiresAt: now.Add(refreshTTL(cfg)),
+			Reason:    reason,
+		}).Error
+	})
+}
+
+// EndAll revokes every session of the user, including access tokens issued
+// without a session, and returns how many sessions were still open
+func EndAll(db *gorm.DB, cfg *config.Config, userID uint, reason string) (int, error) {
+	var sessionIDs []string
+	if err := db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Distinct().Pluck("session_id", &sessionIDs).Error; err != nil {
+		return 0, err
+	}
+	for _, sessionID := range sessionIDs {
+		if err := End(db, cfg, userID, sessionID, reason); err != nil {
+			return 0, err
+		}
+	}
+	err := db.Create(&models.TokenRevocation{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(refreshTTL(cfg)),
+		Reason:    reason,
+	}).Error
+	return len(sessionIDs), err
+}
+
+// IsRevoked reports whether an access token's session was ended. Tokens
+// without a session are revoked by a user-wide revocation made after they
+// were issued.
+func IsRevoked(db *gorm.DB, claims *utils.JWTClaims) (bool, error) {
+	query := db.Model(&models.TokenRevocation{}).Where("user_id = ? AND expires_at > ?", claims.UserID, time.Now())
+	if claims.SessionID != "" {
+		query = query.Where("session_id = ?", claims.SessionID)
+	} else {
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		query = query.Where("session_id = '' AND created_at >= ?", issuedAt)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func newRefreshToken(userID uint, sessionID string, cfg *config.Config, client Client) (*models.RefreshToken, string, error) {
+	raw, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	return &models.RefreshToken{
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenHash: hash(raw),
+		ExpiresAt: time.Now().Add(refreshTTL(cfg)),
+		UserAgent: truncate(client.UserAgent, 255),
+		IPAddress: truncate(client.IPAddress, 64),
+	}, raw, nil
+}
+
+func issue(cfg *config.Config, user *models.User, refresh *models.RefreshToken, raw string) (*Tokens, error) {
+	access, claims, err := utils.GenerateSessionJWT(user.ID, user.Email, string(user.Role), refresh.SessionID, cfg.JWTSecret, accessTTL(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:      access,
+		RefreshToken:     raw,
+		ExpiresAt:        claims.ExpiresAt.Time,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, nil
+}
+
+// Refresh tokens are long random strings, so a plain hash is enough to keep
+// them unusable if the table leaks
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
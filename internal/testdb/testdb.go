@@ -0,0 +1,111 @@
+// Package testdb gives tests a migrated database. SQLite always runs, in a
+// temporary file. PostgreSQL runs as well when TEST_POSTGRES_DSN points at a
+// server the tests may write to; each test gets a schema of its own that is
+// dropped afterwards.
+package testdb
+
+import (
+	"fmt"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/migrations"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Drivers returns the drivers to test against
+func Drivers() []string {
+	drivers := []string{database.DriverSQLite}
+	if os.Getenv("TEST_POSTGRES_DSN") != "" {
+		drivers = append(drivers, database.DriverPostgres)
+	}
+	return drivers
+}
+
+// Each runs fn as a subtest per driver, with database.DB set to a freshly
+// migrated database
+func Each(t *testing.T, fn func(t *testing.T, db *gorm.DB)) {
+	t.Helper()
+	for _, driver := range Drivers() {
+		t.Run(driver, func(t *testing.T) {
+			fn(t, Open(t, driver))
+		})
+	}
+}
+
+var schemaCount atomic.Int64
+
+// Open connects to an empty database for driver, runs the migrations and
+// sets database.DB. Everything is cleaned up when the test ends.
+func Open(t *testing.T, driver string) *gorm.DB {
+	t.Helper()
+
+	var dsn string
+	switch driver {
+	case database.DriverSQLite:
+		dsn = filepath.Join(t.TempDir(), "test.db")
+	case database.DriverPostgres:
+		admin := openDB(t, driver, os.Getenv("TEST_POSTGRES_DSN"))
+		schema := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), schemaCount.Add(1))
+		if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+			t.Fatalf("create schema: %v", err)
+		}
+		t.Cleanup(func() {
+			admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+			closeDB(admin)
+		})
+		dsn = withSearchPath(os.Getenv("TEST_POSTGRES_DSN"), schema)
+	default:
+		t.Fatalf("unknown driver %q", driver)
+	}
+
+	db := openDB(t, driver, dsn)
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		closeDB(db)
+	})
+
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatalf("migrate %s: %v", driver, err)
+	}
+	return db
+}
+
+func openDB(t *testing.T, driver, dsn string) *gorm.DB {
+	t.Helper()
+	dialector, err := database.Dialector(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open %s: %v", driver, err)
+	}
+	return db
+}
+
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// withSearchPath points a PostgreSQL DSN, in URL or key=value form, at schema
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "search_path=" + schema
+	}
+	return dsn + " search_path=" + schema
+}
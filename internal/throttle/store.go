@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"fmt"
+	"mitsuki-jpy-quiz/config"
+	"sync"
+	"time"
+)
+
+// Counter is the failure history of one account or IP address
+type Counter struct {
+	Failures    int // Failures since the window started
+	LastFailure time.Time
+	LockedUntil time.Time // Zero when not locked
+}
+
+// Store keeps counters between requests. Counters expire after the ttl given
+// to Update. Implementations must be safe for concurrent use; a store shared
+// between servers must apply Update atomically.
+type Store interface {
+	Get(key string) (Counter, error)
+	Update(key string, ttl time.Duration, update func(*Counter)) (Counter, error)
+	Delete(key string) error
+}
+
+// MemoryStore keeps counters in this process. Counters are lost on restart
+// and not shared between servers.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastPrune time.Time
+}
+
+type memoryEntry struct {
+	counter   Counter
+	expiresAt time.Time
+}
+
+// How often expired counters are dropped from a MemoryStore
+const pruneInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *MemoryStore) Get(key string) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return Counter{}, nil
+	}
+	return entry.counter, nil
+}
+
+func (s *MemoryStore) Update(key string, ttl time.Duration, update func(*Counter)) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPrune) > pruneInterval {
+		for k, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		entry = memoryEntry{}
+	}
+	update(&entry.counter)
+	entry.expiresAt = now.Add(ttl)
+	s.entries[key] = entry
+	return entry.counter, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// NewStore builds the configured store
+func NewStore(cfg *config.Config) (Store, error) {
+	switch cfg.LoginLimitStore {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown login limit store %q", cfg.LoginLimitStore)
+}
@@ -0,0 +1,194 @@
+// Package throttle slows down and locks out repeated failed sign-ins and
+// lookups. Failures are counted per identifier (an email address or phone
+// number) and per IP address: each failure on an identifier makes the next
+// try wait longer, and too many failures lock the identifier or the IP
+// address for a while.
+package throttle
+
+import (
+	"fmt"
+	"mitsuki-jpy-quiz/internal/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scopes keep counters for different endpoints apart
+const (
+	ScopeAdmin     = "admin"
+	ScopeStudent   = "student"
+	ScopeQuiz      = "quiz"
+	ScopeTwoFactor = "2fa" // Authenticator and recovery codes after a staff password
+)
+
+// Policy sets how failures are punished. Zero values turn a rule off.
+type Policy struct {
+	MaxFailures   int           // Failures on one identifier before it is locked
+	IPMaxFailures int           // Failures from one IP address before it is locked
+	Window        time.Duration // Failures older than this are forgotten
+	Lockout       time.Duration // How long a lockout lasts
+	BaseDelay     time.Duration // Wait after the first failure on an identifier; doubles with each further failure
+	MaxDelay      time.Duration
+}
+
+// Delay is how long an identifier has to wait after its nth failure
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < failures && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func (p Policy) ttl() time.Duration {
+	if p.Lockout > p.Window {
+		return p.Lockout
+	}
+	return p.Window
+}
+
+// BlockedError is returned while an identifier or IP address has to wait
+type BlockedError struct {
+	RetryAfter time.Duration
+	Locked     bool // Locked out rather than slowed down
+}
+
+func (e *BlockedError) Error() string {
+	seconds := int(e.RetryAfter.Seconds() + 0.5)
+	if seconds < 1 {
+		seconds = 1
+	}
+	if e.Locked {
+		return fmt.Sprintf("too many failed attempts, try again in %d seconds", seconds)
+	}
+	return fmt.Sprintf("please wait %d seconds before trying again", seconds)
+}
+
+// Limiter applies policies to counters kept in a store
+type Limiter struct {
+	Store Store
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{Store: store}
+}
+
+func identifierKey(scope, identifier string) string {
+	return scope + ":id:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+func ipKey(scope, ip string) string {
+	return scope + ":ip:" + ip
+}
+
+// Check returns a *BlockedError while the identifier or the IP address is
+// locked out, or the identifier's delay since its last failure has not passed.
+// An empty identifier only checks the IP address.
+func (l *Limiter) Check(policy Policy, scope, ip, identifier string) error {
+	now := time.Now()
+	blocked := &BlockedError{}
+
+	counter, err := l.Store.Get(ipKey(scope, ip))
+	if err != nil {
+		return err
+	}
+	if wait := counter.LockedUntil.Sub(now); wait > 0 {
+		blocked.RetryAfter, blocked.Locked = wait, true
+	}
+
+	if identifier != "" {
+		counter, err := l.Store.Get(identifierKey(scope, identifier))
+		if err != nil {
+			return err
+		}
+		if wait := counter.LockedUntil.Sub(now); wait > blocked.RetryAfter {
+			blocked.RetryAfter, blocked.Locked = wait, true
+		}
+		if now.Sub(counter.LastFailure) < policy.Window {
+			next := counter.LastFailure.Add(policy.Delay(counter.Failures))
+			if wait := next.Sub(now); wait > blocked.RetryAfter {
+				blocked.RetryAfter = wait
+			}
+		}
+	}
+
+	if blocked.RetryAfter > 0 {
+		return blocked
+	}
+	return nil
+}
+
+// Fail counts a failure against the identifier and the IP address. It
+// returns the lockouts the failure started, if any.
+func (l *Limiter) Fail(policy Policy, scope, ip, identifier string) ([]models.LoginLockout, error) {
+	var lockouts []models.LoginLockout
+
+	if identifier != "" {
+		lockout, err := l.count(policy, identifierKey(scope, identifier), policy.MaxFailures)
+		if err != nil {
+			return nil, err
+		}
+		if lockout != nil {
+			lockout.Scope, lockout.Identifier, lockout.IPAddress = scope, identifier, ip
+			lockouts = append(lockouts, *lockout)
+		}
+	}
+
+	lockout, err := l.count(policy, ipKey(scope, ip), policy.IPMaxFailures)
+	if err != nil {
+		return nil, err
+	}
+	if lockout != nil {
+		lockout.Scope, lockout.IPAddress = scope, ip
+		lockouts = append(lockouts, *lockout)
+	}
+	return lockouts, nil
+}
+
+// count adds a failure to a counter and locks it once it reaches max
+func (l *Limiter) count(policy Policy, key string, max int) (*models.LoginLockout, error) {
+	now := time.Now()
+	var lockout *models.LoginLockout
+	_, err := l.Store.Update(key, policy.ttl(), func(counter *Counter) {
+		if now.Sub(counter.LastFailure) >= policy.Window {
+			counter.Failures = 0
+		}
+		counter.Failures++
+		counter.LastFailure = now
+		if max > 0 && counter.Failures >= max && now.After(counter.LockedUntil) {
+			counter.LockedUntil = now.Add(policy.Lockout)
+			lockout = &models.LoginLockout{Failures: counter.Failures, LockedUntil: counter.LockedUntil}
+			counter.Failures = 0
+		}
+	})
+	return lockout, err
+}
+
+// Succeed clears the identifier's failures after a successful sign-in. The
+// IP address keeps its count, so one known password does not reset it.
+func (l *Limiter) Succeed(scope, identifier string) error {
+	return l.Store.Delete(identifierKey(scope, identifier))
+}
+
+// Unlock lifts a recorded lockout
+func (l *Limiter) Unlock(lockout *models.LoginLockout) error {
+	if lockout.Identifier != "" {
+		return l.Store.Delete(identifierKey(lockout.Scope, lockout.Identifier))
+	}
+	return l.Store.Delete(ipKey(lockout.Scope, lockout.IPAddress))
+}
+
+// Record saves lockouts so admins can see them
+func Record(db *gorm.DB, lockouts []models.LoginLockout) error {
+	if len(lockouts) == 0 {
+		return nil
+	}
+	return db.Create(&lockouts).Error
+}
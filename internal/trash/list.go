@@ -0,0 +1,74 @@
+package trash
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Item is a record in the trash
+type Item struct {
+	ID            uint      `json:"id"`
+	Name          string    `json:"name"`
+	CourseID      uint      `json:"course_id"`
+	QuizPackageID *uint     `json:"quiz_package_id,omitempty"`
+	DeletedAt     time.Time `json:"deleted_at"`
+
+	// The course or quiz package is in the trash too and has to be restored first
+	ParentDeleted bool `json:"parent_deleted"`
+
+	// When the purger deletes the record for good; nil when the trash is kept forever
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+}
+
+// Query selects a kind's records in the trash as Items, newest first. Its
+// course column is CourseColumn(kind), for scoping to a user's courses.
+func Query(db *gorm.DB, kind *Kind) *gorm.DB {
+	switch kind {
+	case Courses:
+		return db.Table("courses").
+			Select("courses.id, courses.title AS name, courses.id AS course_id, courses.deleted_at").
+			Where("courses.deleted_at IS NOT NULL").
+			Order("courses.deleted_at DESC")
+
+	case QuizPackages:
+		return db.Table("quiz_packages").
+			Select("quiz_packages.id, quiz_packages.title AS name, quiz_packages.course_id, quiz_packages.deleted_at, " +
+				"courses.deleted_at IS NOT NULL AS parent_deleted").
+			Joins("JOIN courses ON courses.id = quiz_packages.course_id").
+			Where("quiz_packages.deleted_at IS NOT NULL").
+			Order("quiz_packages.deleted_at DESC")
+	}
+
+	// Questions and pools
+	return db.Table(kind.Table).
+		Select(kind.Table + ".id, " + kind.Table + "." + kind.Label + " AS name, quiz_packages.course_id, " +
+			kind.Table + ".quiz_package_id, " + kind.Table + ".deleted_at, " +
+			"quiz_packages.deleted_at IS NOT NULL AS parent_deleted").
+		Joins("JOIN quiz_packages ON quiz_packages.id = " + kind.Table + ".quiz_package_id").
+		Where(kind.Table + ".deleted_at IS NOT NULL").
+		Order(kind.Table + ".deleted_at DESC")
+}
+
+// CourseColumn is the column of Query holding the course ID
+func CourseColumn(kind *Kind) string {
+	if kind == Courses {
+		return "courses.id"
+	}
+	return "quiz_packages.course_id"
+}
+
+// List runs a trash query and fills in when each item will be purged
+func List(query *gorm.DB, retention time.Duration) ([]Item, error) {
+	items := []Item{}
+	if err := query.Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	if retention > 0 {
+		for i := range items {
+			purgeAt := items[i].DeletedAt.Add(retention)
+			items[i].PurgeAt = &purgeAt
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,224 @@
+package trash
+
+import (
+	"log"
+	"mitsuki-jpy-quiz/internal/attempts"
+	"mitsuki-jpy-quiz/internal/database"
+	"mitsuki-jpy-quiz/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Purge permanently deletes a record in the trash with all of its children,
+// deleted or not, and everything recorded against them: student attempts and
+// answers, enrollments, course staff and question versions. Completed
+// attempts that were served a purged question are rescored without it.
+func Purge(db *gorm.DB, kind *Kind, id uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := trashedAt(tx, kind, id); err != nil {
+			return err
+		}
+		return purge(tx, kind, []uint{id})
+	})
+}
+
+// PurgeExpired permanently deletes everything that went to the trash before
+// the cutoff. It returns how many records were purged, not counting children.
+func PurgeExpired(db *gorm.DB, before time.Time) (int, error) {
+	purged := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Parents first, so their children are gone before their own turn
+		for _, kind := range Kinds {
+			var ids []uint
+			err := tx.Unscoped().Model(kind.newModel()).
+				Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+				Pluck("id", &ids).Error
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			if err := purge(tx, kind, ids); err != nil {
+				return err
+			}
+			purged += len(ids)
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func purge(tx *gorm.DB, kind *Kind, ids []uint) error {
+	for _, child := range kind.Children() {
+		var childIDs []uint
+		if err := tx.Unscoped().Model(child.newModel()).Where(child.ParentColumn+" IN ?", ids).Pluck("id", &childIDs).Error; err != nil {
+			return err
+		}
+		if len(childIDs) > 0 {
+			if err := purge(tx, child, childIDs); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := purgeRecords(tx, kind, ids); err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(kind.newModel()).Error
+}
+
+// purgeRecords deletes what was recorded against the records besides their children
+func purgeRecords(tx *gorm.DB, kind *Kind, ids []uint) error {
+	switch kind {
+	case Courses:
+		if err := purgeAttempts(tx, "course_id IN ?", ids); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("course_id IN ?", ids).Delete(&models.Enrollment{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("course_id IN ?", ids).Delete(&models.CourseMember{}).Error
+
+	case QuizPackages:
+		return purgeAttempts(tx, "quiz_package_id IN ?", ids)
+
+	case Questions:
+		lost, err := lostPoints(tx, ids)
+		if err != nil {
+			return err
+		}
+
+		answerIDs := tx.Unscoped().Model(&models.Answer{}).Select("id").Where("question_id IN ?", ids)
+		if err := tx.Where("answer_id IN (?)", answerIDs).Delete(&models.AnswerReview{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("question_id IN ?", ids).Delete(&models.Answer{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("question_id IN ?", ids).Delete(&models.AttemptQuestion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("question_id IN ?", ids).Delete(&models.QuestionVersion{}).Error; err != nil {
+			return err
+		}
+
+		// Finished attempts are scored as if the questions had never been served
+		for attemptID, points := range lost {
+			if err := tx.Model(&models.Attempt{}).Where("id = ?", attemptID).
+				UpdateColumn("total_points", gorm.Expr("total_points - ?", points)).Error; err != nil {
+				return err
+			}
+			if _, err := attempts.Rescore(tx, attemptID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lostPoints returns what the questions were worth in each completed attempt
+// that was served or answered them
+func lostPoints(tx *gorm.DB, questionIDs []uint) (map[uint]int, error) {
+	var questions []models.Question
+	if err := tx.Unscoped().Select("id, points").Where("id IN ?", questionIDs).Find(&questions).Error; err != nil {
+		return nil, err
+	}
+	worth := make(map[uint]int, len(questions))
+	for _, question := range questions {
+		worth[question.ID] = question.Points
+	}
+
+	type servedQuestion struct {
+		AttemptID  uint
+		QuestionID uint
+	}
+	var served, answered []servedQuestion
+	if err := tx.Model(&models.AttemptQuestion{}).Select("attempt_id, question_id").
+		Where("question_id IN ?", questionIDs).Scan(&served).Error; err != nil {
+		return nil, err
+	}
+	// Attempts made before served questions were recorded only have answers
+	if err := tx.Unscoped().Model(&models.Answer{}).Select("attempt_id, question_id").
+		Where("question_id IN ?", questionIDs).Scan(&answered).Error; err != nil {
+		return nil, err
+	}
+
+	pairs := append(served, answered...)
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	attemptIDs := make([]uint, len(pairs))
+	for i, s := range pairs {
+		attemptIDs[i] = s.AttemptID
+	}
+	var completed []uint
+	if err := tx.Model(&models.Attempt{}).Where("id IN ? AND status = ?", attemptIDs, models.StatusCompleted).
+		Pluck("id", &completed).Error; err != nil {
+		return nil, err
+	}
+	isCompleted := make(map[uint]bool, len(completed))
+	for _, id := range completed {
+		isCompleted[id] = true
+	}
+
+	lost := make(map[uint]int)
+	seen := make(map[servedQuestion]bool)
+	for _, s := range pairs {
+		if seen[s] || !isCompleted[s.AttemptID] {
+			continue
+		}
+		seen[s] = true
+		lost[s.AttemptID] += worth[s.QuestionID]
+	}
+	return lost, nil
+}
+
+// purgeAttempts deletes the attempts matching a condition with their answers
+func purgeAttempts(tx *gorm.DB, query string, ids []uint) error {
+	var attemptIDs []uint
+	if err := tx.Unscoped().Model(&models.Attempt{}).Where(query, ids).Pluck("id", &attemptIDs).Error; err != nil {
+		return err
+	}
+	if len(attemptIDs) == 0 {
+		return nil
+	}
+	if err := tx.Where("attempt_id IN ?", attemptIDs).Delete(&models.AnswerReview{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("attempt_id IN ?", attemptIDs).Delete(&models.Answer{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("attempt_id IN ?", attemptIDs).Delete(&models.AttemptQuestion{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", attemptIDs).Delete(&models.Attempt{}).Error
+}
+
+// StartPurger runs PurgeExpired every interval in a background goroutine,
+// purging what has been in the trash longer than retention
+func StartPurger(interval, retention time.Duration) {
+	if interval <= 0 || retention <= 0 {
+		log.Println("Trash purger disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purged, err := PurgeExpired(database.DB, time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("Purger: failed to empty the trash: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Purger: permanently deleted %d records from the trash", purged)
+			}
+		}
+	}()
+
+	log.Printf("Trash purger running every %s, keeping deleted records for %s", interval, retention)
+}
@@ -0,0 +1,83 @@
+package trash
+
+import (
+	"mitsuki-jpy-quiz/internal/models"
+	"mitsuki-jpy-quiz/internal/testdb"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestPurgeQuestionRescoresAttempts(t *testing.T) {
+	testdb.Each(t, func(t *testing.T, db *gorm.DB) {
+		mustCreate := func(value interface{}) {
+			t.Helper()
+			if err := db.Create(value).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		course := &models.Course{Title: "N5 Grammar"}
+		mustCreate(course)
+		pkg := &models.QuizPackage{CourseID: course.ID, Title: "Week 1"}
+		mustCreate(pkg)
+		purged := &models.Question{QuizPackageID: pkg.ID, QuestionText: "猫", QuestionType: models.TypeShortAnswer, CorrectAnswer: "ねこ", Points: 2}
+		kept := &models.Question{QuizPackageID: pkg.ID, QuestionText: "犬", QuestionType: models.TypeShortAnswer, CorrectAnswer: "いぬ", Points: 3}
+		mustCreate(purged)
+		mustCreate(kept)
+		student := &models.User{Name: "Aiko", Email: "aiko@example.com", Password: "x", Role: models.RoleStudent}
+		mustCreate(student)
+
+		// served records the questions an attempt was shown; answered its answers
+		attempt := func(status models.AttemptStatus, served []*models.Question, answered map[*models.Question]int, score, total int) *models.Attempt {
+			a := &models.Attempt{StudentID: student.ID, CourseID: course.ID, QuizPackageID: pkg.ID,
+				Status: status, Score: score, TotalPoints: total}
+			mustCreate(a)
+			for i, q := range served {
+				mustCreate(&models.AttemptQuestion{AttemptID: a.ID, QuestionID: q.ID, Position: i + 1})
+			}
+			for q, points := range answered {
+				answer := &models.Answer{AttemptID: a.ID, QuestionID: q.ID, StudentAnswer: q.CorrectAnswer, IsCorrect: points > 0, PointsEarned: points}
+				mustCreate(answer)
+				mustCreate(&models.AnswerReview{AnswerID: answer.ID, AttemptID: a.ID, IsCorrect: true, PointsEarned: points})
+			}
+			return a
+		}
+		both := []*models.Question{purged, kept}
+		full := attempt(models.StatusCompleted, both, map[*models.Question]int{purged: 2, kept: 3}, 5, 5)
+		skipped := attempt(models.StatusCompleted, both, map[*models.Question]int{kept: 3}, 3, 5)
+		legacy := attempt(models.StatusCompleted, nil, map[*models.Question]int{purged: 2}, 2, 5)
+		other := attempt(models.StatusCompleted, []*models.Question{kept}, map[*models.Question]int{kept: 3}, 3, 3)
+		running := attempt(models.StatusInProgress, both, map[*models.Question]int{purged: 2}, 0, 0)
+
+		if err := Delete(db, Questions, purged.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := Purge(db, Questions, purged.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[*models.Attempt][2]int{
+			full:    {3, 3},
+			skipped: {3, 3},
+			legacy:  {0, 3},
+			other:   {3, 3},
+			running: {0, 0}, // Totalled when it is submitted
+		}
+		for a, scores := range want {
+			var stored models.Attempt
+			db.First(&stored, a.ID)
+			if stored.Score != scores[0] || stored.TotalPoints != scores[1] {
+				t.Errorf("attempt %d = %d/%d, want %d/%d", a.ID, stored.Score, stored.TotalPoints, scores[0], scores[1])
+			}
+		}
+
+		var answers, reviews, served int64
+		db.Unscoped().Model(&models.Answer{}).Where("question_id = ?", purged.ID).Count(&answers)
+		db.Model(&models.AnswerReview{}).Where("answer_id NOT IN (?)", db.Model(&models.Answer{}).Select("id")).Count(&reviews)
+		db.Model(&models.AttemptQuestion{}).Where("question_id = ?", purged.ID).Count(&served)
+		if answers != 0 || reviews != 0 || served != 0 {
+			t.Errorf("left %d answers, %d reviews and %d served records of the purged question", answers, reviews, served)
+		}
+	})
+}
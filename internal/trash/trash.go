@@ -0,0 +1,192 @@
+// Package trash deletes courses, quiz packages, questions and pools softly,
+// together with their children, and restores or purges them later. Children
+// deleted with their parent share its deleted_at, so restoring the parent
+// brings back exactly what was deleted with it.
+package trash
+
+import (
+	"errors"
+	"mitsuki-jpy-quiz/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotInTrash means the record does not exist or was not deleted
+	ErrNotInTrash = errors.New("not in the trash")
+	// ErrParentDeleted means the record's course or quiz package is still in the trash
+	ErrParentDeleted = errors.New("parent is in the trash")
+)
+
+// Kind is a type of record that can go to the trash
+type Kind struct {
+	Name         string // Used in URLs, e.g. quiz-packages
+	Entity       string // Used in the audit log, e.g. quiz_package
+	Table        string
+	Label        string // Column shown in the trash list
+	ParentColumn string // Column pointing at the parent; empty for courses
+
+	newModel func() interface{}
+}
+
+var (
+	Courses = &Kind{
+		Name: "courses", Entity: "course", Table: "courses", Label: "title",
+		newModel: func() interface{} { return &models.Course{} },
+	}
+	QuizPackages = &Kind{
+		Name: "quiz-packages", Entity: "quiz_package", Table: "quiz_packages", Label: "title",
+		ParentColumn: "course_id",
+		newModel:     func() interface{} { return &models.QuizPackage{} },
+	}
+	Questions = &Kind{
+		Name: "questions", Entity: "question", Table: "questions", Label: "question_text",
+		ParentColumn: "quiz_package_id",
+		newModel:     func() interface{} { return &models.Question{} },
+	}
+	Pools = &Kind{
+		Name: "question-pools", Entity: "question_pool", Table: "question_pools", Label: "name",
+		ParentColumn: "quiz_package_id",
+		newModel:     func() interface{} { return &models.QuestionPool{} },
+	}
+)
+
+// Kinds lists every kind, parents before children
+var Kinds = []*Kind{Courses, QuizPackages, Questions, Pools}
+
+// KindByName finds a kind by its URL name
+func KindByName(name string) (*Kind, bool) {
+	for _, kind := range Kinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return nil, false
+}
+
+// Parent returns the kind a record of this kind belongs to, or nil for courses
+func (k *Kind) Parent() *Kind {
+	switch k {
+	case QuizPackages:
+		return Courses
+	case Questions, Pools:
+		return QuizPackages
+	}
+	return nil
+}
+
+// Children returns the kinds that belong to a record of this kind
+func (k *Kind) Children() []*Kind {
+	switch k {
+	case Courses:
+		return []*Kind{QuizPackages}
+	case QuizPackages:
+		return []*Kind{Questions, Pools}
+	}
+	return nil
+}
+
+// Delete moves a record and its live children to the trash
+func Delete(db *gorm.DB, kind *Kind, id uint) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteChildren(tx, kind, []uint{id}, now); err != nil {
+			return err
+		}
+		return tx.Model(kind.newModel()).Where("id = ?", id).UpdateColumn("deleted_at", now).Error
+	})
+}
+
+func deleteChildren(tx *gorm.DB, kind *Kind, ids []uint, now time.Time) error {
+	for _, child := range kind.Children() {
+		var childIDs []uint
+		if err := tx.Model(child.newModel()).Where(child.ParentColumn+" IN ?", ids).Pluck("id", &childIDs).Error; err != nil {
+			return err
+		}
+		if len(childIDs) == 0 {
+			continue
+		}
+		if err := deleteChildren(tx, child, childIDs, now); err != nil {
+			return err
+		}
+		if err := tx.Model(child.newModel()).Where("id IN ?", childIDs).UpdateColumn("deleted_at", now).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore takes a record out of the trash with the children that were deleted
+// along with it. It returns how many records were restored in total.
+func Restore(db *gorm.DB, kind *Kind, id uint) (int64, error) {
+	var restored int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		deletedAt, err := trashedAt(tx, kind, id)
+		if err != nil {
+			return err
+		}
+		if parent := kind.Parent(); parent != nil {
+			var parentID uint
+			if err := tx.Table(kind.Table).Where("id = ?", id).Pluck(kind.ParentColumn, &parentID).Error; err != nil {
+				return err
+			}
+			if _, err := trashedAt(tx, parent, parentID); !errors.Is(err, ErrNotInTrash) {
+				if err == nil {
+					return ErrParentDeleted
+				}
+				return err
+			}
+		}
+
+		count, err := restoreChildren(tx, kind, []uint{id}, deletedAt)
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Model(kind.newModel()).Where("id = ?", id).UpdateColumn("deleted_at", nil)
+		restored = count + result.RowsAffected
+		return result.Error
+	})
+	return restored, err
+}
+
+func restoreChildren(tx *gorm.DB, kind *Kind, ids []uint, deletedAt time.Time) (int64, error) {
+	var restored int64
+	for _, child := range kind.Children() {
+		var childIDs []uint
+		err := tx.Unscoped().Model(child.newModel()).
+			Where(child.ParentColumn+" IN ? AND deleted_at = ?", ids, deletedAt).
+			Pluck("id", &childIDs).Error
+		if err != nil {
+			return 0, err
+		}
+		if len(childIDs) == 0 {
+			continue
+		}
+		count, err := restoreChildren(tx, child, childIDs, deletedAt)
+		if err != nil {
+			return 0, err
+		}
+		result := tx.Unscoped().Model(child.newModel()).Where("id IN ?", childIDs).UpdateColumn("deleted_at", nil)
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		restored += count + result.RowsAffected
+	}
+	return restored, nil
+}
+
+// trashedAt returns when a record went to the trash, or ErrNotInTrash
+func trashedAt(tx *gorm.DB, kind *Kind, id uint) (time.Time, error) {
+	var times []time.Time
+	err := tx.Unscoped().Model(kind.newModel()).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Pluck("deleted_at", &times).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(times) == 0 {
+		return time.Time{}, ErrNotInTrash
+	}
+	return times[0], nil
+}
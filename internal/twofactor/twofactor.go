@@ -0,0 +1,155 @@
+// Package twofactor adds authenticator app (TOTP) codes to staff sign-in.
+// Setting up takes two steps: Setup stores a new secret for the app to scan,
+// and Enable turns it on once the app's first code checks out. Single-use
+// recovery codes stand in for the app when it is lost.
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mitsuki-jpy-quiz/internal/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already on")
+	ErrNotSetUp       = errors.New("two-factor setup has not been started")
+	ErrInvalidCode    = errors.New("code is incorrect or was already used")
+)
+
+// How many recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+// Setup stores a new secret for the user, replacing one from an unfinished setup
+func Setup(db *gorm.DB, user *models.User) (string, error) {
+	if user.TwoFactorEnabled() {
+		return "", ErrAlreadyEnabled
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		return "", err
+	}
+	err = db.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error
+	return secret, err
+}
+
+// Enable turns two-factor sign-in on once code matches the secret from Setup.
+// It returns the user's first recovery codes, which are only shown once.
+func Enable(db *gorm.DB, user *models.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled() {
+		return nil, ErrAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrNotSetUp
+	}
+	usedStep, ok := match(user.TOTPSecret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(user).Updates(map[string]interface{}{"totp_enabled_at": now, "totp_last_step": usedStep}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = NewRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// Verify checks an authenticator code or, failing that, a recovery code, and
+// uses it up. recovery reports which kind matched.
+func Verify(db *gorm.DB, user *models.User, code string) (recovery bool, err error) {
+	if !user.TwoFactorEnabled() {
+		return false, ErrNotSetUp
+	}
+
+	if usedStep, ok := match(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		// Only one request can use the code, even if two arrive together
+		result := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, usedStep).
+			UpdateColumn("totp_last_step", usedStep)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return false, ErrInvalidCode
+		}
+		user.TOTPLastStep = usedStep
+		return false, nil
+	}
+
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, ErrInvalidCode
+	}
+	return true, nil
+}
+
+// Disable turns two-factor sign-in off and discards the secret and recovery codes
+func Disable(db *gorm.DB, user *models.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+	})
+}
+
+// NewRecoveryCodes replaces the user's recovery codes and returns the new ones
+func NewRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(codes[i])}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RecoveryCodesLeft counts the user's unused recovery codes
+func RecoveryCodesLeft(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// Recovery codes are random, so a plain hash is enough. Case, spaces and
+// dashes are ignored when they are typed in.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,15 +1,18 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type JWTClaims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"` // Login session the token belongs to, for revocation
 	jwt.RegisteredClaims
 }
 
@@ -28,6 +31,45 @@ func GenerateJWT(userID uint, email, role, secret string, expireHours int) (stri
 	return token.SignedString([]byte(secret))
 }
 
+// GenerateSessionJWT signs a short-lived access token for a login session.
+// Unlike GenerateJWT it carries the session ID and its own ID (jti), so it
+// can be revoked before it expires.
+func GenerateSessionJWT(userID uint, email, role, sessionID, secret string, lifetime time.Duration) (string, *JWTClaims, error) {
+	id, err := RandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// RandomToken returns n random bytes, hex encoded
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func ValidateJWT(tokenString, secret string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(secret), nil
@@ -37,7 +79,107 @@ func ValidateJWT(tokenString, secret string) (*JWTClaims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+	// Quiz tokens are signed with the same secret but are not login tokens
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid && len(claims.Audience) == 0 {
+		return claims, nil
+	}
+
+	return nil, jwt.ErrSignatureInvalid
+}
+
+// QuizTokenAudience marks tokens that only let a phone-verified student take
+// one quiz, so they cannot be used as login tokens or the other way round
+const QuizTokenAudience = "quiz"
+
+type QuizClaims struct {
+	StudentID     uint `json:"student_id"`
+	CourseID      uint `json:"course_id"`
+	QuizPackageID uint `json:"quiz_package_id"`
+	jwt.RegisteredClaims
+}
+
+// GenerateQuizToken signs a token for one student, course and quiz package.
+// Its random ID (jti) lets the server accept it for a single attempt.
+func GenerateQuizToken(studentID, courseID, quizPackageID uint, secret string, lifetime time.Duration) (string, *QuizClaims, error) {
+	id, err := RandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &QuizClaims{
+		StudentID:     studentID,
+		CourseID:      courseID,
+		QuizPackageID: quizPackageID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Audience:  jwt.ClaimStrings{QuizTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+func ValidateQuizToken(tokenString, secret string) (*QuizClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &QuizClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithAudience(QuizTokenAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*QuizClaims); ok && token.Valid && claims.ID != "" {
+		return claims, nil
+	}
+
+	return nil, jwt.ErrSignatureInvalid
+}
+
+// TwoFactorTokenAudience marks tokens given out after a staff password check
+// when a second factor is still needed. They only let the user finish signing
+// in, so they cannot be used as login tokens.
+const TwoFactorTokenAudience = "2fa"
+
+type TwoFactorClaims struct {
+	UserID uint `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// GenerateTwoFactorToken signs a pending sign-in token for a user whose
+// password was correct
+func GenerateTwoFactorToken(userID uint, secret string, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	claims := &TwoFactorClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{TwoFactorTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+func ValidateTwoFactorToken(tokenString, secret string) (*TwoFactorClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &TwoFactorClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithAudience(TwoFactorTokenAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*TwoFactorClaims); ok && token.Valid && claims.UserID != 0 {
 		return claims, nil
 	}
 
@@ -2,7 +2,10 @@
 function dashboard() {
     return {
         user: {},
-        token: '',
+        // Read on every use, as session.js replaces it when it refreshes
+        get token() {
+            return localStorage.getItem('token');
+        },
         currentView: 'overview',
         viewTitle: 'Overview',
         mobileMenuOpen: false, // Mobile menu state
@@ -42,10 +45,53 @@ function dashboard() {
         filteredAllStudents: [],
         filteredCourseEnrollments: [],
         
+        // Staff: the signed-in user's role in each course, and all staff for admins
+        courseRoles: {},
+        staff: [],
+        
+        // Audit log (Admin only)
+        auditLogs: [],
+        auditFilters: { q: '', action: '', from: '', to: '' },
+        auditPage: 1,
+        auditTotalPages: 1,
+        auditTotal: 0,
+        
+        // Login lockouts (Admin only)
+        lockouts: [],
+        lockoutsActiveOnly: true,
+        
+        // Two-factor authentication of the signed-in user
+        twoFactorRequired: false,
+        recoveryCodesLeft: 0,
+        twoFactorSetup: null, // Secret and URI while setting up
+        recoveryCodes: [], // Shown once after they are made
+        
+        // Trash: deleted records of one kind
+        trashKind: 'courses',
+        trashItems: [],
+        
+        get isAdmin() {
+            return this.user.role === 'admin';
+        },
+        
+        // Admins and teachers can start courses
+        get canCreateCourses() {
+            return this.user.role === 'admin' || this.user.role === 'teacher';
+        },
+        
+        // Owners and course teachers change packages and questions
+        canEditCourse(courseId) {
+            return this.isAdmin || ['owner', 'teacher'].includes(this.courseRoles[courseId]);
+        },
+        
+        // Owners change the course itself and its staff
+        canManageCourse(courseId) {
+            return this.isAdmin || this.courseRoles[courseId] === 'owner';
+        },
+        
         // Initialize
         async init() {
             // Check authentication
-            this.token = localStorage.getItem('token');
             const userStr = localStorage.getItem('user');
             
             if (!this.token || !userStr) {
@@ -56,6 +102,7 @@ function dashboard() {
             this.user = JSON.parse(userStr);
             
             // Load initial data
+            await this.loadMe();
             await this.loadStats();
             await this.loadCourses();
         },
@@ -111,13 +158,190 @@ function dashboard() {
                     this.viewTitle = 'Students';
                     await this.loadStudents();
                     break;
+                case 'staff':
+                    this.viewTitle = 'Staff';
+                    await this.loadStaff();
+                    break;
+                case 'audit':
+                    this.viewTitle = 'Audit Log';
+                    await this.loadAuditLogs(1);
+                    break;
+                case 'lockouts':
+                    this.viewTitle = 'Lockouts';
+                    await this.loadLockouts();
+                    break;
+                case 'trash':
+                    this.viewTitle = 'Trash';
+                    await this.loadTrash();
+                    break;
+                case 'security':
+                    this.viewTitle = 'Two-Factor Authentication';
+                    this.twoFactorSetup = null;
+                    this.recoveryCodes = [];
+                    await this.loadMe();
+                    break;
             }
         },
         
         // Load Data
+        async loadMe() {
+            const data = await this.apiCall('/api/admin/me');
+            if (data && data.user) {
+                this.user = data.user;
+                this.courseRoles = data.course_roles || {};
+                this.twoFactorRequired = data.two_factor_required;
+                this.recoveryCodesLeft = data.recovery_codes_left || 0;
+            }
+        },
+        
+        async loadStaff() {
+            const data = await this.apiCall('/api/admin/staff');
+            this.staff = Array.isArray(data) ? data : [];
+        },
+        
+        auditQuery() {
+            const params = new URLSearchParams();
+            Object.entries(this.auditFilters).forEach(([key, value]) => {
+                if (value) params.set(key, value);
+            });
+            return params;
+        },
+        
+        async loadAuditLogs(page = this.auditPage) {
+            const params = this.auditQuery();
+            params.set('page', page);
+            params.set('per_page', 50);
+            
+            const data = await this.apiCall(`/api/admin/audit-logs?${params}`);
+            if (data && data.items) {
+                this.auditLogs = data.items;
+                this.auditPage = data.page;
+                this.auditTotal = data.total;
+                this.auditTotalPages = Math.max(data.total_pages, 1);
+            } else {
+                alert(data?.error || 'Failed to load audit log');
+            }
+        },
+        
+        // Readable summary of what an entry changed
+        auditSummary(entry) {
+            if (entry.changes) {
+                const changes = JSON.parse(entry.changes);
+                return Object.entries(changes)
+                    .map(([field, change]) => `${field}: ${JSON.stringify(change.from)} → ${JSON.stringify(change.to)}`)
+                    .join('; ');
+            }
+            if (entry.before && !entry.after) return 'deleted';
+            if (entry.after && !entry.before) return 'created';
+            return '';
+        },
+        
+        showAuditEntry(entry) {
+            const escape = (text) => String(text).replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+            const pretty = (json) => json ? escape(JSON.stringify(JSON.parse(json), null, 2)) : '<span class="text-gray-400">none</span>';
+            const modal = `
+                <div class="space-y-3 text-sm">
+                    <p><span class="font-medium">${escape(entry.action)}</span> on ${escape(entry.entity_type)} ${escape(entry.entity_id)} by ${escape(entry.actor_email || 'unknown')} (${escape(entry.actor_role || '-')})</p>
+                    <p class="text-gray-500">${escape(entry.method)} ${escape(entry.path)} → ${entry.status} · ${escape(entry.ip_address)} · ${this.formatDate(entry.created_at)}</p>
+                    <div><h4 class="font-medium mb-1">Changes</h4><pre class="bg-gray-50 p-2 rounded overflow-x-auto text-xs">${pretty(entry.changes)}</pre></div>
+                    <div><h4 class="font-medium mb-1">Before</h4><pre class="bg-gray-50 p-2 rounded overflow-x-auto text-xs max-h-60">${pretty(entry.before)}</pre></div>
+                    <div><h4 class="font-medium mb-1">After</h4><pre class="bg-gray-50 p-2 rounded overflow-x-auto text-xs max-h-60">${pretty(entry.after)}</pre></div>
+                </div>
+            `;
+            showCustomModal('Audit Entry', modal);
+        },
+        
+        async exportAuditLogs() {
+            const response = await fetch(`/api/admin/audit-logs/export?${this.auditQuery()}`, {
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            if (!response.ok) {
+                alert('Failed to export audit log. Please try again.');
+                return;
+            }
+            
+            const disposition = response.headers.get('Content-Disposition') || '';
+            const match = disposition.match(/filename="([^"]+)"/);
+            const url = URL.createObjectURL(await response.blob());
+            const link = document.createElement('a');
+            link.href = url;
+            link.download = match ? match[1] : 'audit-log.csv';
+            document.body.appendChild(link);
+            link.click();
+            link.remove();
+            URL.revokeObjectURL(url);
+        },
+        
+        async loadLockouts() {
+            const params = new URLSearchParams({ per_page: 200 });
+            if (this.lockoutsActiveOnly) params.set('active', 'true');
+            const data = await this.apiCall(`/api/admin/lockouts?${params}`);
+            this.lockouts = data && data.items ? data.items : [];
+        },
+        
+        isLockoutActive(lockout) {
+            return !lockout.unlocked_at && new Date(lockout.locked_until) > new Date();
+        },
+        
+        async unlockLockout(lockout) {
+            if (!confirm(`Lift the lockout on ${lockout.identifier || lockout.ip_address}?`)) return;
+            
+            const response = await fetch(`/api/admin/lockouts/${lockout.id}/unlock`, {
+                method: 'POST',
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            if (!response.ok) {
+                const data = await response.json();
+                alert(data.error || 'Failed to unlock');
+            }
+            await this.loadLockouts();
+        },
+        
+        async loadTrash(kind = this.trashKind) {
+            this.trashKind = kind;
+            const data = await this.apiCall(`/api/admin/trash/${kind}`);
+            this.trashItems = Array.isArray(data) ? data : [];
+        },
+        
+        async restoreTrashItem(item) {
+            const response = await fetch(`/api/admin/trash/${this.trashKind}/${item.id}/restore`, {
+                method: 'POST',
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                alert(data.error || 'Failed to restore');
+                return;
+            }
+            await this.loadTrash();
+        },
+        
+        async purgeTrashItem(item) {
+            if (!confirm(`Permanently delete "${item.name}"? Everything in it and every student result recorded against it is deleted too. This cannot be undone.`)) return;
+            
+            const response = await fetch(`/api/admin/trash/${this.trashKind}/${item.id}`, {
+                method: 'DELETE',
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                alert(data.error || 'Failed to delete');
+                return;
+            }
+            await this.loadTrash();
+        },
+        
         async loadStats() {
             const [courses, studentData] = await Promise.all([
-                this.apiCall('/api/student/courses'),
+                this.apiCall('/api/admin/courses'),
                 this.apiCall('/api/admin/students/courses')
             ]);
             
@@ -145,7 +369,7 @@ function dashboard() {
         },
         
         async loadCourses() {
-            const data = await this.apiCall('/api/student/courses');
+            const data = await this.apiCall('/api/admin/courses');
             this.courses = data || [];
             this.stats.courses = this.courses.length;
         },
@@ -176,7 +400,7 @@ function dashboard() {
             
             this.questions = [];
             for (const pkg of this.packages) {
-                const data = await this.apiCall(`/api/student/questions/package/${pkg.id}`);
+                const data = await this.apiCall(`/api/admin/questions/package/${pkg.id}`);
                 if (data) {
                     data.forEach(q => {
                         this.questions.push({...q, quiz_package_id: pkg.id});
@@ -232,8 +456,17 @@ function dashboard() {
             
             const result = await this.apiCall(`/api/admin/enrollments/${enrollmentId}/status`, 'PUT', { status });
             
+            if (result && result.error) {
+                alert(result.error);
+                return;
+            }
+            
             if (result) {
-                alert(`Enrollment ${status} successfully!`);
+                let message = `Enrollment ${status} successfully!`;
+                if (result.promoted && result.promoted.length > 0) {
+                    message += ` The next student on the waitlist was approved automatically.`;
+                }
+                alert(message);
                 // Reload enrollments
                 if (this.selectedCourseForStudents) {
                     await this.selectCourseForStudents(this.selectedCourseForStudents);
@@ -397,6 +630,8 @@ function dashboard() {
                 this.showPackageModal();
             } else if (this.currentView === 'questions') {
                 this.showQuestionModal();
+            } else if (this.currentView === 'staff') {
+                this.showStaffModal();
             }
         },
         
@@ -428,7 +663,7 @@ function dashboard() {
                             </div>
                             <div>
                                 <label class="block text-sm font-medium text-gray-700 mb-1">Exam Time (min)</label>
-                                <input type="number" id="courseExamTime" value="${course?.exam_time || 60}" 
+                                <input type="number" id="courseExamTime" value="${course?.exam_time || 60}" min="1" 
                                        class="w-full px-3 py-2 border border-gray-300 rounded-lg" required>
                             </div>
                         </div>
@@ -461,7 +696,7 @@ function dashboard() {
         },
         
         async deleteCourse(id) {
-            if (!confirm('Are you sure you want to delete this course?')) return;
+            if (!confirm('Move this course with its quiz packages and questions to the trash?')) return;
             
             const response = await fetch(`/api/admin/courses/${id}`, {
                 method: 'DELETE',
@@ -475,6 +710,25 @@ function dashboard() {
             }
         },
         
+        async copyCourse(course) {
+            if (!confirm(`Copy "${course.title}" with all its quiz packages and questions? Students and results are not copied.`)) return;
+            
+            const response = await fetch(`/api/admin/courses/${course.id}/clone`, {
+                method: 'POST',
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            
+            if (response.ok) {
+                await this.loadCourses();
+                await this.loadPackages();
+                await this.loadStats();
+            } else {
+                alert('Failed to copy course. Please try again.');
+            }
+        },
+        
         // Package operations
         showPackageModal(pkg = null) {
             const isEdit = !!pkg;
@@ -516,6 +770,22 @@ function dashboard() {
                                    class="w-4 h-4 text-blue-600 rounded">
                             <label for="packageIsActive" class="ml-2 text-sm text-gray-700">Active</label>
                         </div>
+                        <div>
+                            <div class="flex items-center">
+                                <input type="checkbox" id="packageQuestionBank" ${pkg?.question_bank ? 'checked' : ''} 
+                                       class="w-4 h-4 text-blue-600 rounded">
+                                <label for="packageQuestionBank" class="ml-2 text-sm text-gray-700">Question bank mode</label>
+                            </div>
+                            <p class="text-xs text-gray-500 mt-1 ml-6">Each attempt gets a random draw from the package's pools instead of every question</p>
+                        </div>
+                        <div>
+                            <div class="flex items-center">
+                                <input type="checkbox" id="packageShuffleOptions" ${pkg?.shuffle_options ? 'checked' : ''} 
+                                       class="w-4 h-4 text-blue-600 rounded">
+                                <label for="packageShuffleOptions" class="ml-2 text-sm text-gray-700">Shuffle answer options</label>
+                            </div>
+                            <p class="text-xs text-gray-500 mt-1 ml-6">Multiple-choice options appear in a different order for every attempt</p>
+                        </div>
                     </div>
                     <div class="mt-6 flex gap-3">
                         <button type="submit" class="flex-1 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700">
@@ -540,7 +810,7 @@ function dashboard() {
         },
         
         async deletePackage(id) {
-            if (!confirm('Are you sure you want to delete this quiz package?')) return;
+            if (!confirm('Move this quiz package with its questions to the trash?')) return;
             
             const response = await fetch(`/api/admin/quiz-packages/${id}`, {
                 method: 'DELETE',
@@ -554,6 +824,153 @@ function dashboard() {
             }
         },
         
+        async showPoolsModal(pkg) {
+            const response = await fetch(`/api/admin/quiz-packages/${pkg.id}/pools`, {
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            if (!response.ok) {
+                alert('Failed to load pools. Please try again.');
+                return;
+            }
+            const data = await response.json();
+            
+            const escape = (text) => String(text).replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+            const rows = data.pools.map(pool => `
+                <tr class="border-b">
+                    <td class="py-2 pr-2">${escape(pool.name)}</td>
+                    <td class="py-2 pr-2">${pool.tag ? escape(pool.tag) : '<span class="text-gray-400">any</span>'}</td>
+                    <td class="py-2 pr-2">${pool.difficulty || '<span class="text-gray-400">any</span>'}</td>
+                    <td class="py-2 pr-2 text-right">${pool.draw_count}</td>
+                    <td class="py-2 pr-2 text-right ${pool.available < pool.draw_count ? 'text-red-600 font-medium' : ''}">${pool.available}</td>
+                    <td class="py-2 text-right">
+                        <button type="button" onclick="deleteQuestionPool(${pool.id}, ${pkg.id})" class="text-red-600 hover:text-red-700 text-xs">Delete</button>
+                    </td>
+                </tr>
+            `).join('');
+            
+            const modal = `
+                <div class="space-y-4">
+                    <p class="text-sm ${data.question_bank ? 'text-gray-600' : 'text-amber-700'}">
+                        ${data.question_bank
+                            ? `Each attempt draws <strong>${data.questions_per_attempt}</strong> questions from these pools, in pool order.`
+                            : 'Question bank mode is off for this package, so every active question is served. Turn it on in the package settings to use these pools.'}
+                    </p>
+                    <table class="w-full text-sm">
+                        <thead>
+                            <tr class="border-b text-left text-gray-500">
+                                <th class="py-2 pr-2 font-medium">Pool</th>
+                                <th class="py-2 pr-2 font-medium">Tag</th>
+                                <th class="py-2 pr-2 font-medium">Difficulty</th>
+                                <th class="py-2 pr-2 font-medium text-right">Draw</th>
+                                <th class="py-2 pr-2 font-medium text-right">Available</th>
+                                <th></th>
+                            </tr>
+                        </thead>
+                        <tbody>
+                            ${rows || '<tr><td colspan="6" class="py-4 text-center text-gray-400">No pools yet</td></tr>'}
+                        </tbody>
+                    </table>
+                    <form onsubmit="event.preventDefault(); createQuestionPool(${pkg.id});" class="grid grid-cols-2 gap-3 pt-4 border-t">
+                        <input type="text" id="poolName" placeholder="Pool name" required class="col-span-2 px-3 py-2 border border-gray-300 rounded-lg">
+                        <input type="text" id="poolTag" placeholder="Tag (empty = any)" class="px-3 py-2 border border-gray-300 rounded-lg">
+                        <select id="poolDifficulty" class="px-3 py-2 border border-gray-300 rounded-lg">
+                            <option value="">Any difficulty</option>
+                            <option value="easy">Easy</option>
+                            <option value="medium">Medium</option>
+                            <option value="hard">Hard</option>
+                        </select>
+                        <input type="number" id="poolDrawCount" min="1" value="5" required class="px-3 py-2 border border-gray-300 rounded-lg">
+                        <button type="submit" class="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700">Add Pool</button>
+                    </form>
+                </div>
+            `;
+            closeCustomModal();
+            showCustomModal(`Question Pools: ${escape(pkg.title)}`, modal);
+        },
+        
+        async showGradingModal(pkg, status = 'pending') {
+            const response = await fetch(`/api/admin/quiz-packages/${pkg.id}/grading-queue?status=${status}`, {
+                headers: {
+                    'Authorization': `Bearer ${this.token}`
+                }
+            });
+            if (!response.ok) {
+                alert('Failed to load the grading queue. Please try again.');
+                return;
+            }
+            const data = await response.json();
+            
+            const escape = (text) => String(text ?? '').replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+            const items = data.answers.map(item => `
+                <div class="border rounded-lg p-3 space-y-2">
+                    <div class="flex justify-between text-xs text-gray-500">
+                        <span>${escape(item.student_name)} &middot; ${escape(item.student_email)}</span>
+                        <span>${item.reviewed_at ? 'Reviewed' : 'Auto-graded'}: ${item.points_earned}/${item.points}</span>
+                    </div>
+                    <p class="text-sm font-medium text-gray-800">${escape(item.question_text)}</p>
+                    <div class="grid grid-cols-2 gap-2 text-sm">
+                        <div><span class="text-gray-500">Answer:</span> ${escape(item.student_answer) || '<span class="text-gray-400">blank</span>'}</div>
+                        <div><span class="text-gray-500">Key:</span> ${escape(item.correct_answer)}</div>
+                    </div>
+                    <form onsubmit="event.preventDefault(); gradeAnswer(${item.answer_id}, ${pkg.id}, '${status}');" class="flex items-center gap-2">
+                        <input type="number" id="gradePoints${item.answer_id}" min="0" max="${item.points}" value="${item.points_earned}" required
+                               class="w-20 px-2 py-1 border border-gray-300 rounded-lg text-sm">
+                        <span class="text-sm text-gray-500">/ ${item.points}</span>
+                        <input type="text" id="gradeComment${item.answer_id}" value="${escape(item.review_comment)}" placeholder="Comment for the student"
+                               class="flex-1 px-2 py-1 border border-gray-300 rounded-lg text-sm">
+                        <button type="submit" class="px-3 py-1 bg-blue-600 text-white rounded-lg text-sm hover:bg-blue-700">Save</button>
+                    </form>
+                </div>
+            `).join('');
+            
+            const tabs = ['pending', 'reviewed', 'all'].map(tab => `
+                <button type="button" onclick="reloadGradingModal(${pkg.id}, '${tab}')"
+                        class="px-3 py-1 rounded-lg text-sm ${tab === status ? 'bg-blue-600 text-white' : 'bg-gray-100 text-gray-700 hover:bg-gray-200'}">
+                    ${tab.charAt(0).toUpperCase() + tab.slice(1)}
+                </button>`).join('');
+            
+            const modal = `
+                <div class="space-y-4">
+                    <p class="text-sm text-gray-600">Short answer and fill-in-the-blank answers the automatic compare marked wrong. Saving a grade updates the attempt score.</p>
+                    <div class="flex gap-2">${tabs}</div>
+                    <div class="space-y-3 max-h-[60vh] overflow-y-auto">
+                        ${items || '<p class="py-4 text-center text-gray-400">Nothing to review</p>'}
+                    </div>
+                </div>
+            `;
+            closeCustomModal();
+            showCustomModal(`Grading: ${escape(pkg.title)}`, modal);
+        },
+        
+        showCopyPackageModal(pkg) {
+            const courseOptions = this.courses.map(c =>
+                `<option value="${c.id}" ${pkg.course_id === c.id ? 'selected' : ''}>${c.title}</option>`
+            ).join('');
+            const modal = `
+                <form onsubmit="event.preventDefault(); copyQuizPackage(${pkg.id});" class="space-y-4">
+                    <p class="text-sm text-gray-600">Questions and images are copied; attempts are not.</p>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-1">Copy to Course</label>
+                        <select id="copyPackageCourse" class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent">
+                            ${courseOptions}
+                        </select>
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-1">Title</label>
+                        <input type="text" id="copyPackageTitle" placeholder="${pkg.title} (Copy)"
+                               class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent">
+                    </div>
+                    <div class="flex justify-end gap-3 pt-4 border-t">
+                        <button type="button" onclick="closeCustomModal()" class="px-4 py-2 border border-gray-300 rounded-lg hover:bg-gray-50">Cancel</button>
+                        <button type="submit" class="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700">Copy</button>
+                    </div>
+                </form>
+            `;
+            showCustomModal('Copy Quiz Package', modal);
+        },
+        
         // Alias functions for quiz package operations (for HTML compatibility)
         async editQuizPackage(pkg) {
             return this.editPackage(pkg);
@@ -571,13 +988,25 @@ function dashboard() {
             const packagesOptions = this.packages.map(p => 
                 `<option value="${p.id}" ${preselectedPackageId === p.id ? 'selected' : ''}>${p.title}</option>`
             ).join('');
-            let choices = ["", "", "", ""];
+            let choices = ["", "", "", "", "", ""];
+            let matchingOptions = '';
             if (question && question.options) {
                 try {
                     const arr = JSON.parse(question.options);
-                    for (let i = 0; i < arr.length && i < 4; i++) choices[i] = arr[i];
+                    if (Array.isArray(arr)) {
+                        for (let i = 0; i < arr.length && i < choices.length; i++) choices[i] = arr[i];
+                    } else {
+                        matchingOptions = JSON.stringify(arr, null, 2);
+                    }
                 } catch {}
             }
+            const escape = (text) => String(text).replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+            const type = question?.question_type || 'multiple_choice';
+            // New questions start with the usual Japanese normalization switched on
+            let rules = question ? {} : { nfkc: true, fold_width: true };
+            if (question?.answer_rules) {
+                try { rules = JSON.parse(question.answer_rules); } catch {}
+            }
             const modal = `
                 <form onsubmit="event.preventDefault(); saveQuestion(${isEdit});">
                     <div class="space-y-4">
@@ -627,26 +1056,39 @@ function dashboard() {
                             </div>
                             <div>
                                 <label class="block text-sm font-medium text-gray-700 mb-1">Type</label>
-                                <select id="questionType" class="w-full px-3 py-2 border border-gray-300 rounded-lg" required>
-                                    <option value="multiple_choice" ${question?.question_type === 'multiple_choice' ? 'selected' : ''}>Multiple Choice</option>
-                                    <option value="true_false" ${question?.question_type === 'true_false' ? 'selected' : ''}>True/False</option>
-                                    <option value="short_answer" ${question?.question_type === 'short_answer' ? 'selected' : ''}>Short Answer</option>
+                                <select id="questionType" onchange="updateQuestionTypeFields()" class="w-full px-3 py-2 border border-gray-300 rounded-lg" required>
+                                    ${Object.entries(QUESTION_TYPES).map(([value, info]) => `<option value="${value}" ${type === value ? 'selected' : ''}>${info.label}</option>`).join('')}
                                 </select>
                             </div>
                             <div id="choicesBox">
                                 <label class="block text-sm font-medium text-gray-700 mb-1">Choices</label>
                                 <div class="grid grid-cols-2 gap-2">
-                                    <input type="text" id="choiceA" placeholder="Choice A" value="${choices[0]}" class="px-3 py-2 border border-gray-300 rounded-lg">
-                                    <input type="text" id="choiceB" placeholder="Choice B" value="${choices[1]}" class="px-3 py-2 border border-gray-300 rounded-lg">
-                                    <input type="text" id="choiceC" placeholder="Choice C" value="${choices[2]}" class="px-3 py-2 border border-gray-300 rounded-lg">
-                                    <input type="text" id="choiceD" placeholder="Choice D" value="${choices[3]}" class="px-3 py-2 border border-gray-300 rounded-lg">
+                                    ${choices.map((choice, i) => `<input type="text" id="choice${i}" placeholder="Choice ${String.fromCharCode(65 + i)}" value="${escape(choice)}" class="px-3 py-2 border border-gray-300 rounded-lg">`).join('')}
+                                </div>
+                                <p class="text-xs text-gray-500 mt-1">Leave unused choices empty</p>
+                            </div>
+                            <div id="matchingBox" style="display: none">
+                                <label class="block text-sm font-medium text-gray-700 mb-1">Prompts and Choices (JSON)</label>
+                                <textarea id="questionMatchingOptions" rows="4" class="w-full px-3 py-2 border border-gray-300 rounded-lg font-mono text-sm"
+                                          placeholder='{"prompts": ["日", "月"], "choices": ["にち", "つき", "ひ"]}'>${escape(matchingOptions)}</textarea>
+                            </div>
+                            <div id="answerRulesBox" style="display: none">
+                                <label class="block text-sm font-medium text-gray-700 mb-1">Answer Matching</label>
+                                <div class="grid grid-cols-2 gap-2">
+                                    ${Object.entries(ANSWER_RULES).map(([key, label]) => `
+                                        <label class="flex items-center text-sm text-gray-700">
+                                            <input type="checkbox" id="rule_${key}" ${rules[key] ? 'checked' : ''} class="w-4 h-4 text-blue-600 rounded">
+                                            <span class="ml-2">${label}</span>
+                                        </label>`).join('')}
                                 </div>
+                                <p class="text-xs text-gray-500 mt-1">List several accepted answers as a JSON array or separated by |</p>
                             </div>
                             <div class="grid grid-cols-2 gap-4">
                                 <div>
                                     <label class="block text-sm font-medium text-gray-700 mb-1">Correct Answer</label>
-                                    <input type="text" id="questionCorrectAnswer" value="${question?.correct_answer || ''}" 
+                                    <input type="text" id="questionCorrectAnswer" value="${escape(question?.correct_answer || '')}" 
                                            class="w-full px-3 py-2 border border-gray-300 rounded-lg" required>
+                                    <p id="questionAnswerHint" class="text-xs text-gray-500 mt-1"></p>
                                 </div>
                                 <div>
                                     <label class="block text-sm font-medium text-gray-700 mb-1">Points <span class="text-red-500">*</span></label>
@@ -656,6 +1098,21 @@ function dashboard() {
                                     <p class="text-xs text-gray-500 mt-1">Set custom points for this question</p>
                                 </div>
                             </div>
+                            <div class="grid grid-cols-2 gap-4">
+                                <div>
+                                    <label class="block text-sm font-medium text-gray-700 mb-1">Tags</label>
+                                    <input type="text" id="questionTags" value="${question?.tags || ''}" placeholder="e.g. vocab, n5"
+                                           class="w-full px-3 py-2 border border-gray-300 rounded-lg">
+                                    <p class="text-xs text-gray-500 mt-1">Comma-separated; used by question bank pools</p>
+                                </div>
+                                <div>
+                                    <label class="block text-sm font-medium text-gray-700 mb-1">Difficulty</label>
+                                    <select id="questionDifficulty" class="w-full px-3 py-2 border border-gray-300 rounded-lg">
+                                        <option value="">Not set</option>
+                                        ${['easy', 'medium', 'hard'].map(d => `<option value="${d}" ${question?.difficulty === d ? 'selected' : ''}>${d.charAt(0).toUpperCase() + d.slice(1)}</option>`).join('')}
+                                    </select>
+                                </div>
+                            </div>
                         </div>
                         <div class="mt-6 flex gap-3">
                             <button type="submit" class="flex-1 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700">
@@ -668,6 +1125,7 @@ function dashboard() {
                     </form>
                 `;
                 showCustomModal(isEdit ? 'Edit Question' : 'Add Question', modal);
+                updateQuestionTypeFields();
                 if (isEdit) {
                     window.currentEditId = question.id;
                 }
@@ -678,7 +1136,7 @@ function dashboard() {
         },
         
         async deleteQuestion(id) {
-            if (!confirm('Are you sure you want to delete this question?')) return;
+            if (!confirm('Move this question to the trash?')) return;
             
             const response = await fetch(`/api/admin/questions/${id}`, {
                 method: 'DELETE',
@@ -692,12 +1150,63 @@ function dashboard() {
             }
         },
         
+        showImportQuestionsModal(packageId) {
+            const modal = `
+                <form onsubmit="event.preventDefault(); importQuestions(${packageId}, false);" class="space-y-4">
+                    <p class="text-sm text-gray-600">
+                        Upload a CSV, JSON or GIFT file. CSV needs the columns question_text, question_type,
+                        correct_answer and points, plus option_a, option_b, ... for multiple choice.
+                        Nothing is imported if any row is invalid.
+                    </p>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-1">File</label>
+                        <input type="file" id="importQuestionsFile" accept=".csv,.json,.gift,.txt" required class="w-full text-sm">
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-1">Format</label>
+                        <select id="importQuestionsFormat" class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent">
+                            <option value="">Detect from file name</option>
+                            <option value="csv">CSV</option>
+                            <option value="json">JSON</option>
+                            <option value="gift">GIFT</option>
+                        </select>
+                    </div>
+                    <div id="importQuestionsResult" class="text-sm"></div>
+                    <div class="flex justify-end gap-3 pt-4 border-t">
+                        <button type="button" onclick="closeCustomModal()" class="px-4 py-2 border border-gray-300 rounded-lg hover:bg-gray-50">Cancel</button>
+                        <button type="button" onclick="importQuestions(${packageId}, true)" class="px-4 py-2 border border-blue-600 text-blue-600 rounded-lg hover:bg-blue-50">Check File</button>
+                        <button type="submit" class="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700">Import</button>
+                    </div>
+                </form>
+            `;
+            showCustomModal('Import Questions', modal);
+        },
+        
+        showExportQuestionsModal(packageId) {
+            const modal = `
+                <div class="space-y-4">
+                    <p class="text-sm text-gray-600">Download every question in this package. The file can be edited and imported into another package.</p>
+                    <div class="flex justify-end gap-3 pt-4 border-t">
+                        <button type="button" onclick="exportQuestions(${packageId}, 'csv')" class="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700">CSV</button>
+                        <button type="button" onclick="exportQuestions(${packageId}, 'json')" class="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700">JSON</button>
+                        <button type="button" onclick="exportQuestions(${packageId}, 'gift')" class="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700">GIFT</button>
+                    </div>
+                </div>
+            `;
+            showCustomModal('Export Questions', modal);
+        },
+        
         // Helper functions
         getCourseName(courseId) {
             const course = this.courses.find(c => c.id === courseId);
             return course ? course.title : 'Unknown';
         },
         
+        questionTypeLabel(type, short = false) {
+            if (short && type === 'multiple_choice') return 'MCQ';
+            return QUESTION_TYPES[type]?.label || type;
+        },
+        
         getPackageName(packageId) {
             const pkg = this.packages.find(p => p.id === packageId);
             return pkg ? pkg.title : 'Unknown';
@@ -1253,10 +1762,216 @@ function dashboard() {
             }
         },
         
+        // Sign a student out of every session
+        async revokeSessions(student) {
+            if (!confirm(`Sign ${student.name} out of every device?`)) {
+                return;
+            }
+            
+            const response = await this.apiCall(`/api/admin/users/${student.id}/sessions`, 'DELETE');
+            
+            if (response && response.message) {
+                alert(`Signed out of ${response.sessions_revoked} session(s)`);
+            } else {
+                alert(response?.error || 'Failed to revoke sessions');
+            }
+        },
+        
+        // Staff operations (Admin only)
+        showStaffModal() {
+            const modal = `
+                <form onsubmit="event.preventDefault(); inviteStaff();">
+                    <div class="space-y-4">
+                        <div>
+                            <label class="block text-sm font-medium text-gray-700 mb-1">Name</label>
+                            <input type="text" id="staffName" required class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium text-gray-700 mb-1">Email</label>
+                            <input type="email" id="staffEmail" required class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium text-gray-700 mb-1">Role</label>
+                            <select id="staffRole" class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500">
+                                <option value="teacher">Teacher - creates courses and works in those they join</option>
+                                <option value="assistant">Assistant - grades and handles enrollments</option>
+                                <option value="admin">Admin - everything</option>
+                            </select>
+                        </div>
+                        <p class="text-xs text-gray-500">A temporary password is shown once after the account is created.</p>
+                        <div class="flex justify-end gap-2">
+                            <button type="button" onclick="closeCustomModal()" class="px-4 py-2 bg-gray-100 text-gray-700 rounded-lg hover:bg-gray-200">Cancel</button>
+                            <button type="submit" class="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700">Invite</button>
+                        </div>
+                    </div>
+                </form>
+            `;
+            showCustomModal('Invite Staff', modal);
+        },
+        
+        async changeStaffRole(member) {
+            const role = prompt(`New role for ${member.name} (admin, teacher or assistant):`, member.role);
+            if (!role || role === member.role) return;
+            
+            const response = await this.apiCall(`/api/admin/staff/${member.id}`, 'PUT', { role: role.trim() });
+            if (response && response.user) {
+                await this.loadStaff();
+            } else {
+                alert(response?.error || 'Failed to change role');
+            }
+        },
+        
+        async resetStaffPassword(member) {
+            const password = prompt(`New password for ${member.name} (at least 6 characters):`);
+            if (!password) return;
+            
+            const response = await this.apiCall(`/api/admin/staff/${member.id}`, 'PUT', { password });
+            if (response && response.user) {
+                alert('Password changed. They have been signed out everywhere.');
+            } else {
+                alert(response?.error || 'Failed to change password');
+            }
+        },
+        
+        async resetStaffTwoFactor(member) {
+            if (!confirm(`Turn off two-factor authentication for ${member.name}? Do this only when they lost their device and recovery codes. They are signed out everywhere.`)) {
+                return;
+            }
+            
+            const response = await this.apiCall(`/api/admin/staff/${member.id}/2fa`, 'DELETE');
+            if (response && response.message) {
+                await this.loadStaff();
+            } else {
+                alert(response?.error || 'Failed to reset two-factor authentication');
+            }
+        },
+        
+        // Two-factor authentication: setup shows a QR code, and turning it on
+        // shows the recovery codes once
+        async startTwoFactorSetup() {
+            const data = await this.apiCall('/api/admin/me/2fa/setup', 'POST');
+            if (!data || !data.secret) {
+                alert(data?.error || 'Failed to set up two-factor authentication');
+                return;
+            }
+            this.twoFactorSetup = data;
+            this.recoveryCodes = [];
+            
+            this.$nextTick(() => {
+                const qr = document.getElementById('twoFactorQRCode');
+                qr.innerHTML = '';
+                if (window.QRCode) {
+                    new QRCode(qr, { text: data.provisioning_uri, width: 180, height: 180 });
+                }
+            });
+        },
+        
+        async enableTwoFactor(code) {
+            const data = await this.apiCall('/api/admin/me/2fa/enable', 'POST', { code });
+            if (!data || !data.recovery_codes) {
+                alert(data?.error || 'Failed to turn on two-factor authentication');
+                return;
+            }
+            this.twoFactorSetup = null;
+            this.recoveryCodes = data.recovery_codes;
+            await this.loadMe();
+        },
+        
+        async regenerateRecoveryCodes() {
+            const code = prompt('Enter a code from your authenticator app. Your old recovery codes stop working.');
+            if (!code) return;
+            
+            const data = await this.apiCall('/api/admin/me/2fa/recovery-codes', 'POST', { code });
+            if (!data || !data.recovery_codes) {
+                alert(data?.error || 'Failed to make new recovery codes');
+                return;
+            }
+            this.recoveryCodes = data.recovery_codes;
+            await this.loadMe();
+        },
+        
+        async disableTwoFactor() {
+            const password = prompt('Enter your password to turn off two-factor authentication:');
+            if (!password) return;
+            const code = prompt('Enter a code from your authenticator app, or a recovery code:');
+            if (!code) return;
+            
+            const data = await this.apiCall('/api/admin/me/2fa/disable', 'POST', { password, code });
+            if (!data || !data.message) {
+                alert(data?.error || 'Failed to turn off two-factor authentication');
+                return;
+            }
+            this.recoveryCodes = [];
+            await this.loadMe();
+        },
+        
+        async removeStaff(member) {
+            if (!confirm(`Remove ${member.name}? They lose access to every course and are signed out.`)) {
+                return;
+            }
+            
+            const response = await this.apiCall(`/api/admin/staff/${member.id}`, 'DELETE');
+            if (response && response.message) {
+                await this.loadStaff();
+            } else {
+                alert(response?.error || 'Failed to remove staff member');
+            }
+        },
+        
+        // Course staff: everyone on the course can see it, owners change it
+        async manageCourseStaff(course) {
+            const members = await this.apiCall(`/api/admin/courses/${course.id}/members`);
+            if (!Array.isArray(members)) {
+                alert(members?.error || 'Failed to load course staff');
+                return;
+            }
+            
+            const escape = (text) => String(text).replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+            const canManage = this.canManageCourse(course.id);
+            const roleOptions = (selected) => ['owner', 'teacher', 'assistant'].map(role =>
+                `<option value="${role}" ${selected === role ? 'selected' : ''}>${role}</option>`
+            ).join('');
+            
+            const rows = members.map(member => `
+                <tr class="border-t border-gray-100">
+                    <td class="py-2 pr-2">${escape(member.user?.name || '')}<div class="text-xs text-gray-500">${escape(member.user?.email || '')}</div></td>
+                    <td class="py-2 pr-2">
+                        ${canManage
+                            ? `<select onchange="updateCourseMember(${course.id}, ${member.user_id}, this.value)" class="px-2 py-1 border border-gray-300 rounded text-sm">${roleOptions(member.role)}</select>`
+                            : escape(member.role)}
+                    </td>
+                    <td class="py-2 text-right">
+                        ${canManage ? `<button onclick="removeCourseMember(${course.id}, ${member.user_id})" class="text-red-600 hover:text-red-700 text-sm">Remove</button>` : ''}
+                    </td>
+                </tr>
+            `).join('');
+            
+            const modal = `
+                <div class="space-y-4">
+                    <table class="w-full text-sm">
+                        <thead><tr class="text-left text-gray-500"><th class="pb-2">Staff</th><th class="pb-2">Role</th><th></th></tr></thead>
+                        <tbody>${rows || '<tr><td colspan="3" class="py-4 text-center text-gray-400">Only admins work in this course</td></tr>'}</tbody>
+                    </table>
+                    ${canManage ? `
+                    <form onsubmit="event.preventDefault(); addCourseMember(${course.id});" class="flex flex-wrap items-end gap-2 pt-4 border-t border-gray-200">
+                        <div class="flex-1 min-w-[12rem]">
+                            <label class="block text-sm font-medium text-gray-700 mb-1">Teacher or assistant email</label>
+                            <input type="email" id="memberEmail" required class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500">
+                        </div>
+                        <select id="memberRole" class="px-3 py-2 border border-gray-300 rounded-lg">${roleOptions('teacher')}</select>
+                        <button type="submit" class="px-4 py-2 bg-blue-600 text-white rounded-lg hover:bg-blue-700">Add</button>
+                    </form>` : ''}
+                </div>
+            `;
+            closeCustomModal();
+            showCustomModal(`Staff - ${escape(course.title)}`, modal);
+            window.currentStaffCourse = course;
+        },
+        
         // Logout
-        logout() {
+        async logout() {
             if (confirm('Are you sure you want to logout?')) {
-                localStorage.clear();
+                await endSession();
                 window.location.href = '/admin/login';
             }
         }
@@ -1335,7 +2050,9 @@ async function savePackage(isEdit) {
         title: document.getElementById('packageTitle').value,
         description: document.getElementById('packageDescription').value,
         max_retake_count: parseInt(document.getElementById('packageMaxRetakeCount').value),
-        is_active: document.getElementById('packageIsActive').checked
+        is_active: document.getElementById('packageIsActive').checked,
+        question_bank: document.getElementById('packageQuestionBank').checked,
+        shuffle_options: document.getElementById('packageShuffleOptions').checked
     };
     
     const url = isEdit ? `/api/admin/quiz-packages/${window.currentEditId}` : '/api/admin/quiz-packages';
@@ -1361,25 +2078,67 @@ async function savePackage(isEdit) {
     }
 }
 
+// Question types with how their choices and answer key are entered
+const QUESTION_TYPES = {
+    multiple_choice: { label: 'Multiple Choice', choices: true, hint: 'The correct choice, by text or letter (e.g. B)' },
+    multiple_select: { label: 'Multiple Select', choices: true, hint: 'Every correct choice, e.g. A, C (partial credit)' },
+    true_false: { label: 'True/False', hint: 'true or false' },
+    short_answer: { label: 'Short Answer', rules: true, hint: 'The expected answer, e.g. たべます|食べます' },
+    ordering: { label: 'Ordering', choices: true, hint: 'All choices in the right order, e.g. C, A, D, B (partial credit)' },
+    matching: { label: 'Matching', matching: true, hint: 'JSON pairs, e.g. {"日": "にち", "月": "つき"} (partial credit)' },
+    fill_blank: { label: 'Fill in the Blank', rules: true, hint: 'Mark gaps in the text with ___; answers as JSON, e.g. ["は", "を|に"] (partial credit)' }
+};
+
+// Normalization switches for typed answers (models.AnswerRules)
+const ANSWER_RULES = {
+    nfkc: 'Unicode NFKC',
+    fold_width: 'Full/half-width equal',
+    fold_kana: 'Hiragana = katakana',
+    romaji: 'Accept romaji',
+    regex: 'Answers are regex'
+};
+
+// Show the inputs that apply to the selected question type
+function updateQuestionTypeFields() {
+    const info = QUESTION_TYPES[document.getElementById('questionType').value] || {};
+    document.getElementById('choicesBox').style.display = info.choices ? 'block' : 'none';
+    document.getElementById('matchingBox').style.display = info.matching ? 'block' : 'none';
+    document.getElementById('answerRulesBox').style.display = info.rules ? 'block' : 'none';
+    document.getElementById('questionAnswerHint').textContent = info.hint || '';
+}
+
 async function saveQuestion(isEdit) {
     const token = localStorage.getItem('token');
-    let optionsArr = [];
-    if (document.getElementById('questionType').value === 'multiple_choice') {
-        optionsArr = [
-            document.getElementById('choiceA').value,
-            document.getElementById('choiceB').value,
-            document.getElementById('choiceC').value,
-            document.getElementById('choiceD').value
-        ];
+    const type = document.getElementById('questionType').value;
+    let options = '[]';
+    if (QUESTION_TYPES[type]?.choices) {
+        const optionsArr = [];
+        for (let i = 0; document.getElementById(`choice${i}`); i++) {
+            optionsArr.push(document.getElementById(`choice${i}`).value);
+        }
+        // Keep multiple choice letters stable; other types drop unused trailing fields
+        while (optionsArr.length && optionsArr[optionsArr.length - 1].trim() === '') optionsArr.pop();
+        options = JSON.stringify(type === 'multiple_choice' ? optionsArr : optionsArr.filter(o => o.trim() !== ''));
+    } else if (QUESTION_TYPES[type]?.matching) {
+        options = document.getElementById('questionMatchingOptions').value.trim();
+    }
+    const rules = {};
+    if (QUESTION_TYPES[type]?.rules) {
+        Object.keys(ANSWER_RULES).forEach(key => {
+            if (document.getElementById(`rule_${key}`).checked) rules[key] = true;
+        });
     }
     const data = {
         quiz_package_id: parseInt(document.getElementById('questionPackageId').value),
         question_text: document.getElementById('questionText').value,
-        question_type: document.getElementById('questionType').value,
+        question_type: type,
+        answer_rules: Object.keys(rules).length ? JSON.stringify(rules) : '',
         image_url: document.getElementById('questionImageUrl').value,
-        options: JSON.stringify(optionsArr),
+        options: options,
         correct_answer: document.getElementById('questionCorrectAnswer').value,
         points: parseInt(document.getElementById('questionPoints').value),
+        tags: document.getElementById('questionTags').value,
+        difficulty: document.getElementById('questionDifficulty').value,
         is_active: true
     };
     
@@ -1397,20 +2156,244 @@ async function saveQuestion(isEdit) {
     
     if (response.ok) {
         closeCustomModal();
+        if (isEdit) {
+            await offerRegrade(window.currentEditId);
+        }
         // Refresh data without reloading page
         const dashboardComponent = Alpine.$data(document.querySelector('[x-data="dashboard()"]'));
         await dashboardComponent.loadQuestions();
         await dashboardComponent.loadStats();
     } else {
-        alert('Failed to save question. Please try again.');
+        const result = await response.json().catch(() => ({}));
+        alert(result.error ? `Failed to save question: ${result.error}` : 'Failed to save question. Please try again.');
+    }
+}
+
+// After an edit, offer to re-mark stored answers that the new key grades differently
+async function offerRegrade(questionId) {
+    const token = localStorage.getItem('token');
+    const preview = await fetch(`/api/admin/questions/${questionId}/regrade?dry_run=true`, {
+        method: 'POST',
+        headers: {
+            'Authorization': `Bearer ${token}`
+        }
+    });
+    if (!preview.ok) return;
+    const plan = (await preview.json()).regrade;
+    if (plan.answers_changed === 0) return;
+    
+    const lines = plan.attempts.slice(0, 10).map(a =>
+        `${a.student_name || 'Student #' + a.student_id}: ${a.old_score} → ${a.new_score} / ${a.total_points}`);
+    if (plan.attempts.length > lines.length) lines.push(`...and ${plan.attempts.length - lines.length} more`);
+    const skipped = plan.skipped_reviewed ? `\n${plan.skipped_reviewed} hand-graded answer(s) will be kept.` : '';
+    if (!confirm(`The new answer key changes ${plan.answers_changed} stored answer(s) in ${plan.attempts.length} attempt(s):\n\n${lines.join('\n')}${skipped}\n\nRegrade now?`)) return;
+    
+    const response = await fetch(`/api/admin/questions/${questionId}/regrade`, {
+        method: 'POST',
+        headers: {
+            'Authorization': `Bearer ${token}`
+        }
+    });
+    if (!response.ok) {
+        alert('Failed to regrade answers. Please try again.');
+    }
+}
+
+// Question bank pools
+async function createQuestionPool(packageId) {
+    const token = localStorage.getItem('token');
+    const data = {
+        name: document.getElementById('poolName').value,
+        tag: document.getElementById('poolTag').value,
+        difficulty: document.getElementById('poolDifficulty').value,
+        draw_count: parseInt(document.getElementById('poolDrawCount').value)
+    };
+    
+    const response = await fetch(`/api/admin/quiz-packages/${packageId}/pools`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Authorization': `Bearer ${token}`
+        },
+        body: JSON.stringify(data)
+    });
+    
+    if (!response.ok) {
+        const error = await response.json();
+        alert(error.error || 'Failed to add pool. Please try again.');
+        return;
+    }
+    await reloadPoolsModal(packageId);
+}
+
+async function deleteQuestionPool(poolId, packageId) {
+    if (!confirm('Delete this pool?')) return;
+    const token = localStorage.getItem('token');
+    
+    const response = await fetch(`/api/admin/question-pools/${poolId}`, {
+        method: 'DELETE',
+        headers: {
+            'Authorization': `Bearer ${token}`
+        }
+    });
+    
+    if (response.ok) {
+        await reloadPoolsModal(packageId);
+    }
+}
+
+async function gradeAnswer(answerId, packageId, status) {
+    const token = localStorage.getItem('token');
+    const data = {
+        points_earned: parseInt(document.getElementById(`gradePoints${answerId}`).value),
+        comment: document.getElementById(`gradeComment${answerId}`).value
+    };
+    
+    const response = await fetch(`/api/admin/answers/${answerId}/grade`, {
+        method: 'PUT',
+        headers: {
+            'Content-Type': 'application/json',
+            'Authorization': `Bearer ${token}`
+        },
+        body: JSON.stringify(data)
+    });
+    
+    if (!response.ok) {
+        const error = await response.json();
+        alert(error.error || 'Failed to save the grade. Please try again.');
+        return;
+    }
+    await reloadGradingModal(packageId, status);
+}
+
+async function reloadGradingModal(packageId, status) {
+    const dashboardComponent = Alpine.$data(document.querySelector('[x-data="dashboard()"]'));
+    const pkg = dashboardComponent.packages.find(p => p.id === packageId);
+    await dashboardComponent.showGradingModal(pkg, status);
+}
+
+async function reloadPoolsModal(packageId) {
+    const dashboardComponent = Alpine.$data(document.querySelector('[x-data="dashboard()"]'));
+    const pkg = dashboardComponent.packages.find(p => p.id === packageId);
+    await dashboardComponent.showPoolsModal(pkg);
+}
+
+async function copyQuizPackage(packageId) {
+    const token = localStorage.getItem('token');
+    const data = {
+        course_id: parseInt(document.getElementById('copyPackageCourse').value),
+        title: document.getElementById('copyPackageTitle').value
+    };
+    
+    const response = await fetch(`/api/admin/quiz-packages/${packageId}/clone`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Authorization': `Bearer ${token}`
+        },
+        body: JSON.stringify(data)
+    });
+    
+    if (response.ok) {
+        closeCustomModal();
+        const dashboardComponent = Alpine.$data(document.querySelector('[x-data="dashboard()"]'));
+        await dashboardComponent.loadPackages();
+        await dashboardComponent.loadQuestions();
+        await dashboardComponent.loadStats();
+    } else {
+        alert('Failed to copy quiz package. Please try again.');
+    }
+}
+
+// Question import/export
+async function importQuestions(packageId, dryRun) {
+    const token = localStorage.getItem('token');
+    const fileInput = document.getElementById('importQuestionsFile');
+    const result = document.getElementById('importQuestionsResult');
+    if (!fileInput.files[0]) {
+        alert('Please choose a file to import.');
+        return;
+    }
+    
+    const formData = new FormData();
+    formData.append('file', fileInput.files[0]);
+    const params = new URLSearchParams();
+    const format = document.getElementById('importQuestionsFormat').value;
+    if (format) params.set('format', format);
+    if (dryRun) params.set('dry_run', 'true');
+    
+    const response = await fetch(`/api/admin/quiz-packages/${packageId}/questions/import?${params}`, {
+        method: 'POST',
+        headers: {
+            'Authorization': `Bearer ${token}`
+        },
+        body: formData
+    });
+    const data = await response.json();
+    
+    const escape = (text) => String(text).replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+    const errorList = (data.errors || []).map(e =>
+        `<li><span class="font-medium">Row ${e.row}:</span> ${e.errors.map(escape).join('; ')}</li>`
+    ).join('');
+    
+    if (response.status === 201) {
+        closeCustomModal();
+        alert(data.message);
+        const dashboardComponent = Alpine.$data(document.querySelector('[x-data="dashboard()"]'));
+        await dashboardComponent.loadQuestions();
+        await dashboardComponent.loadStats();
+    } else if (response.ok) {
+        const color = data.errors.length ? 'text-red-700' : 'text-green-700';
+        result.innerHTML = `
+            <p class="${color} font-medium">${data.valid} of ${data.total} questions are valid.</p>
+            ${errorList ? `<ul class="mt-2 list-disc pl-5 text-red-700 space-y-1">${errorList}</ul>` : ''}
+        `;
+    } else {
+        result.innerHTML = `
+            <p class="text-red-700 font-medium">${escape(data.error || 'Import failed')}</p>
+            ${errorList ? `<ul class="mt-2 list-disc pl-5 text-red-700 space-y-1">${errorList}</ul>` : ''}
+        `;
     }
 }
 
+async function exportQuestions(packageId, format) {
+    const token = localStorage.getItem('token');
+    const response = await fetch(`/api/admin/quiz-packages/${packageId}/questions/export?format=${format}`, {
+        headers: {
+            'Authorization': `Bearer ${token}`
+        }
+    });
+    if (!response.ok) {
+        alert('Failed to export questions. Please try again.');
+        return;
+    }
+    
+    const disposition = response.headers.get('Content-Disposition') || '';
+    const match = disposition.match(/filename="([^"]+)"/);
+    const url = URL.createObjectURL(await response.blob());
+    const link = document.createElement('a');
+    link.href = url;
+    link.download = match ? match[1] : `questions.${format}`;
+    document.body.appendChild(link);
+    link.click();
+    link.remove();
+    URL.revokeObjectURL(url);
+    closeCustomModal();
+}
+
 // Image upload function
 async function uploadQuestionImage(input) {
     const file = input.files[0];
     if (!file) return;
 
+    // Images are uploaded for a quiz package the signed-in staff member can edit
+    const packageId = document.getElementById('questionPackageId').value;
+    if (!packageId) {
+        alert('Please choose a quiz package first');
+        input.value = '';
+        return;
+    }
+
     // Validate file size (5MB)
     if (file.size > 5 * 1024 * 1024) {
         alert('File size must be less than 5MB');
@@ -1432,6 +2415,7 @@ async function uploadQuestionImage(input) {
 
     const formData = new FormData();
     formData.append('image', file);
+    formData.append('quiz_package_id', packageId);
 
     const token = localStorage.getItem('token');
 
@@ -1467,7 +2451,11 @@ async function uploadQuestionImage(input) {
                     alert('✅ Image uploaded successfully!');
                 }, 100);
             } else {
-                alert('Failed to upload image. Please try again.');
+                let message = 'Failed to upload image. Please try again.';
+                try {
+                    message = JSON.parse(xhr.responseText).error || message;
+                } catch (e) {}
+                alert(message);
                 document.getElementById('uploadProgress').style.display = 'none';
                 document.getElementById('uploadButtonContainer').style.display = 'block';
             }
@@ -1504,3 +2492,48 @@ function removeQuestionImage() {
         document.getElementById('uploadButtonContainer').style.display = 'block';
     }
 }
+
+// Course staff and staff accounts (global scope for modal forms)
+async function inviteStaff() {
+    const dashboardComponent = Alpine.$data(document.querySelector('[x-data="dashboard()"]'));
+    const response = await dashboardComponent.apiCall('/api/admin/staff', 'POST', {
+        name: document.getElementById('staffName').value,
+        email: document.getElementById('staffEmail').value,
+        role: document.getElementById('staffRole').value
+    });
+    
+    if (response && response.user) {
+        closeCustomModal();
+        await dashboardComponent.loadStaff();
+        if (response.temporary_password) {
+            alert(`Account created. Temporary password for ${response.user.email}: ${response.temporary_password}`);
+        }
+    } else {
+        alert(response?.error || 'Failed to invite staff member');
+    }
+}
+
+async function changeCourseStaff(courseId, endpoint, method, body) {
+    const dashboardComponent = Alpine.$data(document.querySelector('[x-data="dashboard()"]'));
+    const response = await dashboardComponent.apiCall(endpoint, method, body);
+    if (!response || response.error) {
+        alert(response?.error || 'Failed to update course staff');
+    }
+    await dashboardComponent.manageCourseStaff(window.currentStaffCourse);
+}
+
+function addCourseMember(courseId) {
+    return changeCourseStaff(courseId, `/api/admin/courses/${courseId}/members`, 'POST', {
+        email: document.getElementById('memberEmail').value,
+        role: document.getElementById('memberRole').value
+    });
+}
+
+function updateCourseMember(courseId, userId, role) {
+    return changeCourseStaff(courseId, `/api/admin/courses/${courseId}/members/${userId}`, 'PUT', { role });
+}
+
+function removeCourseMember(courseId, userId) {
+    if (!confirm('Remove them from this course?')) return;
+    return changeCourseStaff(courseId, `/api/admin/courses/${courseId}/members/${userId}`, 'DELETE');
+}
@@ -7,11 +7,20 @@ function quizApp() {
         quizPackageId: null,
         quizPackageName: '',
         examTime: 0,
+        questionBank: false, // Questions (or their option order) are drawn per attempt after verification
+        bankQuestionCount: 0,
+        attemptId: null, // Server-side attempt; answers are autosaved to it
         
         // Student info
         studentName: '',
         phoneNumber: '',
         studentId: null,
+        quizToken: null, // Issued once the passcode is verified; required to draw, save and submit
+        otpStep: false, // A passcode was sent and the code field is shown
+        otpCode: '',
+        otpChannel: '',
+        otpChannels: [],
+        otpDestination: '',
         retakeInfo: null, // Contains current_attempts, max_retakes, attempts_remaining, quiz_package_name
         
         // Loading state
@@ -40,6 +49,13 @@ function quizApp() {
         questions: [],
         currentQuestionIndex: 0,
         answers: [],
+        questionSeconds: [], // Time spent on each question, for item analysis
+        questionShownAt: null,
+        
+        // Autosave
+        savedPayloads: [], // Last answer payload the server has for each question
+        saveStatus: 'saved', // 'saved', 'saving', 'offline'
+        autosaveTimer: null,
         
         // Timer
         timeRemaining: 0,
@@ -80,6 +96,7 @@ function quizApp() {
                 }
                 
                 await this.loadQuizData();
+                this.$watch('answers', () => this.scheduleAutosave());
                 
                 // Data loaded, hide loading state
                 this.isLoading = false;
@@ -104,6 +121,8 @@ function quizApp() {
                 const pkgData = await pkgResponse.json();
                 
                 this.quizPackageName = pkgData.title;
+                this.questionBank = !!(pkgData.question_bank || pkgData.shuffle_options);
+                this.bankQuestionCount = pkgData.question_count || 0;
                 console.log('Quiz Package:', pkgData);
                 
                 // Load course details
@@ -125,31 +144,10 @@ function quizApp() {
                 if (!questionsResponse.ok) {
                     throw new Error(`Failed to load questions: ${questionsResponse.status}`);
                 }
-                this.questions = await questionsResponse.json();
+                this.setQuestions(await questionsResponse.json());
                 
                 console.log('Questions loaded:', this.questions.length);
                 
-                // Initialize answers array
-                this.answers = new Array(this.questions.length).fill(null);
-                
-                // Parse options for multiple choice questions and log image info
-                this.questions = this.questions.map(q => {
-                    if (q.question_type === 'multiple_choice' && typeof q.options === 'string') {
-                        try {
-                            q.options = JSON.parse(q.options);
-                        } catch (e) {
-                            q.options = [];
-                        }
-                    }
-                    
-                    // Log image URLs for debugging
-                    if (q.image_url) {
-                        console.log(`Question ${q.id}: "${q.question_text}" has image: ${q.image_url}`);
-                    }
-                    
-                    return q;
-                });
-                
                 console.log('Quiz data loaded successfully');
             } catch (error) {
                 console.error('Error loading quiz data:', error);
@@ -158,13 +156,148 @@ function quizApp() {
             }
         },
         
+        // Replace the question list and reset the answers
+        setQuestions(questions) {
+            // Parse options (an object for matching questions) and log image info
+            this.questions = questions.map(q => {
+                if (typeof q.options === 'string') {
+                    try {
+                        q.options = JSON.parse(q.options || 'null');
+                    } catch (e) {
+                        q.options = null;
+                    }
+                }
+                if (q.question_type === 'matching') {
+                    q.options = q.options || { prompts: [], choices: [] };
+                } else if (!Array.isArray(q.options)) {
+                    q.options = [];
+                }
+                if (q.question_type === 'fill_blank') {
+                    // Text around each ___ gap
+                    q.blankParts = q.question_text.split(/_{3,}/);
+                }
+                
+                // Log image URLs for debugging
+                if (q.image_url) {
+                    console.log(`Question ${q.id}: "${q.question_text}" has image: ${q.image_url}`);
+                }
+                
+                return q;
+            });
+            
+            // Initialize answers array
+            this.answers = new Array(this.questions.length).fill(null);
+            this.questionSeconds = new Array(this.questions.length).fill(0);
+            this.savedPayloads = new Array(this.questions.length).fill('');
+        },
+        
+        // Start (or resume) this student's attempt on the server and load the
+        // questions drawn for it, with any answers already saved
+        async drawQuestions() {
+            const response = await fetch('/api/student/quiz/draw', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    student_id: this.studentId,
+                    course_id: this.courseId,
+                    quiz_package_id: this.quizPackageId,
+                    quiz_token: this.quizToken
+                })
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                throw new Error(data.message || data.error || 'Failed to load your questions');
+            }
+            
+            this.attemptId = data.attempt_id;
+            this.setQuestions(data.questions);
+            (data.answers || []).forEach(saved => {
+                const index = this.questions.findIndex(q => q.id === saved.question_id);
+                if (index < 0) return;
+                this.answers[index] = this.restoreAnswer(this.questions[index], saved.student_answer);
+                this.questionSeconds[index] = saved.time_spent_seconds || 0;
+                this.savedPayloads[index] = this.answerPayload(index);
+            });
+            return data;
+        },
+        
+        // Turn a saved answer back into the form the inputs use
+        restoreAnswer(question, saved) {
+            if (!saved) return null;
+            if (['multiple_select', 'ordering', 'matching', 'fill_blank'].includes(question.question_type)) {
+                try {
+                    return JSON.parse(saved);
+                } catch (e) {
+                    return question.question_type === 'fill_blank' ? [saved] : null;
+                }
+            }
+            return saved;
+        },
+        
+        // Save changed answers shortly after the student stops typing
+        scheduleAutosave() {
+            if (!this.attemptId || this.currentScreen !== 'quiz') return;
+            clearTimeout(this.autosaveTimer);
+            this.autosaveTimer = setTimeout(() => this.autosave(), 800);
+        },
+        
+        async autosave() {
+            const attemptId = this.attemptId;
+            const changed = this.questions
+                .map((question, index) => index)
+                .filter(index => this.answerPayload(index) !== this.savedPayloads[index]);
+            if (changed.length === 0) return;
+            
+            this.saveStatus = 'saving';
+            for (const index of changed) {
+                const payload = this.answerPayload(index);
+                try {
+                    const response = await fetch('/api/student/quiz/save-answer', {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json'
+                        },
+                        body: JSON.stringify({
+                            student_id: this.studentId,
+                            attempt_id: attemptId,
+                            question_id: this.questions[index].id,
+                            user_answer: payload,
+                            time_spent_seconds: Math.round(this.questionSeconds[index] || 0),
+                            quiz_token: this.quizToken
+                        })
+                    });
+                    if (!response.ok) {
+                        // Time ran out or the attempt was closed; the final submit reports it
+                        this.saveStatus = 'saved';
+                        return;
+                    }
+                    const data = await response.json();
+                    if (this.attemptId !== attemptId) return;
+                    this.savedPayloads[index] = payload;
+                    // Follow the server clock
+                    if (typeof data.time_remaining === 'number') {
+                        this.timeRemaining = Math.min(this.timeRemaining, Math.max(data.time_remaining, 0));
+                    }
+                } catch (error) {
+                    // Offline: keep the answers here and try again shortly
+                    this.saveStatus = 'offline';
+                    clearTimeout(this.autosaveTimer);
+                    this.autosaveTimer = setTimeout(() => this.autosave(), 5000);
+                    return;
+                }
+            }
+            this.saveStatus = 'saved';
+        },
+        
         // Computed properties
         get currentQuestion() {
             return this.questions[this.currentQuestionIndex];
         },
         
         get totalQuestions() {
-            return this.questions.length;
+            return this.questions.length || this.bankQuestionCount;
         },
         
         get totalPoints() {
@@ -177,6 +310,9 @@ function quizApp() {
                 this.showModal('warning', 'Identifier Required', 'Please enter your phone number or email to continue.');
                 return;
             }
+            if (this.otpStep) {
+                return this.verifyOtp();
+            }
             
             try {
                 this.isLoading = true;
@@ -209,14 +345,102 @@ function quizApp() {
                 this.studentId = data.student_id;
                 this.studentName = data.student_name;
                 this.retakeInfo = data.retake_info || null;
+                this.otpChannels = data.otp_channels || [];
                 
                 console.log('Student verified. Student:', this.studentName);
                 if (this.retakeInfo) {
                     console.log('Retake info:', this.retakeInfo);
                 }
                 
+                // The quiz starts once the student enters the code sent to them
+                await this.requestOtp();
+                this.isLoading = false;
+                
+            } catch (error) {
+                console.error('Error verifying student:', error);
+                this.showModal('error', 'Verification Failed', 'Failed to verify your information. Please check your connection and try again.');
+                this.isLoading = false;
+            }
+        },
+        
+        // Send a one-time passcode; channel defaults to the kind of identifier
+        async requestOtp(channel = null) {
+            try {
+                this.isLoading = true;
+                const response = await fetch('/api/quiz/otp/request', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        course_id: this.courseId,
+                        quiz_package_id: this.quizPackageId,
+                        phone_number: this.phoneNumber.trim(),
+                        channel: channel || undefined
+                    })
+                });
+                const data = await response.json();
+                
+                if (!response.ok) {
+                    this.showModal('error', 'Could Not Send Code', data.error || data.message || 'Failed to send your verification code.');
+                    return;
+                }
+                
+                this.otpStep = true;
+                this.otpCode = '';
+                this.otpChannel = data.channel;
+                this.otpDestination = data.destination;
+            } catch (error) {
+                console.error('Error requesting passcode:', error);
+                this.showModal('error', 'Could Not Send Code', 'Please check your connection and try again.');
+            } finally {
                 this.isLoading = false;
-                this.startQuiz();
+            }
+        },
+        
+        // Exchange the passcode for a quiz token and start (or resume) the quiz
+        async verifyOtp() {
+            try {
+                this.isLoading = true;
+                const response = await fetch('/api/quiz/otp/verify', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        course_id: this.courseId,
+                        quiz_package_id: this.quizPackageId,
+                        phone_number: this.phoneNumber.trim(),
+                        code: this.otpCode.trim()
+                    })
+                });
+                const data = await response.json();
+                
+                if (!response.ok) {
+                    this.showModal('error', 'Verification Failed', data.error || data.message || 'The code could not be verified.');
+                    this.isLoading = false;
+                    return;
+                }
+                
+                this.quizToken = data.quiz_token;
+                this.studentId = data.student_id;
+                this.otpStep = false;
+                this.otpCode = '';
+                
+                let drawn;
+                try {
+                    drawn = await this.drawQuestions();
+                } catch (error) {
+                    this.showModal('error', 'Could Not Start Quiz', error.message);
+                    this.isLoading = false;
+                    return;
+                }
+                
+                this.isLoading = false;
+                this.startQuiz(drawn.time_remaining);
+                if (drawn.resumed) {
+                    this.showModal('info', 'Welcome Back', 'Your quiz was resumed where you left off. Your saved answers have been restored and the timer continues from your original start.');
+                }
                 
             } catch (error) {
                 console.error('Error verifying student:', error);
@@ -226,7 +450,7 @@ function quizApp() {
         },
         
         // Start quiz
-        startQuiz() {
+        startQuiz(timeRemaining = null) {
             // Validate exam time
             if (!this.examTime || this.examTime <= 0) {
                 this.showModal('error', 'Configuration Error', 'Invalid exam time detected. Please contact the administrator.');
@@ -237,8 +461,11 @@ function quizApp() {
             console.log('Starting quiz with exam time:', this.examTime, 'minutes');
             
             this.currentScreen = 'quiz';
-            this.timeRemaining = this.examTime * 60; // Convert to seconds
-            this.startTime = Date.now();
+            // A resumed attempt keeps its server-side deadline
+            this.timeRemaining = timeRemaining ?? this.examTime * 60; // Convert to seconds
+            this.startTime = Date.now() - (this.examTime * 60 - this.timeRemaining) * 1000;
+            this.questionShownAt = Date.now();
+            this.saveStatus = 'saved';
             
             console.log('Time remaining (seconds):', this.timeRemaining);
             
@@ -277,33 +504,124 @@ function quizApp() {
             return `${mins}:${secs.toString().padStart(2, '0')}`;
         },
         
+        // Add the time since the current question was shown to its total
+        recordQuestionTime() {
+            if (!this.questionShownAt) return;
+            const now = Date.now();
+            this.questionSeconds[this.currentQuestionIndex] =
+                (this.questionSeconds[this.currentQuestionIndex] || 0) + (now - this.questionShownAt) / 1000;
+            this.questionShownAt = now;
+        },
+        
         // Navigation
         nextQuestion() {
             // Check if current question is answered
             const currentAnswer = this.answers[this.currentQuestionIndex];
-            if (currentAnswer == null || currentAnswer === '') {
+            if (!this.isAnswered(currentAnswer)) {
                 this.showModal('warning', 'Question Not Answered', 
                     `Question ${this.currentQuestionIndex + 1} has no answer selected. Please select an answer or you can skip it and come back later.`);
             }
             
             if (this.currentQuestionIndex < this.totalQuestions - 1) {
+                this.recordQuestionTime();
                 this.currentQuestionIndex++;
             }
         },
         
         previousQuestion() {
             if (this.currentQuestionIndex > 0) {
+                this.recordQuestionTime();
                 this.currentQuestionIndex--;
             }
         },
         
         goToQuestion(index) {
+            this.recordQuestionTime();
             this.currentQuestionIndex = index;
         },
         
         // Helper to count unanswered questions
         get unansweredCount() {
-            return this.answers.filter(a => a == null || a === '').length;
+            return this.answers.filter(a => !this.isAnswered(a)).length;
+        },
+        
+        // Multi-part answers are arrays or objects; empty ones count as unanswered
+        isAnswered(answer) {
+            if (answer == null || answer === '') return false;
+            if (Array.isArray(answer)) return answer.some(a => a != null && a !== '');
+            if (typeof answer === 'object') return Object.values(answer).some(a => a);
+            return true;
+        },
+        
+        // The answer as sent to the server: multi-part answers go as JSON
+        answerPayload(index) {
+            const answer = this.answers[index];
+            if (!this.isAnswered(answer)) return '';
+            return typeof answer === 'string' ? answer : JSON.stringify(answer);
+        },
+        
+        // Readable form of an answer or answer key for the results screen
+        formatAnswer(value) {
+            if (value == null || value === '') return '';
+            let parsed = value;
+            if (typeof value === 'string') {
+                const trimmed = value.trim();
+                if (!trimmed.startsWith('[') && !trimmed.startsWith('{')) return value;
+                try {
+                    parsed = JSON.parse(trimmed);
+                } catch (e) {
+                    return value;
+                }
+            }
+            if (Array.isArray(parsed)) {
+                return parsed.map(item => Array.isArray(item) ? item.join(' / ') : item).join(', ');
+            }
+            if (typeof parsed === 'object') {
+                return Object.entries(parsed).map(([prompt, choice]) => `${prompt} → ${choice}`).join(', ');
+            }
+            return String(parsed);
+        },
+        
+        // Multiple select: tick or untick an option
+        toggleSelection(option) {
+            const selected = Array.isArray(this.answers[this.currentQuestionIndex]) ? [...this.answers[this.currentQuestionIndex]] : [];
+            const at = selected.indexOf(option);
+            if (at >= 0) {
+                selected.splice(at, 1);
+            } else {
+                selected.push(option);
+            }
+            this.answers[this.currentQuestionIndex] = selected;
+        },
+        
+        // Ordering: the items in the student's current order
+        orderedItems(index) {
+            return this.answers[index] || this.questions[index].options;
+        },
+        
+        moveItem(from, step) {
+            const items = [...this.orderedItems(this.currentQuestionIndex)];
+            const to = from + step;
+            if (to < 0 || to >= items.length) return;
+            [items[from], items[to]] = [items[to], items[from]];
+            this.answers[this.currentQuestionIndex] = items;
+        },
+        
+        // Matching: pair a prompt with a choice
+        setMatch(prompt, choice) {
+            const pairs = { ...(this.answers[this.currentQuestionIndex] || {}) };
+            pairs[prompt] = choice;
+            this.answers[this.currentQuestionIndex] = pairs;
+        },
+        
+        // Fill in the blank: set one gap
+        setBlank(gap, value) {
+            const question = this.currentQuestion;
+            const gaps = Array.isArray(this.answers[this.currentQuestionIndex])
+                ? [...this.answers[this.currentQuestionIndex]]
+                : new Array(question.blankParts.length - 1).fill('');
+            gaps[gap] = value;
+            this.answers[this.currentQuestionIndex] = gaps;
         },
         
         // Submit quiz
@@ -325,75 +643,65 @@ function quizApp() {
             }
             
             this.stopTimer();
+            clearTimeout(this.autosaveTimer);
+            this.recordQuestionTime();
             const timeTaken = Math.floor((Date.now() - this.startTime) / 1000);
             
-            // Calculate results
-            let score = 0;
-            let correct = 0;
-            let incorrect = 0;
-            const details = [];
+            // Save attempt to backend - the server grades the answers
+            const graded = await this.saveAttempt();
+            if (!graded) {
+                return;
+            }
             
-            this.questions.forEach((question, index) => {
-                const userAnswer = this.answers[index];
-                const correctAnswer = question.correct_answer;
-                const isCorrect = userAnswer && userAnswer.trim().toLowerCase() === correctAnswer.trim().toLowerCase();
-                
-                if (isCorrect) {
-                    score += question.points;
-                    correct++;
-                } else {
-                    incorrect++;
-                }
-                
-                details.push({
-                    questionId: question.id,
-                    userAnswer: userAnswer || '',
-                    correctAnswer: correctAnswer,
-                    isCorrect: isCorrect,
-                    pointsEarned: isCorrect ? question.points : 0
-                });
+            const detailsById = {};
+            (graded.details || []).forEach(detail => {
+                detailsById[detail.question_id] = detail;
             });
             
-            const percentage = Math.round((score / this.totalPoints) * 100);
+            const details = this.questions.map((question, index) => {
+                const detail = detailsById[question.id] || {};
+                return {
+                    questionId: question.id,
+                    userAnswer: this.formatAnswer(detail.user_answer ?? this.answerPayload(index)),
+                    correctAnswer: this.formatAnswer(detail.correct_answer),
+                    isCorrect: !!detail.is_correct,
+                    pointsEarned: detail.points_earned || 0
+                };
+            });
             
             this.results = {
-                score,
-                totalPoints: this.totalPoints,
-                percentage,
-                correct,
-                incorrect,
+                score: graded.score,
+                totalPoints: graded.total_points,
+                percentage: Math.round(graded.percentage),
+                correct: graded.correct,
+                incorrect: graded.incorrect,
                 timeTaken,
                 details
             };
             
-            // Save attempt to backend
-            await this.saveAttempt();
-            
             this.currentScreen = 'results';
         },
         
-        // Save attempt to backend
+        // Save attempt to backend and return the server-graded result
         async saveAttempt() {
             try {
                 // For registered students, we use a different API endpoint
                 // This requires the student to be verified via phone first
                 if (!this.studentId) {
                     this.showModal('error', 'Student Not Verified', 'Please enter your phone number first to take this quiz.');
-                    return;
+                    return null;
                 }
                 
                 const payload = {
                     student_id: this.studentId,
                     course_id: this.courseId,
                     quiz_package_id: this.quizPackageId,
-                    score: this.results.score,
-                    total_points: this.results.totalPoints,
-                    time_taken: this.results.timeTaken,
-                    answers: this.results.details.map(detail => ({
-                        question_id: detail.questionId,
-                        user_answer: detail.userAnswer,
-                        is_correct: detail.isCorrect,
-                        points_earned: detail.pointsEarned
+                    attempt_id: this.attemptId,
+                    quiz_token: this.quizToken,
+                    answers: this.questions.map((question, index) => ({
+                        question_id: question.id,
+                        user_answer: this.answerPayload(index),
+                        time_spent_seconds: Math.round(this.questionSeconds[index] || 0)
                     }))
                 };
                 
@@ -412,10 +720,12 @@ function quizApp() {
                 
                 const data = await response.json();
                 console.log('Quiz results saved successfully:', data);
+                return data;
                 
             } catch (error) {
                 console.error('Error saving attempt:', error);
                 this.showModal('error', 'Save Failed', 'Failed to save your quiz results: ' + error.message);
+                return null;
             }
         },
         
@@ -426,6 +736,9 @@ function quizApp() {
                 this.studentName = '';
                 this.currentQuestionIndex = 0;
                 this.answers = new Array(this.questions.length).fill(null);
+                this.attemptId = null;
+                this.quizToken = null;
+                this.otpStep = false;
                 this.timeRemaining = 0;
                 this.results = {
                     score: 0,
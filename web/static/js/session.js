@@ -0,0 +1,65 @@
+// Login session helpers for the admin pages. Access tokens are short-lived:
+// when the API answers 401, the refresh token is swapped for a new pair once
+// and the request is retried with the new access token.
+(function () {
+    const originalFetch = window.fetch.bind(window);
+    let refreshing = null;
+
+    async function refreshSession() {
+        const refreshToken = localStorage.getItem('refresh_token');
+        if (!refreshToken) return false;
+        try {
+            const response = await originalFetch('/api/auth/refresh', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ refresh_token: refreshToken })
+            });
+            if (!response.ok) return false;
+            const data = await response.json();
+            localStorage.setItem('token', data.token);
+            localStorage.setItem('refresh_token', data.refresh_token);
+            return true;
+        } catch (error) {
+            return false;
+        }
+    }
+
+    // Concurrent 401s share one refresh, as each refresh token works once
+    window.refreshSession = function () {
+        if (!refreshing) {
+            refreshing = refreshSession().finally(() => { refreshing = null; });
+        }
+        return refreshing;
+    };
+
+    window.fetch = async function (input, init = {}) {
+        const response = await originalFetch(input, init);
+        const url = typeof input === 'string' ? input : input.url;
+        const headers = new Headers(init.headers || {});
+        if (response.status !== 401 || url.includes('/api/auth/') || !headers.has('Authorization')) {
+            return response;
+        }
+        if (!(await window.refreshSession())) {
+            return response;
+        }
+        headers.set('Authorization', `Bearer ${localStorage.getItem('token')}`);
+        return originalFetch(input, { ...init, headers });
+    };
+
+    // End the session on the server too, then forget the tokens
+    window.endSession = async function () {
+        const refreshToken = localStorage.getItem('refresh_token');
+        if (refreshToken) {
+            try {
+                await originalFetch('/api/auth/logout', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ refresh_token: refreshToken })
+                });
+            } catch (error) {
+                console.error('Logout request failed:', error);
+            }
+        }
+        localStorage.clear();
+    };
+})();